@@ -0,0 +1,151 @@
+// Package baseline accepts the violations recorded in a baseline file so only new violations fail
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+// Version is the version of the baseline file format
+const Version = 1
+
+// Baseline is the set of accepted violations keyed by their fingerprints
+type Baseline struct {
+	Version    int                   `json:"version"`
+	Violations []types.BaselineEntry `json:"violations"`
+}
+
+// New creates baseline accepting the violations of the result, the violations must be fingerprinted
+// with the paths relative to the repository root
+func New(result *types.Result) *Baseline {
+	baseline := &Baseline{
+		Version:    Version,
+		Violations: []types.BaselineEntry{},
+	}
+	seen := make(map[string]bool)
+	for _, violation := range append(append([]types.Violation{}, result.Violations...), result.Baselined...) {
+		entry := newEntry(violation)
+		if !seen[entry.Fingerprint] {
+			seen[entry.Fingerprint] = true
+			baseline.Violations = append(baseline.Violations, entry)
+		}
+	}
+	sort.Slice(baseline.Violations, func(i, j int) bool {
+		a, b := baseline.Violations[i], baseline.Violations[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Policy != b.Policy {
+			return a.Policy < b.Policy
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+	return baseline
+}
+
+// Load loads the baseline file
+func Load(path string) (*Baseline, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file, error: %v", err)
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(in, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline file: %s, error: %v", path, err)
+	}
+	if baseline.Version != Version {
+		return nil, fmt.Errorf("unsupported baseline file version: %d", baseline.Version)
+	}
+	return &baseline, nil
+}
+
+// Save writes the baseline file
+func (b *Baseline) Save(path string) error {
+	out, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write baseline file, error: %v", err)
+	}
+	return nil
+}
+
+// Scope is the part of the repository the violations were searched in, only the baseline entries
+// within the scope can be reported as fixed
+type Scope struct {
+	// Paths are the scanned file paths relative to the repository root, all paths if nil
+	Paths map[string]bool
+	// Policies are the ids of the applied policies, all policies if nil
+	Policies map[string]bool
+	// Partial is set when resources of the scanned files were skipped, no entry is reported as fixed
+	Partial bool
+}
+
+// Contains checks if the baseline entry could have been found within the scope
+func (s Scope) Contains(entry types.BaselineEntry) bool {
+	if s.Partial {
+		return false
+	}
+	if s.Paths != nil && !s.Paths[entry.Path] {
+		return false
+	}
+	if s.Policies != nil && !s.Policies[entry.Policy] {
+		return false
+	}
+	return true
+}
+
+// Apply moves the violations of the baseline out of the counted violations and records the baseline
+// entries of the scope no longer matching any violation as fixed
+func (b *Baseline) Apply(result *types.Result, scope Scope) {
+	fingerprints := make(map[string]bool)
+	for _, entry := range b.Violations {
+		fingerprints[entry.Fingerprint] = true
+	}
+
+	found := make(map[string]bool)
+	violations := []types.Violation{}
+	var preExisting int
+	for _, violation := range result.Violations {
+		fingerprint := violation.Fingerprint
+		found[fingerprint] = true
+		if fingerprints[fingerprint] {
+			result.Baselined = append(result.Baselined, violation)
+			continue
+		}
+		violations = append(violations, violation)
+		if violation.PreExisting {
+			preExisting++
+		}
+	}
+	for _, violation := range result.Suppressed {
+		found[violation.Fingerprint] = true
+	}
+	result.Violations = violations
+	result.ViolationCount = len(violations)
+	result.PreExistingCount = preExisting
+	result.BaselinedCount = len(result.Baselined)
+
+	result.FixedBaseline = nil
+	for _, entry := range b.Violations {
+		if !found[entry.Fingerprint] && scope.Contains(entry) {
+			result.FixedBaseline = append(result.FixedBaseline, entry)
+		}
+	}
+}
+
+func newEntry(violation types.Violation) types.BaselineEntry {
+	return types.BaselineEntry{
+		Fingerprint: violation.Fingerprint,
+		Policy:      violation.Policy.ID,
+		Kind:        violation.Entity.Kind,
+		Namespace:   violation.Entity.Namespace,
+		Name:        violation.Entity.Name,
+		Path:        violation.Location.Path,
+	}
+}
@@ -0,0 +1,81 @@
+package baseline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+func newViolation(policyID, name, path string) types.Violation {
+	key := "spec.replicas"
+	return types.Violation{
+		Policy:   types.Policy{ID: policyID},
+		Entity:   types.Entity{Kind: "Deployment", Namespace: "default", Name: name},
+		Details:  types.Details{ViolatingKey: &key},
+		Location: types.Location{Path: path, StartLine: 7, EndLine: 7},
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	frontend := newViolation("weave.policies.replicas", "frontend", "deploy/frontend.yaml")
+	backend := newViolation("weave.policies.replicas", "backend", "deploy/backend.yaml")
+	result := &types.Result{Violations: []types.Violation{frontend, backend}, ViolationCount: 2}
+	result.SetFingerprints()
+	frontend, backend = result.Violations[0], result.Violations[1]
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	assert.NoError(t, New(result).Save(path))
+	baseline, err := Load(path)
+	if !assert.NoError(t, err) || !assert.Len(t, baseline.Violations, 2) {
+		return
+	}
+	assert.Equal(t, "deploy/backend.yaml", baseline.Violations[0].Path, "entries should be sorted by path")
+
+	// the frontend violation is fixed, the backend one moved and a new violation is found
+	moved := backend
+	moved.Location.StartLine, moved.Location.EndLine = 12, 12
+	added := newViolation("weave.policies.privileged", "backend", "deploy/backend.yaml")
+	current := &types.Result{Violations: []types.Violation{moved, added}, ViolationCount: 2}
+	current.SetFingerprints()
+	moved, added = current.Violations[0], current.Violations[1]
+	baseline.Apply(current, Scope{})
+
+	assert.Equal(t, 1, current.ViolationCount)
+	assert.Equal(t, []types.Violation{added}, current.Violations)
+	assert.Equal(t, 1, current.BaselinedCount)
+	assert.Equal(t, []types.Violation{moved}, current.Baselined)
+	if assert.Len(t, current.FixedBaseline, 1) {
+		assert.Equal(t, "frontend", current.FixedBaseline[0].Name)
+		assert.Equal(t, frontend.Fingerprint, current.FixedBaseline[0].Fingerprint)
+	}
+
+	// entries of the files and policies not validated are not fixed
+	for name, scope := range map[string]Scope{
+		"paths":    {Paths: map[string]bool{"deploy/backend.yaml": true}},
+		"policies": {Policies: map[string]bool{"weave.policies.privileged": true}},
+		"partial":  {Partial: true},
+	} {
+		current := &types.Result{Violations: []types.Violation{moved}, ViolationCount: 1}
+		baseline.Apply(current, scope)
+		assert.Equal(t, 0, current.ViolationCount, name)
+		assert.Empty(t, current.FixedBaseline, name)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"invalid.json": "violations",
+		"version.json": `{"version": 2, "violations": []}`,
+	} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		_, err := Load(path)
+		assert.Error(t, err, name)
+	}
+	_, err := Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
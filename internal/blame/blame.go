@@ -0,0 +1,163 @@
+// Package blame attributes lines of files to the commits that last changed them using the local git repository
+package blame
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+const (
+	gitBinary = "git"
+	// uncommittedSHA is the commit git blame attributes uncommitted lines to
+	uncommittedSHA = "0000000000000000000000000000000000000000"
+)
+
+// Blamer blames files of the local git repository, every file is blamed once
+type Blamer struct {
+	files map[string]map[int]*types.Blame
+}
+
+// New creates new blamer
+func New() *Blamer {
+	return &Blamer{
+		files: make(map[string]map[int]*types.Blame),
+	}
+}
+
+// Lines returns the most recent commit that changed the lines of the file, nil is returned for files
+// or lines that are not committed
+func (b *Blamer) Lines(ctx context.Context, path string, start, end int) (*types.Blame, error) {
+	lines, ok := b.files[path]
+	if !ok {
+		var err error
+		lines, err = blameFile(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		b.files[path] = lines
+	}
+
+	var latest *types.Blame
+	for line := start; line <= end; line++ {
+		if blame, ok := lines[line]; ok && (latest == nil || blame.Date.After(latest.Date)) {
+			latest = blame
+		}
+	}
+	return latest, nil
+}
+
+// Annotate attributes the violations of the result to the commits that last changed their lines
+func (b *Blamer) Annotate(ctx context.Context, result *types.Result) error {
+	for i := range result.Violations {
+		location := result.Violations[i].Location
+		blame, err := b.Lines(ctx, location.Path, location.StartLine, location.EndLine)
+		if err != nil {
+			return err
+		}
+		result.Violations[i].Blame = blame
+	}
+	return nil
+}
+
+// blameFile returns the commits of the file lines, untracked files have no commits
+func blameFile(ctx context.Context, path string) (map[int]*types.Blame, error) {
+	dir, name := filepath.Split(path)
+	if tracked, err := isTracked(ctx, dir, name); err != nil || !tracked {
+		return map[int]*types.Blame{}, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gitBinary, "blame", "--porcelain", "--", name)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to blame file: %s, error: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	lines, err := parsePorcelain(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse blame of file: %s, error: %v", path, err)
+	}
+	return lines, nil
+}
+
+// isTracked reports whether the file is committed, git exits with 1 for untracked files
+func isTracked(ctx context.Context, dir, name string) (bool, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gitBinary, "ls-files", "--error-unmatch", "--", name)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to list git files of: %s, error: %v: %s", dir, err, strings.TrimSpace(stderr.String()))
+	}
+	return true, nil
+}
+
+// parsePorcelain parses the output of git blame --porcelain, the commit headers are only present on
+// the first line of every commit
+func parsePorcelain(r io.Reader) (map[int]*types.Blame, error) {
+	lines := make(map[int]*types.Blame)
+	commits := make(map[string]*types.Blame)
+
+	var current *types.Blame
+	var currentLine int
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\t") {
+			if current != nil && current.SHA != uncommittedSHA {
+				lines[currentLine] = current
+			}
+			current = nil
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		if current == nil {
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("invalid line header: %s", line)
+			}
+			var err error
+			if currentLine, err = strconv.Atoi(fields[2]); err != nil {
+				return nil, fmt.Errorf("invalid line header: %s", line)
+			}
+			if _, ok := commits[key]; !ok {
+				commits[key] = &types.Blame{SHA: key}
+			}
+			current = commits[key]
+			continue
+		}
+
+		switch key {
+		case "author":
+			current.Author = value
+		case "author-mail":
+			current.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "author-time":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid author time: %s", value)
+			}
+			current.Date = time.Unix(seconds, 0).UTC()
+		}
+	}
+	return lines, scanner.Err()
+}
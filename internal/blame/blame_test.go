@@ -0,0 +1,89 @@
+package blame
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+func TestLines(t *testing.T) {
+	if _, err := exec.LookPath(gitBinary); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	commit := func(author, date, content string) string {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, args := range [][]string{{"add", "-A"}, {"commit", "--quiet", "-m", "update"}} {
+			cmd := exec.Command(gitBinary, args...)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(),
+				"GIT_AUTHOR_NAME="+author, "GIT_AUTHOR_EMAIL="+author+"@example.com", "GIT_AUTHOR_DATE="+date,
+				"GIT_COMMITTER_NAME=ci", "GIT_COMMITTER_EMAIL=ci@example.com", "GIT_COMMITTER_DATE="+date,
+			)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+		}
+		out, err := exec.Command(gitBinary, "-C", dir, "rev-parse", "HEAD").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	if out, err := exec.Command(gitBinary, "init", "--quiet", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	first := commit("alice", "2023-01-01T10:00:00Z", "kind: Deployment\nspec:\n  replicas: 1\n  template: {}\n")
+	second := commit("bob", "2023-02-01T10:00:00Z", "kind: Deployment\nspec:\n  replicas: 2\n  template: {}\n")
+	// uncommitted change of the last line
+	if err := os.WriteFile(path, []byte("kind: Deployment\nspec:\n  replicas: 2\n  template: {spec: {}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "untracked.yaml"), []byte("kind: Pod\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &types.Blame{Author: "alice", Email: "alice@example.com", SHA: first, Date: time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)}
+	bob := &types.Blame{Author: "bob", Email: "bob@example.com", SHA: second, Date: time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name       string
+		path       string
+		start, end int
+		blame      *types.Blame
+	}{
+		{name: "single line", path: path, start: 1, end: 1, blame: alice},
+		{name: "changed line", path: path, start: 3, end: 3, blame: bob},
+		{name: "most recent line of range", path: path, start: 1, end: 3, blame: bob},
+		{name: "uncommitted line", path: path, start: 4, end: 4, blame: nil},
+		{name: "untracked file", path: filepath.Join(dir, "untracked.yaml"), start: 1, end: 1, blame: nil},
+	}
+
+	blamer := New()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blame, err := blamer.Lines(context.Background(), test.path, test.start, test.end)
+			assert.NoError(t, err)
+			assert.Equal(t, test.blame, blame)
+		})
+	}
+
+	t.Run("not a git repository", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.yaml")
+		assert.NoError(t, os.WriteFile(path, []byte("kind: Pod\n"), 0644))
+		_, err := New().Lines(context.Background(), path, 1, 1)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,194 @@
+package ci
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+const (
+	annotationContext    = "weave-policy-validator"
+	buildkiteAgentBinary = "buildkite-agent"
+)
+
+// annotator writes the result violations as annotations of the ci system, the violations not failing the
+// severity thresholds are annotated as warnings
+type annotator func(w io.Writer, result types.Result, thresholds types.SeverityThresholds) error
+
+var annotators = map[string]annotator{
+	"github-actions":  annotateGithubActions,
+	"gitea-actions":   annotateGithubActions,
+	"azure-pipelines": annotateAzurePipelines,
+	"teamcity":        annotateTeamcity,
+	"buildkite":       annotateBuildkite,
+}
+
+var githubActionsSeverityMap = map[string]string{
+	"low":    "notice",
+	"medium": "warning",
+	"high":   "error",
+}
+
+var azurePipelinesSeverityMap = map[string]string{
+	"low":    "warning",
+	"medium": "warning",
+	"high":   "error",
+}
+
+var teamcitySeverityMap = map[string]string{
+	"low":    "INFO",
+	"medium": "WARNING",
+	"high":   "ERROR",
+}
+
+var (
+	githubActionsDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubActionsPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	azurePipelinesEscaper        = strings.NewReplacer("%", "%AZP25", ";", "%3B", "\r", "%0D", "\n", "%0A", "]", "%5D")
+	teamcityEscaper              = strings.NewReplacer("|", "||", "'", "|'", "\n", "|n", "\r", "|r", "[", "|[", "]", "|]")
+)
+
+// SupportsAnnotations reports whether violations can be annotated in the ci system logs
+func SupportsAnnotations(system string) bool {
+	_, ok := annotators[system]
+	return ok
+}
+
+// Annotate writes the result violations as annotations of the ci system, the violations not failing the
+// severity thresholds are annotated as warnings
+func Annotate(system string, w io.Writer, result types.Result, thresholds types.SeverityThresholds) error {
+	annotate, ok := annotators[system]
+	if !ok {
+		return fmt.Errorf("annotations are not supported by ci system: %s", system)
+	}
+	return annotate(w, result, thresholds)
+}
+
+// annotateGithubActions writes violations as github actions workflow commands
+func annotateGithubActions(w io.Writer, result types.Result, thresholds types.SeverityThresholds) error {
+	for _, violation := range result.Violations {
+		level, ok := githubActionsSeverityMap[violation.Policy.Severity]
+		if !ok {
+			level = "error"
+		}
+		if !thresholds.Fails(violation) && level == "error" {
+			level = "warning"
+		}
+		_, err := fmt.Fprintf(w, "::%s file=%s,line=%d,endLine=%d,title=%s::%s\n",
+			level,
+			githubActionsPropertyEscaper.Replace(violation.Location.Path),
+			violation.Location.StartLine,
+			violation.Location.EndLine,
+			githubActionsPropertyEscaper.Replace(annotationTitle(violation)),
+			githubActionsDataEscaper.Replace(violation.Message),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotateAzurePipelines writes violations as azure pipelines logging commands
+func annotateAzurePipelines(w io.Writer, result types.Result, thresholds types.SeverityThresholds) error {
+	for _, violation := range result.Violations {
+		level, ok := azurePipelinesSeverityMap[violation.Policy.Severity]
+		if !ok {
+			level = "error"
+		}
+		if !thresholds.Fails(violation) {
+			level = "warning"
+		}
+		_, err := fmt.Fprintf(w, "##vso[task.logissue type=%s;sourcepath=%s;linenumber=%d;code=%s;]%s\n",
+			level,
+			azurePipelinesEscaper.Replace(violation.Location.Path),
+			violation.Location.StartLine,
+			azurePipelinesEscaper.Replace(violation.Policy.ID),
+			azurePipelinesEscaper.Replace(fmt.Sprintf("%s: %s", annotationTitle(violation), violation.Message)),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotateTeamcity writes violations as teamcity inspection service messages
+func annotateTeamcity(w io.Writer, result types.Result, thresholds types.SeverityThresholds) error {
+	inspections := make(map[string]bool)
+	for _, violation := range result.Violations {
+		if !inspections[violation.Policy.ID] {
+			inspections[violation.Policy.ID] = true
+			_, err := fmt.Fprintf(w, "##teamcity[inspectionType id='%s' name='%s' category='%s' description='%s']\n",
+				teamcityEscaper.Replace(violation.Policy.ID),
+				teamcityEscaper.Replace(violation.Policy.Name),
+				teamcityEscaper.Replace(violation.Policy.Category),
+				teamcityEscaper.Replace(violation.Policy.Description),
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		severity, ok := teamcitySeverityMap[violation.Policy.Severity]
+		if !ok {
+			severity = "ERROR"
+		}
+		if !thresholds.Fails(violation) && severity == "ERROR" {
+			severity = "WARNING"
+		}
+		_, err := fmt.Fprintf(w, "##teamcity[inspection typeId='%s' message='%s' file='%s' line='%d' SEVERITY='%s']\n",
+			teamcityEscaper.Replace(violation.Policy.ID),
+			teamcityEscaper.Replace(violation.Message),
+			teamcityEscaper.Replace(violation.Location.Path),
+			violation.Location.StartLine,
+			severity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotationTitle returns the policy name of the violation labelled with the warn-only mode
+func annotationTitle(violation types.Violation) string {
+	if violation.WarnOnly() {
+		return fmt.Sprintf("%s (%s)", violation.Policy.Name, types.ModeWarnOnly)
+	}
+	return violation.Policy.Name
+}
+
+// annotateBuildkite creates build annotation using the buildkite agent, buildkite has no logging
+// commands so the annotation is rendered in markdown instead
+func annotateBuildkite(w io.Writer, result types.Result, thresholds types.SeverityThresholds) error {
+	cmd := exec.Command(buildkiteAgentBinary, "annotate", "--style", buildkiteStyle(result, thresholds), "--context", annotationContext)
+	cmd.Stdin = strings.NewReader(buildkiteAnnotation(result))
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to create buildkite annotation, error: %v", err)
+	}
+	return nil
+}
+
+// buildkiteStyle returns the style of the buildkite annotation, warning if none of the violations fail
+func buildkiteStyle(result types.Result, thresholds types.SeverityThresholds) string {
+	switch {
+	case result.Failing(thresholds).ViolationCount > 0:
+		return "error"
+	case result.ViolationCount > 0:
+		return "warning"
+	default:
+		return "success"
+	}
+}
+
+// buildkiteAnnotation returns the buildkite annotation body
+func buildkiteAnnotation(result types.Result) string {
+	return result.MarkdowSummary() + "\n" + result.MarkdownDetails()
+}
@@ -0,0 +1,149 @@
+package ci
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+func newAnnotationsResult() types.Result {
+	return types.Result{
+		Scanned:        2,
+		ViolationCount: 2,
+		Violations: []types.Violation{
+			{
+				Message: "replicas must be >= 2,\nfound 1",
+				Policy: types.Policy{
+					ID:       "weave.policies.containers-minimum-replica-count",
+					Name:     "Containers Minimum Replica Count",
+					Severity: "high",
+					Category: "weave.categories.reliability",
+				},
+				Location: types.Location{Path: "deploy/app.yaml", StartLine: 7, EndLine: 7},
+			},
+			{
+				Message: "image tag 'latest' is not allowed; use a digest [100%]",
+				Policy: types.Policy{
+					ID:       "weave.policies.containers-image-tag",
+					Name:     "Containers Image Tag",
+					Severity: "low",
+					Category: "weave.categories.software-supply-chain",
+				},
+				Location: types.Location{Path: "deploy/app.yaml", StartLine: 12, EndLine: 14},
+			},
+		},
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	tests := []struct {
+		system   string
+		expected string
+	}{
+		{
+			system: "github-actions",
+			expected: "::error file=deploy/app.yaml,line=7,endLine=7,title=Containers Minimum Replica Count::replicas must be >= 2,%0Afound 1\n" +
+				"::notice file=deploy/app.yaml,line=12,endLine=14,title=Containers Image Tag::image tag 'latest' is not allowed; use a digest [100%25]\n",
+		},
+		{
+			system: "azure-pipelines",
+			expected: "##vso[task.logissue type=error;sourcepath=deploy/app.yaml;linenumber=7;code=weave.policies.containers-minimum-replica-count;]Containers Minimum Replica Count: replicas must be >= 2,%0Afound 1\n" +
+				"##vso[task.logissue type=warning;sourcepath=deploy/app.yaml;linenumber=12;code=weave.policies.containers-image-tag;]Containers Image Tag: image tag 'latest' is not allowed%3B use a digest [100%AZP25%5D\n",
+		},
+		{
+			system: "teamcity",
+			expected: "##teamcity[inspectionType id='weave.policies.containers-minimum-replica-count' name='Containers Minimum Replica Count' category='weave.categories.reliability' description='']\n" +
+				"##teamcity[inspection typeId='weave.policies.containers-minimum-replica-count' message='replicas must be >= 2,|nfound 1' file='deploy/app.yaml' line='7' SEVERITY='ERROR']\n" +
+				"##teamcity[inspectionType id='weave.policies.containers-image-tag' name='Containers Image Tag' category='weave.categories.software-supply-chain' description='']\n" +
+				"##teamcity[inspection typeId='weave.policies.containers-image-tag' message='image tag |'latest|' is not allowed; use a digest |[100%|]' file='deploy/app.yaml' line='12' SEVERITY='INFO']\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.system, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.True(t, SupportsAnnotations(test.system))
+			assert.NoError(t, Annotate(test.system, &out, newAnnotationsResult(), types.SeverityThresholds{}))
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestAnnotateWarnOnly(t *testing.T) {
+	result := newAnnotationsResult()
+	result.Violations = result.Violations[:1]
+	result.Violations[0].Policy.Mode = types.ModeWarnOnly
+
+	tests := []struct {
+		system   string
+		expected string
+	}{
+		{
+			system:   "github-actions",
+			expected: "::warning file=deploy/app.yaml,line=7,endLine=7,title=Containers Minimum Replica Count (warn-only)::replicas must be >= 2,%0Afound 1\n",
+		},
+		{
+			system:   "azure-pipelines",
+			expected: "##vso[task.logissue type=warning;sourcepath=deploy/app.yaml;linenumber=7;code=weave.policies.containers-minimum-replica-count;]Containers Minimum Replica Count (warn-only): replicas must be >= 2,%0Afound 1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.system, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.NoError(t, Annotate(test.system, &out, result, types.SeverityThresholds{}))
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestAnnotateThresholds(t *testing.T) {
+	result := newAnnotationsResult()
+	result.Violations = result.Violations[:1]
+	thresholds := types.SeverityThresholds{FailOn: "critical"}
+
+	tests := []struct {
+		system   string
+		expected string
+	}{
+		{
+			system:   "github-actions",
+			expected: "::warning file=deploy/app.yaml,line=7,endLine=7,title=Containers Minimum Replica Count::replicas must be >= 2,%0Afound 1\n",
+		},
+		{
+			system:   "azure-pipelines",
+			expected: "##vso[task.logissue type=warning;sourcepath=deploy/app.yaml;linenumber=7;code=weave.policies.containers-minimum-replica-count;]Containers Minimum Replica Count: replicas must be >= 2,%0Afound 1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.system, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.NoError(t, Annotate(test.system, &out, result, thresholds))
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestAnnotateUnsupportedSystem(t *testing.T) {
+	var out bytes.Buffer
+	assert.False(t, SupportsAnnotations("jenkins"))
+	assert.Error(t, Annotate("jenkins", &out, newAnnotationsResult(), types.SeverityThresholds{}))
+	assert.Empty(t, out.String())
+}
+
+func TestBuildkiteAnnotation(t *testing.T) {
+	annotation := buildkiteAnnotation(newAnnotationsResult())
+	assert.Contains(t, annotation, "Scanned 2 resources, found 2 violations")
+	assert.Contains(t, annotation, "Containers Minimum Replica Count (high) - 1 violation(s)")
+	assert.Contains(t, annotation, "(deploy/app.yaml#12)")
+}
+
+func TestBuildkiteStyle(t *testing.T) {
+	result := newAnnotationsResult()
+	assert.Equal(t, "error", buildkiteStyle(result, types.SeverityThresholds{}))
+	assert.Equal(t, "warning", buildkiteStyle(result, types.SeverityThresholds{FailOn: "critical"}))
+	assert.Equal(t, "success", buildkiteStyle(types.Result{Violations: []types.Violation{}}, types.SeverityThresholds{}))
+}
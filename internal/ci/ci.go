@@ -0,0 +1,141 @@
+// Package ci detects the git repository context of the running ci build
+package ci
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/weave-policy-validator/internal/git"
+)
+
+const (
+	refPrefix = "refs/heads/"
+)
+
+var scpLikeURLRegex = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// Getenv returns the value of the environment variable
+type Getenv func(key string) string
+
+// Env is the git repository context of a ci build
+type Env struct {
+	System       string
+	Provider     string
+	Host         string
+	URL          string
+	Branch       string
+	BaseBranch   string
+	SHA          string
+	PullRequest  int
+	Token        string
+	AzureProject string
+}
+
+// Detector detects builds of a ci system
+type Detector interface {
+	// Name returns the ci system name
+	Name() string
+	// Detect returns the build environment if the build runs on the ci system
+	Detect(getenv Getenv) (*Env, bool)
+}
+
+var detectors []Detector
+
+// Register adds detector, detectors are tried in registration order
+func Register(detector Detector) {
+	detectors = append(detectors, detector)
+}
+
+// Detect returns the environment of the first detector matching the build
+func Detect(getenv Getenv) (*Env, bool) {
+	for _, detector := range detectors {
+		if env, ok := detector.Detect(getenv); ok {
+			env.System = detector.Name()
+			return env, true
+		}
+	}
+	return nil, false
+}
+
+// trimRef returns the branch name of the given ref
+func trimRef(ref string) string {
+	return strings.TrimPrefix(ref, refPrefix)
+}
+
+// parseNumber parses pull request number, invalid numbers are ignored
+func parseNumber(value string) int {
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || number < 0 {
+		return 0
+	}
+	return number
+}
+
+// firstOf returns the first non empty value
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// normalizeRepoURL converts git remote urls such as git@github.com:org/repo.git to https urls
+func normalizeRepoURL(remote string) string {
+	if remote == "" {
+		return ""
+	}
+
+	if !strings.Contains(remote, "://") {
+		if groups := scpLikeURLRegex.FindStringSubmatch(remote); groups != nil {
+			remote = fmt.Sprintf("https://%s/%s", groups[1], groups[2])
+		}
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		return remote
+	}
+	if u.Scheme == "ssh" || u.Scheme == "git" {
+		u.Scheme = "https"
+		u.Host = u.Hostname()
+	}
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, ".git")
+	return u.String()
+}
+
+// providerFromURL infers the git provider of the hosted services from the repository url, self
+// hosted instances are left to be configured explicitly
+func providerFromURL(repoURL string) (string, string) {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return "", ""
+	}
+
+	host := u.Hostname()
+	switch host {
+	case "github.com":
+		return git.Github, host
+	case "gitlab.com":
+		return git.Gitlab, host
+	case "bitbucket.org":
+		return git.Bitbucket, host
+	}
+	return "", host
+}
+
+// fromRepoURL returns env with the provider inferred from the repository url
+func fromRepoURL(remote string) *Env {
+	repoURL := normalizeRepoURL(remote)
+	provider, host := providerFromURL(repoURL)
+	return &Env{
+		Provider: provider,
+		Host:     host,
+		URL:      repoURL,
+	}
+}
@@ -0,0 +1,305 @@
+package ci
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/weaveworks/weave-policy-validator/internal/git"
+)
+
+var githubPullRefRegex = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+func init() {
+	// gitea and woodpecker provide github and drone compatible variables, so they are detected first
+	Register(giteaActions{})
+	Register(githubActions{})
+	Register(gitlabCI{})
+	Register(bitbucketPipelines{})
+	Register(azurePipelines{})
+	Register(circleCI{})
+	Register(jenkins{})
+	Register(buildkite{})
+	Register(woodpecker{})
+	Register(drone{})
+	Register(tekton{})
+	Register(teamcity{})
+}
+
+type githubActions struct{}
+
+// Name implements Detector
+func (githubActions) Name() string {
+	return "github-actions"
+}
+
+// Detect implements Detector
+func (githubActions) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("GITHUB_ACTIONS") != "true" || getenv("GITEA_ACTIONS") == "true" {
+		return nil, false
+	}
+	env := githubActionsEnv(getenv)
+	if env.Provider == "" {
+		env.Provider = git.GithubEnterprise
+	}
+	return env, true
+}
+
+func githubActionsEnv(getenv Getenv) *Env {
+	serverURL := firstOf(getenv("GITHUB_SERVER_URL"), "https://github.com")
+	env := fromRepoURL(strings.TrimSuffix(serverURL, "/") + "/" + getenv("GITHUB_REPOSITORY"))
+	env.Branch = firstOf(getenv("GITHUB_HEAD_REF"), trimRef(getenv("GITHUB_REF")))
+	env.BaseBranch = getenv("GITHUB_BASE_REF")
+	env.SHA = getenv("GITHUB_SHA")
+	env.Token = getenv("GITHUB_TOKEN")
+	if groups := githubPullRefRegex.FindStringSubmatch(getenv("GITHUB_REF")); groups != nil {
+		env.PullRequest = parseNumber(groups[1])
+	}
+	return env
+}
+
+type giteaActions struct{}
+
+// Name implements Detector
+func (giteaActions) Name() string {
+	return "gitea-actions"
+}
+
+// Detect implements Detector, gitea has no git provider so the provider has to be set explicitly
+func (giteaActions) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("GITEA_ACTIONS") != "true" {
+		return nil, false
+	}
+	env := githubActionsEnv(getenv)
+	env.Provider = ""
+	return env, true
+}
+
+type gitlabCI struct{}
+
+// Name implements Detector
+func (gitlabCI) Name() string {
+	return "gitlab-ci"
+}
+
+// Detect implements Detector
+func (gitlabCI) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("GITLAB_CI") != "true" {
+		return nil, false
+	}
+	return &Env{
+		Provider:    git.Gitlab,
+		Host:        getenv("CI_SERVER_HOST"),
+		URL:         firstOf(getenv("CI_PROJECT_URL"), getenv("CI_PROJECT_PATH")),
+		Branch:      firstOf(getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"), getenv("CI_COMMIT_REF_NAME")),
+		BaseBranch:  getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"),
+		SHA:         getenv("CI_COMMIT_SHA"),
+		PullRequest: parseNumber(getenv("CI_MERGE_REQUEST_IID")),
+		Token:       getenv("CI_JOB_TOKEN"),
+	}, true
+}
+
+type bitbucketPipelines struct{}
+
+// Name implements Detector
+func (bitbucketPipelines) Name() string {
+	return "bitbucket-pipelines"
+}
+
+// Detect implements Detector
+func (bitbucketPipelines) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("BITBUCKET_REPO_FULL_NAME") == "" {
+		return nil, false
+	}
+	env := fromRepoURL(firstOf(getenv("BITBUCKET_GIT_HTTP_ORIGIN"), "https://bitbucket.org/"+getenv("BITBUCKET_REPO_FULL_NAME")))
+	env.Provider = git.Bitbucket
+	env.Branch = getenv("BITBUCKET_BRANCH")
+	env.BaseBranch = getenv("BITBUCKET_PR_DESTINATION_BRANCH")
+	env.SHA = getenv("BITBUCKET_COMMIT")
+	env.PullRequest = parseNumber(getenv("BITBUCKET_PR_ID"))
+	return env, true
+}
+
+type azurePipelines struct{}
+
+// Name implements Detector
+func (azurePipelines) Name() string {
+	return "azure-pipelines"
+}
+
+// Detect implements Detector, repositories hosted outside azure repos are detected by their url
+func (azurePipelines) Detect(getenv Getenv) (*Env, bool) {
+	if !strings.EqualFold(getenv("TF_BUILD"), "true") {
+		return nil, false
+	}
+
+	var env *Env
+	if getenv("BUILD_REPOSITORY_PROVIDER") == "TfsGit" {
+		collectionURI := strings.TrimSuffix(getenv("SYSTEM_COLLECTIONURI"), "/")
+		env = &Env{
+			Provider:     git.AzureDevops,
+			URL:          collectionURI + "/_git/" + getenv("BUILD_REPOSITORY_NAME"),
+			PullRequest:  parseNumber(getenv("SYSTEM_PULLREQUEST_PULLREQUESTID")),
+			AzureProject: getenv("SYSTEM_TEAMPROJECT"),
+			// the access token is only valid for azure repos
+			Token: getenv("SYSTEM_ACCESSTOKEN"),
+		}
+	} else {
+		env = fromRepoURL(getenv("BUILD_REPOSITORY_URI"))
+		env.PullRequest = parseNumber(getenv("SYSTEM_PULLREQUEST_PULLREQUESTNUMBER"))
+	}
+
+	env.Branch = trimRef(firstOf(getenv("SYSTEM_PULLREQUEST_SOURCEBRANCH"), getenv("BUILD_SOURCEBRANCH")))
+	env.BaseBranch = trimRef(getenv("SYSTEM_PULLREQUEST_TARGETBRANCH"))
+	env.SHA = getenv("BUILD_SOURCEVERSION")
+	return env, true
+}
+
+type circleCI struct{}
+
+// Name implements Detector
+func (circleCI) Name() string {
+	return "circleci"
+}
+
+// Detect implements Detector
+func (circleCI) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("CIRCLECI") != "true" {
+		return nil, false
+	}
+	repoURL := getenv("CIRCLE_REPOSITORY_URL")
+	if repoURL == "" {
+		repoURL = "https://github.com/" + getenv("CIRCLE_PROJECT_USERNAME") + "/" + getenv("CIRCLE_PROJECT_REPONAME")
+	}
+	env := fromRepoURL(repoURL)
+	env.Branch = getenv("CIRCLE_BRANCH")
+	env.SHA = getenv("CIRCLE_SHA1")
+	if pullRequest := getenv("CIRCLE_PULL_REQUEST"); pullRequest != "" {
+		env.PullRequest = parseNumber(path.Base(pullRequest))
+	}
+	return env, true
+}
+
+type jenkins struct{}
+
+// Name implements Detector
+func (jenkins) Name() string {
+	return "jenkins"
+}
+
+// Detect implements Detector, the pull request variables are set by multibranch pipelines
+func (jenkins) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("JENKINS_URL") == "" {
+		return nil, false
+	}
+	env := fromRepoURL(getenv("GIT_URL"))
+	env.Branch = firstOf(getenv("CHANGE_BRANCH"), getenv("BRANCH_NAME"), strings.TrimPrefix(getenv("GIT_BRANCH"), "origin/"))
+	env.BaseBranch = getenv("CHANGE_TARGET")
+	env.SHA = getenv("GIT_COMMIT")
+	env.PullRequest = parseNumber(getenv("CHANGE_ID"))
+	return env, true
+}
+
+type buildkite struct{}
+
+// Name implements Detector
+func (buildkite) Name() string {
+	return "buildkite"
+}
+
+// Detect implements Detector
+func (buildkite) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("BUILDKITE") != "true" {
+		return nil, false
+	}
+	env := fromRepoURL(getenv("BUILDKITE_REPO"))
+	env.Branch = getenv("BUILDKITE_BRANCH")
+	env.BaseBranch = getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH")
+	if sha := getenv("BUILDKITE_COMMIT"); sha != "HEAD" {
+		env.SHA = sha
+	}
+	// pull request is set to false for non pull request builds
+	env.PullRequest = parseNumber(getenv("BUILDKITE_PULL_REQUEST"))
+	return env, true
+}
+
+type woodpecker struct{}
+
+// Name implements Detector
+func (woodpecker) Name() string {
+	return "woodpecker"
+}
+
+// Detect implements Detector
+func (woodpecker) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("CI") != "woodpecker" {
+		return nil, false
+	}
+	env := fromRepoURL(firstOf(getenv("CI_REPO_URL"), getenv("CI_REPO_LINK")))
+	env.Branch = firstOf(getenv("CI_COMMIT_SOURCE_BRANCH"), getenv("CI_COMMIT_BRANCH"))
+	env.BaseBranch = getenv("CI_COMMIT_TARGET_BRANCH")
+	env.SHA = getenv("CI_COMMIT_SHA")
+	env.PullRequest = parseNumber(getenv("CI_COMMIT_PULL_REQUEST"))
+	return env, true
+}
+
+type drone struct{}
+
+// Name implements Detector
+func (drone) Name() string {
+	return "drone"
+}
+
+// Detect implements Detector
+func (drone) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("DRONE") != "true" {
+		return nil, false
+	}
+	env := fromRepoURL(firstOf(getenv("DRONE_REPO_LINK"), getenv("DRONE_GIT_HTTP_URL")))
+	env.Branch = firstOf(getenv("DRONE_SOURCE_BRANCH"), getenv("DRONE_BRANCH"))
+	env.SHA = getenv("DRONE_COMMIT_SHA")
+	env.PullRequest = parseNumber(getenv("DRONE_PULL_REQUEST"))
+	if env.PullRequest != 0 {
+		env.BaseBranch = getenv("DRONE_TARGET_BRANCH")
+	}
+	return env, true
+}
+
+type tekton struct{}
+
+// Name implements Detector
+func (tekton) Name() string {
+	return "tekton"
+}
+
+// Detect implements Detector, tekton does not expose the build context as environment variables, so
+// the task is expected to map the pipeline run name and the pipelines as code parameters to the
+// TEKTON_* variables
+func (tekton) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("TEKTON_PIPELINE_RUN") == "" {
+		return nil, false
+	}
+	env := fromRepoURL(getenv("TEKTON_REPO_URL"))
+	env.Branch = trimRef(getenv("TEKTON_SOURCE_BRANCH"))
+	env.BaseBranch = trimRef(getenv("TEKTON_TARGET_BRANCH"))
+	env.SHA = getenv("TEKTON_REVISION")
+	env.PullRequest = parseNumber(getenv("TEKTON_PULL_REQUEST_NUMBER"))
+	return env, true
+}
+
+type teamcity struct{}
+
+// Name implements Detector
+func (teamcity) Name() string {
+	return "teamcity"
+}
+
+// Detect implements Detector, teamcity only exposes the build revision by default
+func (teamcity) Detect(getenv Getenv) (*Env, bool) {
+	if getenv("TEAMCITY_VERSION") == "" {
+		return nil, false
+	}
+	return &Env{
+		SHA: getenv("BUILD_VCS_NUMBER"),
+	}, true
+}
@@ -0,0 +1,210 @@
+// Package codeowners parses CODEOWNERS files of github, gitlab and bitbucket repositories
+package codeowners
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Locations are the paths relative to the repository root the CODEOWNERS file is looked up in, in the
+// order github looks them up
+var Locations = []string{
+	".github/CODEOWNERS",
+	"CODEOWNERS",
+	"docs/CODEOWNERS",
+	".gitlab/CODEOWNERS",
+	".bitbucket/CODEOWNERS",
+}
+
+var sectionRegex = regexp.MustCompile(`^\^?\[([^\]]+)\](?:\[\d+\])?\s*(.*)$`)
+
+type rule struct {
+	pattern string
+	regex   *regexp.Regexp
+	owners  []string
+}
+
+type section struct {
+	name  string
+	rules []rule
+}
+
+// Owners holds the rules of a CODEOWNERS file, rules are grouped by gitlab sections and the rules
+// outside of sections belong to the default section
+type Owners struct {
+	sections []*section
+}
+
+// Find parses the CODEOWNERS file of the repository root, nil is returned if there is none
+func Find(root string) (*Owners, error) {
+	for _, location := range Locations {
+		path := filepath.Join(root, filepath.FromSlash(location))
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open codeowners file, error: %v", err)
+		}
+		defer f.Close()
+		owners, err := Parse(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse codeowners file: %s, error: %v", location, err)
+		}
+		return owners, nil
+	}
+	return nil, nil
+}
+
+// Parse parses CODEOWNERS file content
+func Parse(r io.Reader) (*Owners, error) {
+	current := &section{}
+	owners := &Owners{sections: []*section{current}}
+	var defaultOwners []string
+
+	scanner := bufio.NewScanner(r)
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// gitlab sections may set the default owners of their rules
+		if groups := sectionRegex.FindStringSubmatch(line); groups != nil {
+			current = &section{name: groups[1]}
+			owners.sections = append(owners.sections, current)
+			defaultOwners = splitFields(stripComment(groups[2]))
+			continue
+		}
+
+		fields := splitFields(stripComment(line))
+		if len(fields) == 0 {
+			continue
+		}
+		regex, err := compilePattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern at line %d: %v", lineNumber, err)
+		}
+		ruleOwners := fields[1:]
+		if len(ruleOwners) == 0 && current.name != "" {
+			ruleOwners = defaultOwners
+		}
+		current.rules = append(current.rules, rule{pattern: fields[0], regex: regex, owners: ruleOwners})
+	}
+	return owners, scanner.Err()
+}
+
+// Match returns the owners of the slash separated path relative to the repository root, the last
+// matching rule of every section applies
+func (o *Owners) Match(path string) []string {
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	var result []string
+	seen := make(map[string]bool)
+	for _, section := range o.sections {
+		for i := len(section.rules) - 1; i >= 0; i-- {
+			if !section.rules[i].regex.MatchString(path) {
+				continue
+			}
+			for _, owner := range section.rules[i].owners {
+				if !seen[owner] {
+					seen[owner] = true
+					result = append(result, owner)
+				}
+			}
+			break
+		}
+	}
+	return result
+}
+
+// stripComment removes the trailing comment of the line, escaped # are kept
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '#':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// splitFields splits the line by whitespace, escaped spaces are part of the field
+func splitFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			i++
+			field.WriteByte(line[i])
+		case c == ' ' || c == '\t':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteByte(c)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// compilePattern converts the gitignore style pattern to regex, patterns containing a slash are relative
+// to the repository root, other patterns match at any depth. Patterns match the directories contents
+// unless their last segment has a single star wildcard, e.g. docs/* does not match docs/a/b.md
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	trimmed := strings.Trim(pattern, "/")
+	if trimmed == "" {
+		return nil, fmt.Errorf("empty pattern: %s", pattern)
+	}
+	anchored := strings.HasPrefix(pattern, "/") || strings.Contains(trimmed, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(trimmed); i++ {
+		c := trimmed[i]
+		switch {
+		case strings.HasPrefix(trimmed[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(trimmed[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	lastSegment := trimmed[strings.LastIndex(trimmed, "/")+1:]
+	switch {
+	case dirOnly:
+		expr.WriteString("/.*")
+	case lastSegment == "**" || !strings.ContainsAny(lastSegment, "*?"):
+		expr.WriteString("(?:/.*)?")
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
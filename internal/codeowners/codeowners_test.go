@@ -0,0 +1,105 @@
+package codeowners
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const githubCodeowners = `# default owners
+*       @global-owner1 @global-owner2
+
+# javascript files
+*.js    @js-owner #This is an inline comment.
+*.go docs@example.com
+*.txt @octo-org/octocats
+/build/logs/ @doctocat
+docs/*  docs@example.com
+apps/ @octocat
+/docs/ @doctocat
+/scripts/ @doctocat @octocat
+**/logs @octocat
+/apps/github
+/deploy/my\ app/ @spaces
+\#notes @hash
+`
+
+const gitlabCodeowners = `* @default
+
+[Documentation]
+docs/ @docs-team
+
+[Database][2] @database-team
+model/db/
+config/db/database-setup.md @docs-team
+
+^[Optional] @optional
+deploy/ @deploy-team
+deploy/base/
+`
+
+func TestMatch(t *testing.T) {
+	github, err := Parse(strings.NewReader(githubCodeowners))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitlab, err := Parse(strings.NewReader(gitlabCodeowners))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		owners *Owners
+		path   string
+		result []string
+	}{
+		{name: "default owners", owners: github, path: "README.md", result: []string{"@global-owner1", "@global-owner2"}},
+		{name: "extension", owners: github, path: "src/app.js", result: []string{"@js-owner"}},
+		{name: "email owner", owners: github, path: "main.go", result: []string{"docs@example.com"}},
+		{name: "team owner", owners: github, path: "notes/todo.txt", result: []string{"@octo-org/octocats"}},
+		{name: "last matching rule", owners: github, path: "build/logs/2023/app.log", result: []string{"@octocat"}},
+		{name: "nested anchored directory", owners: github, path: "src/build/logs/app.log", result: []string{"@octocat"}},
+		{name: "directory files", owners: github, path: "docs/getting-started.md", result: []string{"@doctocat"}},
+		{name: "single star is not recursive", owners: github, path: "src/docs/build-app/troubleshooting.md", result: []string{"@global-owner1", "@global-owner2"}},
+		{name: "middle slash anchors pattern", owners: github, path: "src/docs/readme.md", result: []string{"@global-owner1", "@global-owner2"}},
+		{name: "directory at any depth", owners: github, path: "deploy/apps/app.yaml", result: []string{"@octocat"}},
+		{name: "multiple owners", owners: github, path: "scripts/deploy.sh", result: []string{"@doctocat", "@octocat"}},
+		{name: "double star", owners: github, path: "deploy/logs", result: []string{"@octocat"}},
+		{name: "rule without owners", owners: github, path: "apps/github/app.yaml", result: nil},
+		{name: "escaped space", owners: github, path: "deploy/my app/app.yaml", result: []string{"@spaces"}},
+		{name: "escaped hash", owners: github, path: "#notes", result: []string{"@hash"}},
+		{name: "leading slash", owners: github, path: "/scripts/deploy.sh", result: []string{"@doctocat", "@octocat"}},
+		{name: "sections combine owners", owners: gitlab, path: "docs/index.md", result: []string{"@default", "@docs-team"}},
+		{name: "section default owners", owners: gitlab, path: "model/db/user.go", result: []string{"@default", "@database-team"}},
+		{name: "section owners override defaults", owners: gitlab, path: "config/db/database-setup.md", result: []string{"@default", "@docs-team"}},
+		{name: "optional section", owners: gitlab, path: "deploy/base/app.yaml", result: []string{"@default", "@optional"}},
+		{name: "last match of section", owners: gitlab, path: "deploy/prod/app.yaml", result: []string{"@default", "@deploy-team"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.result, test.owners.Match(test.path))
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	owners, err := Find(dir)
+	assert.NoError(t, err)
+	assert.Nil(t, owners)
+
+	// the .github directory takes precedence over the root like on github
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "CODEOWNERS"), []byte("deploy/ @root-team\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".github"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".github", "CODEOWNERS"), []byte("deploy/ @deploy-team\n"), 0644))
+	owners, err = Find(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"@deploy-team"}, owners.Match("deploy/app.yaml"))
+}
@@ -0,0 +1,31 @@
+// Package config loads the configuration file of the validator
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+	"github.com/weaveworks/weave-policy-validator/internal/yaml"
+)
+
+// File is the configuration file of the validator
+type File struct {
+	// Policies selects the applied policies
+	Policies types.PolicySelection `yaml:"policies"`
+	// Parameters override the policy parameters by policy id and parameter name
+	Parameters map[string]map[string]interface{} `yaml:"parameters"`
+}
+
+// Load loads the configuration file
+func Load(path string) (*File, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file, error: %v", err)
+	}
+	var file File
+	if err := yaml.Unmarshal(in, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %s, error: %v", path, err)
+	}
+	return &file, nil
+}
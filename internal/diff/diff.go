@@ -0,0 +1,207 @@
+// Package diff computes the lines changed between two revisions of the local git checkout
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	gitBinary  = "git"
+	devNull    = "/dev/null"
+	newFileTag = "+++ "
+)
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// Range is an inclusive range of lines
+type Range struct {
+	Start int
+	End   int
+}
+
+// Changes holds the added or modified lines of each file
+type Changes struct {
+	root  string
+	files map[string][]Range
+}
+
+// Parse parses unified diff, file paths are relative to the given repository root
+func Parse(root string, r io.Reader) (*Changes, error) {
+	changes := &Changes{
+		root:  root,
+		files: make(map[string][]Range),
+	}
+
+	var path string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, newFileTag) {
+			path = parseFilePath(strings.TrimPrefix(line, newFileTag))
+			continue
+		}
+
+		groups := hunkHeaderRegex.FindStringSubmatch(line)
+		if groups == nil || path == "" {
+			continue
+		}
+		start, _ := strconv.Atoi(groups[1])
+		count := 1
+		if groups[2] != "" {
+			count, _ = strconv.Atoi(groups[2])
+		}
+		// hunks of removed lines only have no lines in the new file
+		if count == 0 {
+			continue
+		}
+		changes.files[path] = append(changes.files[path], Range{Start: start, End: start + count - 1})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse diff, error: %v", err)
+	}
+	return changes, nil
+}
+
+// parseFilePath returns the path of the new file of the diff header, empty for deleted files
+func parseFilePath(header string) string {
+	header = strings.TrimSuffix(header, "\t")
+	if header == devNull {
+		return ""
+	}
+	if unquoted, err := strconv.Unquote(header); err == nil {
+		header = unquoted
+	}
+	return strings.TrimPrefix(header, "b/")
+}
+
+// FromGit returns the lines changed by head since its merge base with base in the git checkout
+// containing dir
+func FromGit(ctx context.Context, dir, base, head string) (*Changes, error) {
+	dir, root, err := repositoryRoot(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := revisionRange(ctx, dir, base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := git(ctx, dir, "diff", "--unified=0", "--no-color", "--no-ext-diff", revisions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s, the history of both revisions has to be fetched, error: %v", revisions, err)
+	}
+	return Parse(root, strings.NewReader(out))
+}
+
+// ChangedFiles returns the absolute paths of the files changed by head since its merge base with base
+// in the git checkout containing dir, both paths of renamed files are returned
+func ChangedFiles(ctx context.Context, dir, base, head string) ([]string, error) {
+	dir, root, err := repositoryRoot(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := revisionRange(ctx, dir, base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := git(ctx, dir, "diff", "--name-only", "--no-renames", "-z", revisions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s, the history of both revisions has to be fetched, error: %v", revisions, err)
+	}
+
+	var files []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+		}
+	}
+	return files, nil
+}
+
+// repositoryRoot returns the directory to run git in and the root of its repository
+func repositoryRoot(ctx context.Context, dir string) (string, string, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	root, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", err
+	}
+	return dir, strings.TrimSpace(root), nil
+}
+
+// revisionRange returns the range of the revisions of head since its merge base with base
+func revisionRange(ctx context.Context, dir, base, head string) (string, error) {
+	baseRef, err := resolveRef(ctx, dir, base)
+	if err != nil {
+		return "", err
+	}
+	if head == "" {
+		head = "HEAD"
+	}
+	return fmt.Sprintf("%s...%s", baseRef, head), nil
+}
+
+// resolveRef returns the remote tracking branch of base if exists, otherwise base itself
+func resolveRef(ctx context.Context, dir, base string) (string, error) {
+	for _, ref := range []string{"origin/" + base, base} {
+		if _, err := git(ctx, dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("failed to resolve base revision: %s", base)
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gitBinary, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Contains reports whether any line of the given range of the file was changed, relative paths
+// are resolved from the working directory
+func (c *Changes) Contains(path string, start, end int) bool {
+	rel, ok := c.relativePath(path)
+	if !ok {
+		return false
+	}
+	for _, r := range c.files[rel] {
+		if start <= r.End && end >= r.Start {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Changes) relativePath(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	rel, err := filepath.Rel(c.root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
@@ -0,0 +1,119 @@
+package diff
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const unifiedDiff = `diff --git a/deploy/app.yaml b/deploy/app.yaml
+index 1111111..2222222 100644
+--- a/deploy/app.yaml
++++ b/deploy/app.yaml
+@@ -3 +3 @@ metadata:
+-  name: app
++  name: api
+@@ -10,0 +11,3 @@ spec:
++  replicas: 1
++  template:
++    spec: {}
+@@ -20,2 +22,0 @@ spec:
+-  foo: bar
+-  bar: baz
+diff --git a/deploy/old.yaml b/deploy/old.yaml
+deleted file mode 100644
+--- a/deploy/old.yaml
++++ /dev/null
+@@ -1,2 +0,0 @@
+-kind: Service
+-metadata: {}
+diff --git a/deploy/new file.yaml b/deploy/new file.yaml
+new file mode 100644
+--- /dev/null
++++ "b/deploy/new file.yaml"
+@@ -0,0 +1,2 @@
++kind: ConfigMap
++metadata: {}
+`
+
+func TestParse(t *testing.T) {
+	changes, err := Parse("/repo", strings.NewReader(unifiedDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, map[string][]Range{
+		"deploy/app.yaml":      {{Start: 3, End: 3}, {Start: 11, End: 13}},
+		"deploy/new file.yaml": {{Start: 1, End: 2}},
+	}, changes.files)
+
+	tests := []struct {
+		path     string
+		start    int
+		end      int
+		expected bool
+	}{
+		{"/repo/deploy/app.yaml", 3, 3, true},
+		{"/repo/deploy/app.yaml", 4, 10, false},
+		{"/repo/deploy/app.yaml", 9, 11, true},
+		{"/repo/deploy/app.yaml", 22, 22, false},
+		{"/repo/deploy/new file.yaml", 2, 2, true},
+		{"/repo/deploy/old.yaml", 1, 1, false},
+		{"/other/deploy/app.yaml", 3, 3, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, changes.Contains(test.path, test.start, test.end), "%s#%d-%d", test.path, test.start, test.end)
+	}
+}
+
+func TestFromGit(t *testing.T) {
+	if _, err := exec.LookPath(gitBinary); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command(gitBinary, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "--quiet", "--initial-branch", "main")
+	write("deploy/app.yaml", "kind: Deployment\nmetadata:\n  name: app\nspec:\n  replicas: 1\n")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "initial")
+
+	run("checkout", "--quiet", "-b", "feature")
+	write("deploy/app.yaml", "kind: Deployment\nmetadata:\n  name: app\nspec:\n  replicas: 1\n  paused: true\n")
+	run("commit", "--quiet", "-am", "pause")
+
+	changes, err := FromGit(context.Background(), filepath.Join(dir, "deploy"), "main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, changes.Contains(filepath.Join(dir, "deploy/app.yaml"), 5, 5))
+	assert.True(t, changes.Contains(filepath.Join(dir, "deploy/app.yaml"), 6, 6))
+
+	_, err = FromGit(context.Background(), dir, "missing", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,262 @@
+// Package exception matches violations against the policy exceptions checked in the repository
+package exception
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+	"github.com/weaveworks/weave-policy-validator/internal/yaml"
+)
+
+const (
+	// Kind is the kind of the PolicyException resources
+	Kind = "PolicyException"
+
+	exceptionsField = "exceptions"
+	dateLayout      = "2006-01-02"
+
+	// ExpiredPolicyID is the policy id of the findings raised for expired exceptions
+	ExpiredPolicyID = "weave.policies.expired-policy-exception"
+)
+
+// Exception excepts the violations of the policies matching all of its selectors, empty selectors match
+// every violation
+type Exception struct {
+	Name          string   `yaml:"name"`
+	Policies      []string `yaml:"policies"`
+	Kinds         []string `yaml:"kinds"`
+	Namespaces    []string `yaml:"namespaces"`
+	Names         []string `yaml:"names"`
+	Paths         []string `yaml:"paths"`
+	Justification string   `yaml:"justification"`
+	Owner         string   `yaml:"owner"`
+	Expires       string   `yaml:"expires"`
+
+	// Path and Line locate the exception definition
+	Path string `yaml:"-"`
+	Line int    `yaml:"-"`
+
+	expires time.Time
+	paths   []*regexp.Regexp
+}
+
+type policyException struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec Exception `yaml:"spec"`
+}
+
+// Load loads the exceptions of the file, the documents are PolicyException resources or lists of
+// exceptions under the exceptions field
+func Load(path string) ([]*Exception, error) {
+	nodes, err := yaml.MultiDocFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse exceptions file: %s, error: %v", path, err)
+	}
+
+	var exceptions []*Exception
+	for _, node := range nodes {
+		if node.GetKind() == Kind {
+			exception, err := fromResource(node, path)
+			if err != nil {
+				return nil, err
+			}
+			exceptions = append(exceptions, exception)
+			continue
+		}
+
+		field, err := node.GetField(exceptionsField)
+		if err != nil || field == nil {
+			return nil, fmt.Errorf("invalid exceptions file: %s, documents must be %s resources or have %s field", path, Kind, exceptionsField)
+		}
+		elements, err := field.Elements()
+		if err != nil {
+			return nil, fmt.Errorf("invalid exceptions file: %s, error: %v", path, err)
+		}
+		for _, element := range elements {
+			var exception Exception
+			if err := element.Decode(&exception); err != nil {
+				return nil, fmt.Errorf("invalid exception at %s#%d, error: %v", path, element.StartLine(), err)
+			}
+			exception.Path, exception.Line = path, element.StartLine()
+			if err := exception.init(); err != nil {
+				return nil, err
+			}
+			exceptions = append(exceptions, &exception)
+		}
+	}
+	return exceptions, nil
+}
+
+// FromFiles returns the PolicyException resources of the files
+func FromFiles(files []*types.File) ([]*Exception, error) {
+	var exceptions []*Exception
+	for _, file := range files {
+		for _, resource := range file.Resources {
+			if resource.Rendered == nil || resource.Rendered.Kind() != Kind {
+				continue
+			}
+			exception, err := fromResource(resource.Rendered.Node(), file.Path)
+			if err != nil {
+				return nil, err
+			}
+			exceptions = append(exceptions, exception)
+		}
+	}
+	return exceptions, nil
+}
+
+func fromResource(node *yaml.Node, path string) (*Exception, error) {
+	var resource policyException
+	if err := node.Decode(&resource); err != nil {
+		return nil, fmt.Errorf("invalid %s at %s#%d, error: %v", Kind, path, node.StartLine(), err)
+	}
+	exception := resource.Spec
+	exception.Name = resource.Metadata.Name
+	exception.Path, exception.Line = path, node.StartLine()
+	// documents following a separator start at the separator line, the first key locates the resource
+	if content := node.YNode().Content; len(content) > 0 {
+		exception.Line = content[0].Line
+	}
+	if err := exception.init(); err != nil {
+		return nil, err
+	}
+	return &exception, nil
+}
+
+// init validates the exception and compiles its selectors
+func (e *Exception) init() error {
+	if e.Name == "" {
+		e.Name = fmt.Sprintf("%s#%d", filepath.Base(e.Path), e.Line)
+	}
+	invalid := func(err error) error {
+		return fmt.Errorf("invalid exception: %s at %s#%d, error: %v", e.Name, e.Path, e.Line, err)
+	}
+
+	if len(e.Policies) == 0 {
+		return invalid(errors.New("missing policies"))
+	}
+	if strings.TrimSpace(e.Justification) == "" {
+		return invalid(errors.New("missing justification"))
+	}
+	if strings.TrimSpace(e.Owner) == "" {
+		return invalid(errors.New("missing owner"))
+	}
+	for _, name := range e.Names {
+		if _, err := path.Match(name, ""); err != nil {
+			return invalid(fmt.Errorf("invalid name glob: %s", name))
+		}
+	}
+	for _, glob := range e.Paths {
+		regex, err := compileGlob(glob)
+		if err != nil {
+			return invalid(fmt.Errorf("invalid path glob: %s", glob))
+		}
+		e.paths = append(e.paths, regex)
+	}
+	if e.Expires != "" {
+		expires, err := parseExpiry(e.Expires)
+		if err != nil {
+			return invalid(err)
+		}
+		e.expires = expires
+	}
+	return nil
+}
+
+// Expired reports whether the exception expired at the given time
+func (e *Exception) Expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// Match reports whether the violation is selected by the exception, the path is relative to the
+// repository root
+func (e *Exception) Match(violation types.Violation, path string) bool {
+	if !contains(e.Policies, violation.Policy.ID) {
+		return false
+	}
+	if len(e.Kinds) > 0 && !contains(e.Kinds, violation.Entity.Kind) {
+		return false
+	}
+	if len(e.Namespaces) > 0 && !contains(e.Namespaces, violation.Entity.Namespace) {
+		return false
+	}
+	if len(e.Names) > 0 && !matchNames(e.Names, violation.Entity.Name) {
+		return false
+	}
+	if len(e.paths) > 0 && !matchPaths(e.paths, path) {
+		return false
+	}
+	return true
+}
+
+// parseExpiry parses date or timestamp, exceptions expiring on a date apply until the end of the day
+func parseExpiry(value string) (time.Time, error) {
+	if date, err := time.Parse(dateLayout, value); err == nil {
+		return date.AddDate(0, 0, 1), nil
+	}
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry: %s, expected date in %s format", value, dateLayout)
+	}
+	return timestamp, nil
+}
+
+// compileGlob converts the slash separated glob to regex, ** matches any number of directories
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	glob = strings.TrimPrefix(glob, "/")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+func contains(items []string, item string) bool {
+	for i := range items {
+		if items[i] == item {
+			return true
+		}
+	}
+	return false
+}
+
+func matchNames(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPaths(globs []*regexp.Regexp, path string) bool {
+	for _, glob := range globs {
+		if glob.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
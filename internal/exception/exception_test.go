@@ -0,0 +1,154 @@
+package exception
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+func newViolation(policyID, kind, namespace, name, path string) types.Violation {
+	return types.Violation{
+		Policy:   types.Policy{ID: policyID},
+		Entity:   types.Entity{Kind: kind, Namespace: namespace, Name: name},
+		Location: types.Location{Path: path, StartLine: 3, EndLine: 3},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	exceptions, err := Load("testdata/exceptions.yaml")
+	if !assert.NoError(t, err) || !assert.Len(t, exceptions, 3) {
+		return
+	}
+
+	var names []string
+	var lines []int
+	for _, exception := range exceptions {
+		names = append(names, exception.Name)
+		lines = append(lines, exception.Line)
+	}
+	assert.Equal(t, []string{"node-agent", "exceptions.yaml#11", "legacy-app"}, names)
+	assert.Equal(t, []int{2, 11, 16}, lines)
+
+	tests := []struct {
+		name      string
+		exception *Exception
+		violation types.Violation
+		path      string
+		match     bool
+	}{
+		{
+			name:      "all selectors match",
+			exception: exceptions[0],
+			violation: newViolation("magalix.policies.containers-running-in-privileged-mode", "DaemonSet", "kube-system", "node-agent-linux", "/repo/deploy/agent.yaml"),
+			path:      "deploy/agent.yaml",
+			match:     true,
+		},
+		{
+			name:      "other policy",
+			exception: exceptions[0],
+			violation: newViolation("magalix.policies.containers-minimum-replica-count", "DaemonSet", "kube-system", "node-agent-linux", "/repo/deploy/agent.yaml"),
+			path:      "deploy/agent.yaml",
+		},
+		{
+			name:      "other namespace",
+			exception: exceptions[0],
+			violation: newViolation("magalix.policies.containers-running-in-privileged-mode", "DaemonSet", "default", "node-agent-linux", "/repo/deploy/agent.yaml"),
+			path:      "deploy/agent.yaml",
+		},
+		{
+			name:      "name glob",
+			exception: exceptions[0],
+			violation: newViolation("magalix.policies.containers-running-in-privileged-mode", "DaemonSet", "kube-system", "agent", "/repo/deploy/agent.yaml"),
+			path:      "deploy/agent.yaml",
+		},
+		{
+			name:      "path glob",
+			exception: exceptions[1],
+			violation: newViolation("magalix.policies.containers-minimum-replica-count", "Deployment", "default", "redis", "/repo/vendor/redis/manifests/redis.yaml"),
+			path:      "vendor/redis/manifests/redis.yaml",
+			match:     true,
+		},
+		{
+			name:      "path outside glob",
+			exception: exceptions[1],
+			violation: newViolation("magalix.policies.containers-minimum-replica-count", "Deployment", "default", "redis", "/repo/deploy/redis.yaml"),
+			path:      "deploy/redis.yaml",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.match, test.exception.Match(test.violation, test.path))
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "missing policies", content: "exceptions:\n  - justification: reason\n    owner: '@platform'\n"},
+		{name: "missing justification", content: "exceptions:\n  - policies: [id]\n    owner: '@platform'\n"},
+		{name: "missing owner", content: "exceptions:\n  - policies: [id]\n    justification: reason\n"},
+		{name: "invalid expiry", content: "exceptions:\n  - policies: [id]\n    justification: reason\n    owner: '@platform'\n    expires: next week\n"},
+		{name: "invalid name glob", content: "exceptions:\n  - policies: [id]\n    names: ['[app']\n    justification: reason\n    owner: '@platform'\n"},
+		{name: "unknown document", content: "apiVersion: v1\nkind: ConfigMap\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "exceptions.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(test.content), 0644))
+			_, err := Load(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	exceptions, err := Load("testdata/exceptions.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := newViolation("magalix.policies.containers-running-in-privileged-mode", "DaemonSet", "kube-system", "node-agent-linux", "/repo/deploy/agent.yaml")
+
+	t.Run("before expiry", func(t *testing.T) {
+		matcher := NewMatcher(exceptions, "/repo", time.Date(2023, 6, 30, 23, 0, 0, 0, time.UTC))
+		assert.Equal(t, &types.Suppression{
+			Kind:      types.SuppressionException,
+			Reason:    "the agent manages the node network",
+			Exception: "node-agent",
+			Owner:     "@platform",
+			Expires:   "2023-06-30",
+		}, matcher.Match(agent))
+		assert.Empty(t, matcher.ExpiredViolations())
+	})
+
+	t.Run("after expiry", func(t *testing.T) {
+		matcher := NewMatcher(exceptions, "/repo", time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC))
+		assert.Nil(t, matcher.Match(agent))
+		expired := matcher.ExpiredViolations()
+		if assert.Len(t, expired, 1) {
+			assert.Equal(t, ExpiredPolicyID, expired[0].Policy.ID)
+			assert.Equal(t, types.Location{Path: "testdata/exceptions.yaml", StartLine: 2, EndLine: 2}, expired[0].Location)
+		}
+	})
+}
+
+func TestFromFiles(t *testing.T) {
+	file, err := types.NewFileFromPath("testdata/exceptions.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, resource := range file.Resources {
+		resource.Rendered = resource.Raw
+	}
+	exceptions, err := FromFiles([]*types.File{file})
+	if assert.NoError(t, err) && assert.Len(t, exceptions, 1) {
+		assert.Equal(t, "legacy-app", exceptions[0].Name)
+		assert.Equal(t, []string{"legacy"}, exceptions[0].Names)
+	}
+}
@@ -0,0 +1,75 @@
+package exception
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+// Matcher matches violations against the exceptions that did not expire
+type Matcher struct {
+	root       string
+	exceptions []*Exception
+	expired    []*Exception
+}
+
+// NewMatcher creates new matcher of the exceptions, the exception paths are relative to the repository root
+func NewMatcher(exceptions []*Exception, root string, now time.Time) *Matcher {
+	matcher := &Matcher{root: root}
+	for _, exception := range exceptions {
+		if exception.Expired(now) {
+			matcher.expired = append(matcher.expired, exception)
+		} else {
+			matcher.exceptions = append(matcher.exceptions, exception)
+		}
+	}
+	return matcher
+}
+
+// Match returns the suppression of the violation by the first matching exception
+func (m *Matcher) Match(violation types.Violation) *types.Suppression {
+	path := types.RelativePath(m.root, violation.Location.Path)
+	for _, exception := range m.exceptions {
+		if exception.Match(violation, path) {
+			return &types.Suppression{
+				Kind:      types.SuppressionException,
+				Reason:    exception.Justification,
+				Exception: exception.Name,
+				Owner:     exception.Owner,
+				Expires:   exception.Expires,
+			}
+		}
+	}
+	return nil
+}
+
+// ExpiredViolations returns the findings of the expired exceptions located at their definitions
+func (m *Matcher) ExpiredViolations() []types.Violation {
+	var violations []types.Violation
+	for _, exception := range m.expired {
+		violations = append(violations, types.Violation{
+			ID:      fmt.Sprintf("%s_%s", ExpiredPolicyID, exception.Name),
+			Message: fmt.Sprintf("Policy exception %s of %s expired on %s", exception.Name, exception.Owner, exception.Expires),
+			Policy: types.Policy{
+				ID:          ExpiredPolicyID,
+				Name:        "Expired Policy Exception",
+				Severity:    "medium",
+				Category:    "weave.categories.policy-exceptions",
+				Description: "The policy exception expired and no longer excepts the violations it matches",
+				HowToSolve:  "Fix the excepted violations and remove the exception, or review its justification and extend its expiry",
+				Mode:        types.ModeEnforce,
+			},
+			Entity: types.Entity{
+				Name: exception.Name,
+				Kind: Kind,
+			},
+			Location: types.Location{
+				Path:      exception.Path,
+				StartLine: exception.Line,
+				EndLine:   exception.Line,
+			},
+		})
+	}
+	return violations
+}
@@ -5,9 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"unsafe"
 
 	"github.com/microsoft/azure-devops-go-api/azuredevops"
 	"github.com/microsoft/azure-devops-go-api/azuredevops/git"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/location"
 	"github.com/weaveworks/weave-policy-validator/internal/types"
 )
 
@@ -18,29 +23,54 @@ var (
 
 type AzureDevopsProvider struct {
 	client          git.Client
+	location        location.Client
 	project         string
 	repo            string
 	organizationUrl string
 }
 
-func newAzureGitopsProvider(organizationUrl, project, repo, token string) (*AzureDevopsProvider, error) {
+func newAzureGitopsProvider(organizationUrl, project, repo, token string, httpConf HTTPConfig) (*AzureDevopsProvider, error) {
+	httpClient, err := NewHTTPClient(httpConf)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create a connection to your organization
 	connection := azuredevops.NewPatConnection(organizationUrl, token)
 	ctx := context.Background()
 
-	client, err := git.NewClient(ctx, connection)
+	// resolve the git area url the same way git.NewClient does, with the clients sending their requests
+	// through the http client so the proxy, retries and timeouts apply to azure devops too
+	base := azureClient(connection, organizationUrl, httpClient)
+	gitBase := base
+	areas, err := base.GetResourceAreas(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to init azure devops client, error: %v", err)
 	}
+	for _, area := range *areas {
+		if area.Id != nil && *area.Id == git.ResourceAreaId && area.LocationUrl != nil {
+			gitBase = azureClient(connection, *area.LocationUrl, httpClient)
+		}
+	}
+
 	return &AzureDevopsProvider{
-		client:          client,
+		client:          &git.ClientImpl{Client: *gitBase},
+		location:        &location.ClientImpl{Client: *base},
 		organizationUrl: organizationUrl,
 		project:         project,
 		repo:            repo,
 	}, nil
 }
 
+// azureClient returns the azure devops client of the base url sending its requests with the http client,
+// the sdk builds its own http client without a proxy or a transport option so it is replaced here
+func azureClient(connection *azuredevops.Connection, baseUrl string, httpClient *http.Client) *azuredevops.Client {
+	client := *connection.GetClientByUrl(baseUrl)
+	field := reflect.ValueOf(&client).Elem().FieldByName("client")
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(httpClient))
+	return &client
+}
+
 // GetBranchRef forms the full branch name
 func (az *AzureDevopsProvider) GetBranchRef(branch string) string {
 	return fmt.Sprintf("refs/heads/%s", branch)
@@ -88,19 +118,21 @@ func (az *AzureDevopsProvider) CreateBranch(ctx context.Context, branch string,
 }
 
 // CreateCommit creates new commit
-func (az *AzureDevopsProvider) CreateCommit(ctx context.Context, branch, message string, files []*types.File) error {
+func (az *AzureDevopsProvider) CreateCommit(ctx context.Context, branch, message string, files []*types.File) (*types.CommitSignature, error) {
 	changes := make([]interface{}, 0)
 
 	for _, file := range files {
 		content, err := file.Content()
 		if err != nil {
-			return fmt.Errorf("failed to get file content, file: %s, error: %v", file.Path, err)
+			return nil, fmt.Errorf("failed to get file content, file: %s, error: %v", file.Path, err)
 		}
 
+		// azure devops item paths are absolute to the repository root
+		path := "/" + strings.TrimPrefix(file.Path, "/")
 		changes = append(changes, &git.GitChange{
 			ChangeType: &git.VersionControlChangeTypeValues.Edit,
 			Item: &git.GitLastChangeItem{
-				Path: &file.Path,
+				Path: &path,
 			},
 			NewContent: &git.ItemContent{
 				Content:     &content,
@@ -113,7 +145,7 @@ func (az *AzureDevopsProvider) CreateCommit(ctx context.Context, branch, message
 
 	branchObject, err := az.GetBranch(ctx, branch)
 	if err != nil {
-		return fmt.Errorf(fmt.Sprintf("couldn't get branch %s", branch), err)
+		return nil, fmt.Errorf(fmt.Sprintf("couldn't get branch %s", branch), err)
 	}
 
 	args := git.CreatePushArgs{
@@ -140,14 +172,15 @@ func (az *AzureDevopsProvider) CreateCommit(ctx context.Context, branch, message
 
 	_, err = az.client.CreatePush(ctx, args)
 	if err != nil {
-		return fmt.Errorf("failed to create commit, error: %v", err)
+		return nil, fmt.Errorf("failed to create commit, error: %v", err)
 	}
 
-	return nil
+	return nil, nil
 }
 
-// CreatePullRequest creates new pull request
-func (az *AzureDevopsProvider) CreatePullRequest(ctx context.Context, source, target, title, description string) (*string, error) {
+// CreatePullRequest creates new pull request, reviewers are logged and not requested as azure devops identifies
+// them by ids
+func (az *AzureDevopsProvider) CreatePullRequest(ctx context.Context, source, target, title, description string, reviewers []string) (*string, error) {
 	source = az.GetBranchRef(source)
 	target = az.GetBranchRef(target)
 	listArgs := git.GetPullRequestsArgs{
@@ -163,7 +196,7 @@ func (az *AzureDevopsProvider) CreatePullRequest(ctx context.Context, source, ta
 		return nil, fmt.Errorf("failed to list pull requests, error: %v", err)
 	}
 	if len(*pulls) > 0 {
-		return (*pulls)[0].Repository.RemoteUrl, nil
+		return azurePullRequestURL((*pulls)[0]), nil
 	}
 	args := git.CreatePullRequestArgs{
 		GitPullRequestToCreate: &git.GitPullRequest{
@@ -179,10 +212,99 @@ func (az *AzureDevopsProvider) CreatePullRequest(ctx context.Context, source, ta
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pull request, error: %v", err)
 	}
-	return pullRequest.Url, nil
+	if len(reviewers) > 0 {
+		log.Printf("skipped pull request reviewers: %s, azure devops reviewers are not requested", strings.Join(reviewers, ", "))
+	}
+	return azurePullRequestURL(*pullRequest), nil
+}
+
+// azurePullRequestURL returns the web url of the pull request
+func azurePullRequestURL(pr git.GitPullRequest) *string {
+	if pr.Repository == nil || pr.Repository.WebUrl == nil || pr.PullRequestId == nil {
+		return pr.Url
+	}
+	webURL := fmt.Sprintf("%s/pullrequest/%d", *pr.Repository.WebUrl, *pr.PullRequestId)
+	return &webURL
 }
 
 // CreateReport not implemented
-func (az *AzureDevopsProvider) CreateReport(ctx context.Context, sha string, result types.Result) error {
-	return errors.New("not implemented")
+func (az *AzureDevopsProvider) CreateReport(ctx context.Context, sha string, result types.Result, thresholds types.SeverityThresholds, ownerMaxViolations map[string]int) error {
+	return ErrNotImplemented
+}
+
+// CreateReview not implemented
+func (az *AzureDevopsProvider) CreateReview(ctx context.Context, number int, sha string, result types.Result) error {
+	return ErrNotImplemented
+}
+
+// UpsertComment updates the pull request comment of the authenticated user containing the marker or
+// creates a new thread
+func (az *AzureDevopsProvider) UpsertComment(ctx context.Context, number int, marker, body string) error {
+	connection, err := az.location.GetConnectionData(ctx, location.GetConnectionDataArgs{})
+	if err != nil {
+		return fmt.Errorf("failed to get current user, error: %v", err)
+	}
+	if connection.AuthenticatedUser == nil || connection.AuthenticatedUser.Id == nil {
+		return errors.New("failed to get current user, error: missing authenticated user")
+	}
+	userID := connection.AuthenticatedUser.Id.String()
+
+	threads, err := az.client.GetThreads(ctx, git.GetThreadsArgs{
+		RepositoryId:  &az.repo,
+		PullRequestId: &number,
+		Project:       &az.project,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pull request threads, error: %v", err)
+	}
+
+	for _, thread := range *threads {
+		if thread.Comments == nil {
+			continue
+		}
+		for _, comment := range *thread.Comments {
+			if comment.Content == nil || !strings.Contains(*comment.Content, marker) || !azureCommentAuthor(comment, userID) {
+				continue
+			}
+			args := git.UpdateCommentArgs{
+				Comment:       &git.Comment{Content: &body},
+				RepositoryId:  &az.repo,
+				PullRequestId: &number,
+				ThreadId:      thread.Id,
+				CommentId:     comment.Id,
+				Project:       &az.project,
+			}
+			_, err := az.client.UpdateComment(ctx, args)
+			if err != nil {
+				return fmt.Errorf("failed to update pull request comment, error: %v", err)
+			}
+			return nil
+		}
+	}
+
+	args := git.CreateThreadArgs{
+		CommentThread: &git.GitPullRequestCommentThread{
+			Comments: &[]git.Comment{
+				{
+					Content:     &body,
+					CommentType: &git.CommentTypeValues.Text,
+				},
+			},
+			// resolved as by design so the summary is shown without blocking the comment resolution policy
+			Status: &git.CommentThreadStatusValues.ByDesign,
+		},
+		RepositoryId:  &az.repo,
+		PullRequestId: &number,
+		Project:       &az.project,
+	}
+	_, err = az.client.CreateThread(ctx, args)
+	if err != nil {
+		return fmt.Errorf("failed to create pull request thread, error: %v", err)
+	}
+	return nil
+}
+
+// azureCommentAuthor checks whether the comment is authored by the user of the id
+func azureCommentAuthor(comment git.Comment, userID string) bool {
+	return comment.Author != nil && comment.Author.Id != nil && strings.EqualFold(*comment.Author.Id, userID)
 }
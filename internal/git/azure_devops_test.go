@@ -0,0 +1,57 @@
+package git
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/weave-policy-validator/internal/git/gittest"
+)
+
+func TestAzureDevopsHTTPConfig(t *testing.T) {
+	forge, sha := newConformanceForge()
+	handler := gittest.NewAzureDevopsHandler(forge)
+
+	var mu sync.Mutex
+	var hosts []string
+	throttled := false
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.URL.Host)
+		throttle := !throttled
+		throttled = true
+		mu.Unlock()
+
+		if throttle {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	p, err := newAzureGitopsProvider("http://azure.invalid/", forge.Owner, forge.Repo, "token", HTTPConfig{
+		Timeout:    10 * time.Second,
+		MaxRetries: 1,
+		ProxyURL:   proxy.URL,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	branch, err := p.GetBranch(context.Background(), conformanceBase)
+	if assert.NoError(t, err) {
+		assert.Equal(t, sha, *branch.Commit.CommitId)
+	}
+
+	assert.True(t, throttled)
+	assert.NotEmpty(t, hosts)
+	for _, host := range hosts {
+		assert.Equal(t, "azure.invalid", host, "requests should be sent through the proxy")
+	}
+}
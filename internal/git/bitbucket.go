@@ -3,6 +3,7 @@ package git
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 
@@ -21,22 +22,25 @@ type BitbucketProvider struct {
 	client *bitbucket.Client
 }
 
-func newBitbucketProvider(owner, repo, token string) (*BitbucketProvider, error) {
+func newBitbucketProvider(owner, repo, token, baseURL string, httpClient *http.Client) (*BitbucketProvider, error) {
+	opts := []bitbucket.Option{bitbucket.WithHTTPClient(httpClient)}
+	if baseURL != "" {
+		opts = append(opts, bitbucket.WithBaseURL(baseURL))
+	}
 	return &BitbucketProvider{
-		client: bitbucket.NewClient(owner, repo, token),
+		client: bitbucket.NewClient(owner, repo, token, opts...),
 	}, nil
 }
 
 // CreateBranch creates new branch from given commit SHA
 func (bb *BitbucketProvider) CreateBranch(ctx context.Context, branch string, sha string) error {
-	resp, err := bb.client.GetBranch(ctx, branch)
-	if err != nil {
-		return fmt.Errorf("failed to get branch: %s, error: %v", branch, err)
-	}
-
-	if resp.StatusCode == http.StatusOK {
+	_, err := bb.client.GetBranch(ctx, branch)
+	if err == nil {
 		return nil
 	}
+	if !bitbucket.IsNotFound(err) {
+		return fmt.Errorf("failed to get branch: %s, error: %v", branch, err)
+	}
 
 	opts := bitbucket.CreateBranchOptions{
 		Name: branch,
@@ -45,20 +49,16 @@ func (bb *BitbucketProvider) CreateBranch(ctx context.Context, branch string, sh
 		},
 	}
 
-	resp, err = bb.client.CreateBranch(ctx, opts)
+	_, err = bb.client.CreateBranch(ctx, opts)
 	if err != nil {
 		return fmt.Errorf("failed to create branch, error: %v", err)
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to create branch, error: %s", resp.Status)
-	}
-
 	return nil
 }
 
 // CreateCommit creates new commit
-func (bb *BitbucketProvider) CreateCommit(ctx context.Context, branch, message string, files []*types.File) error {
+func (bb *BitbucketProvider) CreateCommit(ctx context.Context, branch, message string, files []*types.File) (*types.CommitSignature, error) {
 	opts := bitbucket.CreateCommitOptions{
 		Message: message,
 		Branch:  branch,
@@ -67,7 +67,7 @@ func (bb *BitbucketProvider) CreateCommit(ctx context.Context, branch, message s
 	for _, file := range files {
 		content, err := file.Content()
 		if err != nil {
-			return nil
+			return nil, err
 		}
 		opts.CommitFiles = append(opts.CommitFiles, bitbucket.CommitFile{
 			Path:    file.Path,
@@ -75,22 +75,35 @@ func (bb *BitbucketProvider) CreateCommit(ctx context.Context, branch, message s
 		})
 	}
 
-	resp, err := bb.client.CreateCommit(ctx, opts)
+	err := bb.client.CreateCommit(ctx, opts)
 	if err != nil {
-		return fmt.Errorf("failed to create commit, error: %v", err)
+		return nil, fmt.Errorf("failed to create commit, error: %v", err)
+	}
+
+	return nil, nil
+}
+
+// CreatePullRequest creates pull request, reviewers are logged and not requested as bitbucket identifies them
+// by account ids
+func (bb *BitbucketProvider) CreatePullRequest(ctx context.Context, source, target, title, description string, reviewers []string) (*string, error) {
+	listOpts := bitbucket.ListPullRequestsOptions{
+		SourceBranch:      source,
+		DestinationBranch: target,
+		State:             bitbucket.PullRequestStateOpen,
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to create commit, error: %s", resp.Status)
+	pulls, err := bb.client.ListPullRequests(ctx, listOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests, error: %v", err)
 	}
 
-	return nil
-}
+	if len(pulls) > 0 {
+		return &pulls[0].Links.HTML.Href, nil
+	}
 
-// CreatePullRequest creates pull request
-func (bb *BitbucketProvider) CreatePullRequest(ctx context.Context, source, target, title, description string) (*string, error) {
 	opts := bitbucket.CreatePullRequestOptions{
-		Title: title,
+		Title:       title,
+		Description: description,
 		Source: bitbucket.PullRequestRef{
 			Branch: bitbucket.Branch{Name: source},
 		},
@@ -99,20 +112,20 @@ func (bb *BitbucketProvider) CreatePullRequest(ctx context.Context, source, targ
 		},
 	}
 
-	resp, err := bb.client.CreatePullRequest(ctx, opts)
+	pr, err := bb.client.CreatePullRequest(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pull request, error: %v", err)
 	}
-
-	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("failed to create pull request, error: %s", resp.Status)
+	if len(reviewers) > 0 {
+		log.Printf("skipped pull request reviewers: %s, bitbucket reviewers are not requested", strings.Join(reviewers, ", "))
 	}
 
-	return nil, nil
+	return &pr.Links.HTML.Href, nil
 }
 
-// CreateReport creates report
-func (bb *BitbucketProvider) CreateReport(ctx context.Context, sha string, result types.Result) error {
+// CreateReport creates report, the report fails if violations reach the thresholds and exceed the max
+// violations of their owners
+func (bb *BitbucketProvider) CreateReport(ctx context.Context, sha string, result types.Result, thresholds types.SeverityThresholds, ownerMaxViolations map[string]int) error {
 	opts := bitbucket.CreateReportOptions{
 		ID:       fmt.Sprintf("weave-%s", sha[:7]),
 		Title:    "Weaveworks",
@@ -144,44 +157,77 @@ func (bb *BitbucketProvider) CreateReport(ctx context.Context, sha string, resul
 	var annotations []bitbucket.ReportAnnotation
 	for i := range result.Violations {
 		violation := result.Violations[i]
+		severity := bitbucket.AnnotationSeverity(strings.ToUpper(violation.Policy.Severity))
+		if !thresholds.Fails(violation) {
+			severity = bitbucket.AnnotationSeverityLow
+		}
 		annotations = append(annotations, bitbucket.ReportAnnotation{
 			ExternalID: fmt.Sprintf("%s-%d", opts.ID, i),
 			Title:      violation.Policy.Name,
 			Summary:    violation.Message,
 			Type:       bitbucket.AnnotationTypeCodeSmell,
-			Severity:   bitbucket.AnnotationSeverity(strings.ToUpper(violation.Policy.Severity)),
+			Severity:   severity,
 			Path:       violation.Location.Path,
 			Line:       violation.Location.StartLine,
 		})
 	}
 
-	if result.ViolationCount == 0 {
+	if !result.Fails(thresholds, ownerMaxViolations) {
 		opts.Result = bitbucket.ReportResultPassed
 	} else {
 		opts.Result = bitbucket.ReportResultFailed
 	}
 
-	resp, err := bb.client.CreateReport(ctx, opts)
+	_, err := bb.client.CreateReport(ctx, opts)
 	if err != nil {
 		return fmt.Errorf("failed to create report, error: %v", err)
 	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to create report, error: %s", resp.Status)
-	}
-
 	annotationCount := len(annotations)
 	if annotationCount > 0 {
 		for i := 0; i < annotationCount; i += bitbucketMaxAnnotationsPerRequest {
 			annotationLimit := min(annotationCount, i+bitbucketMaxAnnotationsPerRequest)
-			resp, err = bb.client.AddAnnotationToReport(ctx, opts.SHA, opts.ID, annotations[i:i+annotationLimit])
+			_, err = bb.client.AddAnnotationToReport(ctx, opts.SHA, opts.ID, annotations[i:annotationLimit])
 			if err != nil {
 				return fmt.Errorf("failed to create report annotation, error: %v", err)
 			}
-			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-				return fmt.Errorf("failed to create report annotation, error: %s", resp.Status)
-			}
 		}
 	}
 	return nil
 }
+
+// CreateReview not implemented
+func (bb *BitbucketProvider) CreateReview(ctx context.Context, number int, sha string, result types.Result) error {
+	return ErrNotImplemented
+}
+
+// UpsertComment updates the pull request comment of the authenticated user containing the marker or
+// creates a new one
+func (bb *BitbucketProvider) UpsertComment(ctx context.Context, number int, marker, body string) error {
+	user, err := bb.client.GetCurrentUser(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current user, error: %v", err)
+	}
+
+	comments, err := bb.client.ListPullRequestComments(ctx, number)
+	if err != nil {
+		return fmt.Errorf("failed to list pull request comments, error: %v", err)
+	}
+
+	for _, comment := range comments {
+		if !strings.Contains(comment.Content.Raw, marker) || comment.User == nil || comment.User.UUID != user.UUID {
+			continue
+		}
+		_, err := bb.client.UpdatePullRequestComment(ctx, number, comment.ID, body)
+		if err != nil {
+			return fmt.Errorf("failed to update pull request comment, error: %v", err)
+		}
+		return nil
+	}
+
+	_, err = bb.client.CreatePullRequestComment(ctx, number, body)
+	if err != nil {
+		return fmt.Errorf("failed to create pull request comment, error: %v", err)
+	}
+	return nil
+}
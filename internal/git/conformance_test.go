@@ -0,0 +1,376 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/weave-policy-validator/internal/git/gittest"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+	"github.com/weaveworks/weave-policy-validator/internal/yaml"
+)
+
+const (
+	conformanceBase = "main"
+	conformanceApp  = "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  namespace: default\n"
+	conformanceDB   = "apiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: db\n  namespace: default\n"
+)
+
+// providerFactory creates the provider under test backed by the given forge
+type providerFactory func(t *testing.T, forge *gittest.Forge) Provider
+
+func newConformanceServer(t *testing.T, handler http.Handler) (*httptest.Server, *http.Client) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	httpClient, err := NewHTTPClient(HTTPConfig{Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, httpClient
+}
+
+func TestProviderConformance(t *testing.T) {
+	factories := map[string]providerFactory{
+		Github: func(t *testing.T, forge *gittest.Forge) Provider {
+			server, httpClient := newConformanceServer(t, gittest.NewGithubHandler(forge))
+			p, err := newGithubProvider(forge.Owner, forge.Repo, "token", server.URL, GithubAppConfig{}, httpClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p
+		},
+		Gitlab: func(t *testing.T, forge *gittest.Forge) Provider {
+			server, httpClient := newConformanceServer(t, gittest.NewGitlabHandler(forge))
+			p, err := newGitlabProvider(forge.Owner, forge.Repo, "token", server.URL, httpClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p
+		},
+		Bitbucket: func(t *testing.T, forge *gittest.Forge) Provider {
+			server, httpClient := newConformanceServer(t, gittest.NewBitbucketHandler(forge))
+			p, err := newBitbucketProvider(forge.Owner, forge.Repo, "token", server.URL, httpClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p
+		},
+		AzureDevops: func(t *testing.T, forge *gittest.Forge) Provider {
+			server, _ := newConformanceServer(t, gittest.NewAzureDevopsHandler(forge))
+			p, err := newAzureGitopsProvider(server.URL, forge.Owner, forge.Repo, "token", HTTPConfig{Timeout: 10 * time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p
+		},
+	}
+
+	for _, name := range []string{Github, Gitlab, Bitbucket, AzureDevops} {
+		t.Run(name, func(t *testing.T) {
+			testProviderConformance(t, factories[name])
+		})
+	}
+}
+
+// testProviderConformance runs the behaviors expected from every provider
+func testProviderConformance(t *testing.T, newProvider providerFactory) {
+	ctx := context.Background()
+
+	t.Run("create branch is idempotent", func(t *testing.T) {
+		forge, sha := newConformanceForge()
+		p := newProvider(t, forge)
+
+		assert.NoError(t, p.CreateBranch(ctx, "feature", sha))
+		head := forge.Commit("feature", "update", map[string]string{"README.md": "updated"})
+		assert.NoError(t, p.CreateBranch(ctx, "feature", sha))
+
+		branch, ok := forge.Branch("feature")
+		if assert.True(t, ok) {
+			assert.Equal(t, head, branch.SHA, "existing branch should not be reset")
+		}
+		assert.Equal(t, []string{"feature", conformanceBase}, forge.Branches())
+	})
+
+	t.Run("create commit with multiple files", func(t *testing.T) {
+		forge, sha := newConformanceForge()
+		p := newProvider(t, forge)
+		files := newConformanceFiles(t)
+
+		assert.NoError(t, p.CreateBranch(ctx, "feature", sha))
+		_, err := p.CreateCommit(ctx, "feature", "fix violations", files)
+		assert.NoError(t, err)
+
+		branch, ok := forge.Branch("feature")
+		if !assert.True(t, ok) {
+			return
+		}
+		assert.Equal(t, sha, branch.Parent)
+		assert.Equal(t, "fix violations", branch.Message)
+		for _, file := range files {
+			content, err := file.Content()
+			assert.NoError(t, err)
+			assert.Equal(t, content, branch.Files[file.Path])
+		}
+		assert.Equal(t, "# policies", branch.Files["README.md"], "untouched files should be kept")
+
+		base, _ := forge.Branch(conformanceBase)
+		assert.Equal(t, sha, base.SHA, "base branch should not be updated")
+	})
+
+	t.Run("open pull request is deduplicated", func(t *testing.T) {
+		forge, sha := newConformanceForge()
+		repo := &GitRepository{provider: newProvider(t, forge)}
+		files := newConformanceFiles(t)
+
+		first, _, err := repo.OpenPullRequest(ctx, conformanceBase, sha, files, nil)
+		if !assert.NoError(t, err) || !assert.NotNil(t, first) {
+			return
+		}
+		second, _, err := repo.OpenPullRequest(ctx, conformanceBase, sha, files, nil)
+		if !assert.NoError(t, err) || !assert.NotNil(t, second) {
+			return
+		}
+
+		assert.NotEmpty(t, *first)
+		assert.Equal(t, *first, *second)
+
+		pulls := forge.PullRequests()
+		if assert.Len(t, pulls, 1) {
+			assert.Equal(t, branchPrefix+conformanceBase, pulls[0].Source)
+			assert.Equal(t, conformanceBase, pulls[0].Target)
+			assert.NotEmpty(t, pulls[0].Description)
+		}
+	})
+
+	t.Run("create report", func(t *testing.T) {
+		for _, violations := range []int{0, 1, 51, 120} {
+			t.Run(fmt.Sprintf("%d violations", violations), func(t *testing.T) {
+				forge, sha := newConformanceForge()
+				p := newProvider(t, forge)
+				result := newConformanceResult(violations)
+
+				err := p.CreateReport(ctx, sha, result, types.SeverityThresholds{}, nil)
+				if errors.Is(err, ErrNotImplemented) {
+					t.Skip("reports are not supported")
+				}
+				assert.NoError(t, err)
+
+				reports := forge.Reports(sha)
+				if !assert.Len(t, reports, 1) {
+					return
+				}
+				assert.Equal(t, violations == 0, reports[0].Passed)
+
+				lines := make(map[int]bool)
+				for _, annotation := range reports[0].Annotations {
+					lines[annotation.Line] = true
+				}
+				assert.Len(t, reports[0].Annotations, violations)
+				assert.Len(t, lines, violations, "every violation should be annotated once")
+			})
+		}
+
+		// warn-only violations, violations below the thresholds and within the owners max do not fail the report
+		for name, test := range map[string]struct {
+			mode       string
+			thresholds types.SeverityThresholds
+			owners     map[string]int
+			passed     bool
+			warning    bool
+		}{
+			"enforced":          {mode: types.ModeEnforce},
+			"warn-only":         {mode: types.ModeWarnOnly, passed: true, warning: true},
+			"below fail-on":     {mode: types.ModeEnforce, thresholds: types.SeverityThresholds{FailOn: "critical"}, passed: true, warning: true},
+			"reaching fail-on":  {mode: types.ModeEnforce, thresholds: types.SeverityThresholds{FailOn: "high"}},
+			"below category":    {mode: types.ModeEnforce, thresholds: types.SeverityThresholds{Categories: map[string]string{"": "critical"}}, passed: true, warning: true},
+			"warn-only fail-on": {mode: types.ModeWarnOnly, thresholds: types.SeverityThresholds{FailOn: "low"}, passed: true, warning: true},
+			"within owner max":  {mode: types.ModeEnforce, owners: map[string]int{"@weaveworks/apps": 2}, passed: true},
+			"above owner max":   {mode: types.ModeEnforce, owners: map[string]int{"@weaveworks/apps": 1}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				forge, sha := newConformanceForge()
+				p := newProvider(t, forge)
+				result := newConformanceResult(2)
+				for i := range result.Violations {
+					result.Violations[i].Policy.Mode = test.mode
+					result.Violations[i].Owners = []string{"@weaveworks/apps"}
+				}
+
+				err := p.CreateReport(ctx, sha, result, test.thresholds, test.owners)
+				if errors.Is(err, ErrNotImplemented) {
+					t.Skip("reports are not supported")
+				}
+				assert.NoError(t, err)
+
+				reports := forge.Reports(sha)
+				if !assert.Len(t, reports, 1) {
+					return
+				}
+				assert.Equal(t, test.passed, reports[0].Passed)
+				for _, annotation := range reports[0].Annotations {
+					assert.Equal(t, test.warning, annotation.Warning)
+				}
+			})
+		}
+	})
+
+	t.Run("upsert comment", func(t *testing.T) {
+		forge, _ := newConformanceForge()
+		p := newProvider(t, forge)
+		forge.Commit("feature", "update", map[string]string{"README.md": "updated"})
+		_, err := p.CreatePullRequest(ctx, "feature", conformanceBase, "title", "description", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		number := forge.PullRequests()[0].ID
+
+		// comments of other users quoting the marker are not updated
+		_, err = forge.AddComment(number, "alice", commentMarker+"\nquoted")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NoError(t, p.UpsertComment(ctx, number, commentMarker, commentMarker+"\nfirst"))
+		assert.NoError(t, p.UpsertComment(ctx, number, commentMarker, commentMarker+"\nsecond"))
+
+		comments := forge.Comments(number)
+		if assert.Len(t, comments, 2) {
+			assert.Equal(t, commentMarker+"\nquoted", comments[0].Body)
+			assert.Equal(t, gittest.BotUser, comments[1].Author)
+			assert.Equal(t, commentMarker+"\nsecond", comments[1].Body)
+		}
+	})
+}
+
+func newConformanceForge() (*gittest.Forge, string) {
+	forge := gittest.NewForge("weaveworks", "policies")
+	sha := forge.Commit(conformanceBase, "initial commit", map[string]string{
+		"README.md":          "# policies",
+		"deploy/app.yaml":    conformanceApp,
+		"deploy/db/db.yaml":  conformanceDB,
+		"deploy/ignore.yaml": conformanceApp,
+	})
+	return forge, sha
+}
+
+func newConformanceFiles(t *testing.T) []*types.File {
+	var files []*types.File
+	for path, content := range map[string]string{
+		"deploy/app.yaml":   conformanceApp,
+		"deploy/db/db.yaml": conformanceDB,
+	} {
+		nodes, err := yaml.StringParse(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj := types.NewObject(nodes[0])
+		if err := obj.SetField("spec.replicas", 2); err != nil {
+			t.Fatal(err)
+		}
+		file := types.NewFile(path)
+		file.Resources[obj.ID()] = &types.Resource{Raw: obj, Remediated: true}
+		files = append(files, file)
+	}
+	return files
+}
+
+func newConformanceResult(violations int) types.Result {
+	result := types.Result{
+		Scanned:        violations + 1,
+		ViolationCount: violations,
+	}
+	for i := 0; i < violations; i++ {
+		result.Violations = append(result.Violations, types.Violation{
+			ID:      fmt.Sprintf("violation-%d", i),
+			Message: fmt.Sprintf("violation %d", i),
+			Policy: types.Policy{
+				ID:       "weave.policies.containers-minimum-replica-count",
+				Name:     "Containers Minimum Replica Count",
+				Severity: "high",
+			},
+			Location: types.Location{
+				Path:      "deploy/app.yaml",
+				StartLine: i + 1,
+				EndLine:   i + 1,
+			},
+		})
+	}
+	return result
+}
+
+func TestPullRequestReviewers(t *testing.T) {
+	reviewers := []string{"@alice", "@" + gittest.GithubAuthor, "@weaveworks/platform", "@unknown", "dev@weave.works"}
+	tests := []struct {
+		name      string
+		handler   func(forge *gittest.Forge) http.Handler
+		provider  func(t *testing.T, forge *gittest.Forge, url string, httpClient *http.Client) Provider
+		requested []string
+	}{
+		{
+			name:    Github,
+			handler: gittest.NewGithubHandler,
+			provider: func(t *testing.T, forge *gittest.Forge, url string, httpClient *http.Client) Provider {
+				p, err := newGithubProvider(forge.Owner, forge.Repo, "token", url, GithubAppConfig{}, httpClient)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p
+			},
+			requested: []string{"@alice", "@unknown", "@weaveworks/platform"},
+		},
+		{
+			name:    Gitlab,
+			handler: gittest.NewGitlabHandler,
+			provider: func(t *testing.T, forge *gittest.Forge, url string, httpClient *http.Client) Provider {
+				p, err := newGitlabProvider(forge.Owner, forge.Repo, "token", url, httpClient)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p
+			},
+			requested: []string{"@alice"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forge, sha := newConformanceForge()
+			server, httpClient := newConformanceServer(t, test.handler(forge))
+			repo := &GitRepository{provider: test.provider(t, forge, server.URL, httpClient)}
+
+			_, _, err := repo.OpenPullRequest(context.Background(), conformanceBase, sha, newConformanceFiles(t), reviewers)
+			if !assert.NoError(t, err) {
+				return
+			}
+			pulls := forge.PullRequests()
+			if assert.Len(t, pulls, 1) {
+				assert.Equal(t, test.requested, pulls[0].Reviewers)
+			}
+		})
+	}
+}
+
+func TestPullRequestReviewersFailure(t *testing.T) {
+	forge, sha := newConformanceForge()
+	server, httpClient := newConformanceServer(t, gittest.NewGithubHandler(forge))
+	p, err := newGithubProvider(forge.Owner, forge.Repo, "token", server.URL, GithubAppConfig{}, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &GitRepository{provider: p}
+
+	url, _, err := repo.OpenPullRequest(context.Background(), conformanceBase, sha, newConformanceFiles(t), []string{"@" + gittest.GithubOutsider})
+	if !assert.NoError(t, err, "failing to request reviews should not fail the created pull request") {
+		return
+	}
+	assert.NotNil(t, url)
+	if pulls := forge.PullRequests(); assert.Len(t, pulls, 1) {
+		assert.Empty(t, pulls[0].Reviewers)
+	}
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -15,68 +16,125 @@ const (
 	Bitbucket        string = "bitbucket"
 	AzureDevops      string = "azure-devops"
 	branchPrefix     string = "weave-fix-"
+	commentMarker    string = "<!-- weave-policy-validator:summary -->"
 )
 
+// ErrNotImplemented is returned by providers not supporting an operation
+var ErrNotImplemented = errors.New("not implemented")
+
 type Provider interface {
 	CreateBranch(ctx context.Context, name string, sha string) error
-	CreateCommit(ctx context.Context, branch, message string, files []*types.File) error
-	CreatePullRequest(ctx context.Context, source, target, title, description string) (*string, error)
-	CreateReport(ctx context.Context, sha string, result types.Result) error
+	CreateCommit(ctx context.Context, branch, message string, files []*types.File) (*types.CommitSignature, error)
+	CreatePullRequest(ctx context.Context, source, target, title, description string, reviewers []string) (*string, error)
+	CreateReport(ctx context.Context, sha string, result types.Result, thresholds types.SeverityThresholds, ownerMaxViolations map[string]int) error
+	CreateReview(ctx context.Context, number int, sha string, result types.Result) error
+	UpsertComment(ctx context.Context, number int, marker, body string) error
+}
+
+// Config holds git repository provider configuration
+type Config struct {
+	Provider     string
+	Host         string
+	URL          string
+	Token        string
+	AzureProject string
+	GithubApp    GithubAppConfig
+	HTTP         HTTPConfig
+	Signing      SigningConfig
+	// Dir is the local repository signed commits are created in when the provider api does not
+	// accept commit signatures
+	Dir string
 }
 
 type GitRepository struct {
 	provider Provider
 	url      string
 	token    string
+	// local creates the signed commits of providers not supporting them
+	local *localCommitter
 }
 
 // NewGitRepository get new repository struct
-func NewGitRepository(provider, host, url, token, project string) (*GitRepository, error) {
-	owner, repo, err := parseRepoSlug(url)
+func NewGitRepository(conf Config) (*GitRepository, error) {
+	owner, repo, err := parseRepoSlug(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.GithubApp.Enabled() && conf.Provider != Github && conf.Provider != GithubEnterprise {
+		return nil, fmt.Errorf("github app authentication is not supported by provider: %s", conf.Provider)
+	}
+
+	httpClient, err := NewHTTPClient(conf.HTTP)
 	if err != nil {
 		return nil, err
 	}
 
 	var p Provider
-	switch provider {
-	case Github, GithubEnterprise:
-		p, err = newGithubProvider(owner, provider, host, repo, token)
+	switch conf.Provider {
+	case Github:
+		p, err = newGithubProvider(owner, repo, conf.Token, "", conf.GithubApp, httpClient)
+	case GithubEnterprise:
+		p, err = newGithubProvider(owner, repo, conf.Token, fmt.Sprintf("https://%s", conf.Host), conf.GithubApp, httpClient)
 	case Gitlab:
-		p, err = newGitlabProvider(owner, repo, token)
+		p, err = newGitlabProvider(owner, repo, conf.Token, "", httpClient)
 	case Bitbucket:
-		p, err = newBitbucketProvider(owner, repo, token)
+		p, err = newBitbucketProvider(owner, repo, conf.Token, "", httpClient)
 	case AzureDevops:
-		organizationUrl, repo, parseErr := parseAzureRepoSlug(url)
+		organizationUrl, repo, parseErr := parseAzureRepoSlug(conf.URL)
 		if parseErr != nil {
 			return nil, parseErr
 		}
-		p, err = newAzureGitopsProvider(organizationUrl, project, repo, token)
+		p, err = newAzureGitopsProvider(organizationUrl, conf.AzureProject, repo, conf.Token, conf.HTTP)
 	default:
-		return nil, fmt.Errorf("unsupported provider: %s", provider)
+		return nil, fmt.Errorf("unsupported provider: %s", conf.Provider)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to init provider: %s, error: %v", provider, err)
+		return nil, fmt.Errorf("failed to init provider: %s, error: %v", conf.Provider, err)
 	}
-	return &GitRepository{
+
+	repository := &GitRepository{
 		provider: p,
-		url:      url,
-		token:    token,
-	}, nil
+		url:      conf.URL,
+		token:    conf.Token,
+	}
+	if conf.Signing.Enabled() {
+		signer, err := NewSigner(conf.Signing)
+		if err != nil {
+			return nil, err
+		}
+		author := CommitAuthor{Name: conf.Signing.AuthorName, Email: conf.Signing.AuthorEmail}
+		if gh, ok := p.(*GithubProvider); ok {
+			gh.signer, gh.author = signer, author
+		} else {
+			if conf.Dir == "" {
+				return nil, fmt.Errorf("signed commits of provider: %s require the local repository", conf.Provider)
+			}
+			repository.local = newLocalCommitter(conf.Dir, conf.URL, conf.Provider, conf.Token, signer, author)
+		}
+	}
+	return repository, nil
 }
 
-// OpenPullRequest opens pull request and return its url
-func (r *GitRepository) OpenPullRequest(ctx context.Context, base, sha string, files []*types.File) (*string, error) {
+// OpenPullRequest opens pull request requesting the reviews of the reviewers and return its url and the
+// signature status of its commit
+func (r *GitRepository) OpenPullRequest(ctx context.Context, base, sha string, files []*types.File, reviewers []string) (*string, *types.CommitSignature, error) {
 	source := branchPrefix + base
 	err := r.provider.CreateBranch(ctx, source, sha)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	commitMessage := fmt.Sprintf("fix iac violations of commit %s", sha[:7])
-	err = r.provider.CreateCommit(ctx, source, commitMessage, files)
+	var signature *types.CommitSignature
+	if r.local != nil {
+		signature, err = r.local.CreateCommit(ctx, source, commitMessage, files)
+	} else {
+		signature, err = r.provider.CreateCommit(ctx, source, commitMessage, files)
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var remediatedResources int
@@ -90,17 +148,33 @@ func (r *GitRepository) OpenPullRequest(ctx context.Context, base, sha string, f
 
 	title := fmt.Sprintf("Weave - Remediate violating resources of branch (%s)", base)
 	description := fmt.Sprintf("This PR remediates %d violating resource(s) in %d file(s)", remediatedResources, len(files))
-	pull, err := r.provider.CreatePullRequest(ctx, source, base, title, description)
+	pull, err := r.provider.CreatePullRequest(ctx, source, base, title, description, reviewers)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return pull, nil
+	return pull, signature, nil
+}
+
+// CreateReport executes the provider's CreateReport, the report fails if violations reach the thresholds
+// and exceed the max violations of their owners
+func (r *GitRepository) CreateReport(ctx context.Context, sha string, result types.Result, thresholds types.SeverityThresholds, ownerMaxViolations map[string]int) error {
+	return r.provider.CreateReport(ctx, sha, result, thresholds, ownerMaxViolations)
+}
+
+// CreateReview executes the provider's CreateReview
+func (r *GitRepository) CreateReview(ctx context.Context, number int, sha string, result types.Result) error {
+	return r.provider.CreateReview(ctx, number, sha, result)
 }
 
-// CreateReport executes the provider's CreateReport
-func (r *GitRepository) CreateReport(ctx context.Context, sha string, result types.Result) error {
-	return r.provider.CreateReport(ctx, sha, result)
+// UpsertSummaryComment creates or updates the pull request comment with the result summary
+func (r *GitRepository) UpsertSummaryComment(ctx context.Context, number int, result types.Result) error {
+	body := strings.Join([]string{
+		commentMarker,
+		result.MarkdowSummary(),
+		result.MarkdownDetails(),
+	}, "\n")
+	return r.provider.UpsertComment(ctx, number, commentMarker, body)
 }
 
 // IsRemediationBranch checks if the given branch name is a remediation branch
@@ -3,6 +3,10 @@ package git
 import (
 	"context"
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/v41/github"
 	"github.com/weaveworks/weave-policy-validator/internal/types"
@@ -17,25 +21,41 @@ var (
 	githubCheckRunConclusionSuccess            = "success"
 	githubCheckRunConclusionFailure            = "failure"
 	githubCheckRunAnnotationLevel              = "failure"
+	githubCheckRunWarningAnnotationLevel       = "warning"
 	githubCheckRunMaxAnnotationsPerRequest int = 50
 	githubReportTitle                          = "Weave Result Report"
+	githubBotUserType                          = "Bot"
 )
 
 type GithubProvider struct {
 	client *github.Client
 	owner  string
 	repo   string
+	// signer signs the commits of author, otherwise commits are authored by the authenticated user
+	signer Signer
+	author CommitAuthor
 }
 
-func newGithubProvider(owner, provider, host, repo, token string) (*GithubProvider, error) {
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(context.Background(), ts)
+// newGithubProvider creates github provider, the enterprise api is used when baseURL is set
+func newGithubProvider(owner, repo, token, baseURL string, app GithubAppConfig, httpClient *http.Client) (*GithubProvider, error) {
+	var ts oauth2.TokenSource
+	if app.Enabled() {
+		var err error
+		ts, err = newGithubAppTokenSource(context.Background(), app, baseURL, owner, repo, httpClient)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+	tc := oauth2.NewClient(ctx, ts)
 	var client *github.Client
 
-	if provider == GithubEnterprise {
-		gheURL := fmt.Sprintf("https://%s", host)
+	if baseURL != "" {
 		var err error
-		client, err = github.NewEnterpriseClient(gheURL, gheURL, tc)
+		client, err = github.NewEnterpriseClient(baseURL, baseURL, tc)
 
 		if err != nil {
 			return nil, err
@@ -74,13 +94,14 @@ func (gh *GithubProvider) CreateBranch(ctx context.Context, branch string, sha s
 	return nil
 }
 
-// CreateCommit creates new commit
-func (gh *GithubProvider) CreateCommit(ctx context.Context, branch, message string, files []*types.File) error {
+// CreateCommit creates new commit signed by the configured signer, commits of github apps are signed by
+// github when no signer is configured
+func (gh *GithubProvider) CreateCommit(ctx context.Context, branch, message string, files []*types.File) (*types.CommitSignature, error) {
 	entries := make([]*github.TreeEntry, 0)
 	for _, file := range files {
 		content, err := file.Content()
 		if err != nil {
-			return fmt.Errorf("failed to get file content, file: %s, error: %v", file.Path, err)
+			return nil, fmt.Errorf("failed to get file content, file: %s, error: %v", file.Path, err)
 		}
 		entries = append(entries, &github.TreeEntry{
 			Path:    &file.Path,
@@ -92,13 +113,13 @@ func (gh *GithubProvider) CreateCommit(ctx context.Context, branch, message stri
 
 	branchOBJ, _, err := gh.client.Repositories.GetBranch(ctx, gh.owner, gh.repo, branch, false)
 	if err != nil {
-		return fmt.Errorf("failed to get branch: %s, error: %v", branch, err)
+		return nil, fmt.Errorf("failed to get branch: %s, error: %v", branch, err)
 	}
 
 	lastTree := branchOBJ.GetCommit().Commit.GetTree()
 	tree, _, err := gh.client.Git.CreateTree(ctx, gh.owner, gh.repo, *lastTree.SHA, entries)
 	if err != nil {
-		return fmt.Errorf("failed to create tree, error: %v", err)
+		return nil, fmt.Errorf("failed to create tree, error: %v", err)
 	}
 
 	commit := &github.Commit{
@@ -111,9 +132,15 @@ func (gh *GithubProvider) CreateCommit(ctx context.Context, branch, message stri
 		},
 	}
 
+	if gh.signer != nil {
+		if err := gh.signCommit(commit); err != nil {
+			return nil, err
+		}
+	}
+
 	newCommit, _, err := gh.client.Git.CreateCommit(ctx, gh.owner, gh.repo, commit)
 	if err != nil {
-		return fmt.Errorf("failed to create commit, error: %v", err)
+		return nil, fmt.Errorf("failed to create commit, error: %v", err)
 	}
 
 	branchRef := getRefName(branch)
@@ -125,17 +152,52 @@ func (gh *GithubProvider) CreateCommit(ctx context.Context, branch, message stri
 	}
 
 	if _, _, err := gh.client.Git.UpdateRef(ctx, gh.owner, gh.repo, ref, true); err != nil {
-		return fmt.Errorf("failed to update branch with the new commit, error: %v", err)
+		return nil, fmt.Errorf("failed to update branch with the new commit, error: %v", err)
 	}
 
+	return githubCommitSignature(newCommit.GetVerification()), nil
+}
+
+// signCommit sets the commit author and signature, the author date is part of the signed payload
+func (gh *GithubProvider) signCommit(commit *github.Commit) error {
+	author := gh.author
+	author.Date = time.Now().UTC().Truncate(time.Second)
+	commit.Author = &github.CommitAuthor{
+		Name:  &author.Name,
+		Email: &author.Email,
+		Date:  &author.Date,
+	}
+	commit.Committer = commit.Author
+
+	parents := make([]string, len(commit.Parents))
+	for i := range commit.Parents {
+		parents[i] = commit.Parents[i].GetSHA()
+	}
+	payload := commitPayload(commit.GetTree().GetSHA(), parents, author, commit.GetMessage())
+	signature, err := gh.signer.Sign([]byte(payload))
+	if err != nil {
+		return err
+	}
+	commit.Verification = &github.SignatureVerification{Signature: &signature}
 	return nil
 }
 
-// CreatePullRequest creates new pull request
-func (gh *GithubProvider) CreatePullRequest(ctx context.Context, source, target, title, description string) (*string, error) {
+func githubCommitSignature(verification *github.SignatureVerification) *types.CommitSignature {
+	if verification == nil {
+		return nil
+	}
+	return &types.CommitSignature{
+		Signed:   verification.GetSignature() != "",
+		Verified: verification.GetVerified(),
+		Reason:   verification.GetReason(),
+	}
+}
+
+// CreatePullRequest creates new pull request and requests the reviews of the reviewers
+func (gh *GithubProvider) CreatePullRequest(ctx context.Context, source, target, title, description string, reviewers []string) (*string, error) {
 	listOpts := &github.PullRequestListOptions{
 		Base: target,
-		Head: source,
+		Head: fmt.Sprintf("%s:%s", gh.owner, source),
 	}
 
 	pulls, _, err := gh.client.PullRequests.List(ctx, gh.owner, gh.repo, listOpts)
@@ -159,14 +221,43 @@ func (gh *GithubProvider) CreatePullRequest(ctx context.Context, source, target,
 		return nil, fmt.Errorf("failed to create pull request, error: %v", err)
 	}
 
+	reviewersRequest := githubReviewersRequest(reviewers, pull.GetUser().GetLogin())
+	if len(reviewersRequest.Reviewers) > 0 || len(reviewersRequest.TeamReviewers) > 0 {
+		// reviewers may not be requested, e.g. owners who are not collaborators, which should not fail
+		// the already created pull request
+		_, _, err = gh.client.PullRequests.RequestReviewers(ctx, gh.owner, gh.repo, pull.GetNumber(), reviewersRequest)
+		if err != nil {
+			log.Printf("failed to request pull request reviewers, error: %v", err)
+		}
+	}
+
 	return pull.HTMLURL, nil
 }
 
-// CreateReport creates github checkrun
-func (gh *GithubProvider) CreateReport(ctx context.Context, sha string, result types.Result) error {
+// githubReviewersRequest converts the codeowners to github users and teams, email owners and the pull
+// request author can not be requested
+func githubReviewersRequest(reviewers []string, author string) github.ReviewersRequest {
+	request := github.ReviewersRequest{}
+	for _, reviewer := range reviewers {
+		if !strings.HasPrefix(reviewer, "@") {
+			continue
+		}
+		name := strings.TrimPrefix(reviewer, "@")
+		if _, team, ok := strings.Cut(name, "/"); ok {
+			request.TeamReviewers = append(request.TeamReviewers, team)
+		} else if !strings.EqualFold(name, author) {
+			request.Reviewers = append(request.Reviewers, name)
+		}
+	}
+	return request
+}
+
+// CreateReport creates github checkrun, the checkrun fails if violations reach the thresholds and exceed
+// the max violations of their owners
+func (gh *GithubProvider) CreateReport(ctx context.Context, sha string, result types.Result, thresholds types.SeverityThresholds, ownerMaxViolations map[string]int) error {
 	var conclusion string
 
-	if result.ViolationCount == 0 {
+	if !result.Fails(thresholds, ownerMaxViolations) {
 		conclusion = githubCheckRunConclusionSuccess
 	} else {
 		conclusion = githubCheckRunConclusionFailure
@@ -187,13 +278,17 @@ func (gh *GithubProvider) CreateReport(ctx context.Context, sha string, result t
 	annotations := []*github.CheckRunAnnotation{}
 	for i := range result.Violations {
 		violation := result.Violations[i]
+		level := &githubCheckRunAnnotationLevel
+		if !thresholds.Fails(violation) {
+			level = &githubCheckRunWarningAnnotationLevel
+		}
 		annotations = append(annotations, &github.CheckRunAnnotation{
 			Path:            &violation.Location.Path,
 			StartLine:       &violation.Location.StartLine,
 			EndLine:         &violation.Location.EndLine,
 			Title:           &violation.Policy.Name,
 			Message:         &violation.Message,
-			AnnotationLevel: &githubCheckRunAnnotationLevel,
+			AnnotationLevel: level,
 		})
 	}
 
@@ -217,7 +312,7 @@ func (gh *GithubProvider) CreateReport(ctx context.Context, sha string, result t
 				Output: &github.CheckRunOutput{
 					Title:       checkrun.Output.Title,
 					Summary:     checkrun.Output.Summary,
-					Annotations: annotations[i : i+annotationLimit],
+					Annotations: annotations[i:annotationLimit],
 				},
 			}
 			_, _, err := gh.client.Checks.UpdateCheckRun(ctx, gh.owner, gh.repo, *checkrun.ID, options)
@@ -228,3 +323,52 @@ func (gh *GithubProvider) CreateReport(ctx context.Context, sha string, result t
 	}
 	return nil
 }
+
+// UpsertComment updates the pull request comment of the authenticated user containing the marker or
+// creates a new one
+func (gh *GithubProvider) UpsertComment(ctx context.Context, number int, marker, body string) error {
+	// app installation and actions tokens can not get their user, their comments are authored by bots
+	var login string
+	if user, _, err := gh.client.Users.Get(ctx, ""); err == nil {
+		login = user.GetLogin()
+	}
+
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, resp, err := gh.client.Issues.ListComments(ctx, gh.owner, gh.repo, number, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list pull request comments, error: %v", err)
+		}
+		for _, comment := range comments {
+			if !strings.Contains(comment.GetBody(), marker) || !githubCommentAuthor(comment, login) {
+				continue
+			}
+			_, _, err := gh.client.Issues.EditComment(ctx, gh.owner, gh.repo, comment.GetID(), &github.IssueComment{Body: &body})
+			if err != nil {
+				return fmt.Errorf("failed to update pull request comment, error: %v", err)
+			}
+			return nil
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	_, _, err := gh.client.Issues.CreateComment(ctx, gh.owner, gh.repo, number, &github.IssueComment{Body: &body})
+	if err != nil {
+		return fmt.Errorf("failed to create pull request comment, error: %v", err)
+	}
+	return nil
+}
+
+// githubCommentAuthor checks whether the comment is authored by the user of the login, or by a bot if
+// the login is unknown
+func githubCommentAuthor(comment *github.IssueComment, login string) bool {
+	if login == "" {
+		return comment.GetUser().GetType() == githubBotUserType
+	}
+	return strings.EqualFold(comment.GetUser().GetLogin(), login)
+}
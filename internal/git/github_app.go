@@ -0,0 +1,197 @@
+package git
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// github rejects app jwts that expire more than 10 minutes in the future
+	githubAppJWTExpiry = 9 * time.Minute
+	// issue the jwt in the past to allow for clock drift
+	githubAppJWTClockDrift = 60 * time.Second
+)
+
+// GithubAppConfig holds the credentials used to authenticate as a github app
+type GithubAppConfig struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKeyFile string
+}
+
+// Enabled checks if github app authentication is configured
+func (c GithubAppConfig) Enabled() bool {
+	return c.AppID != 0
+}
+
+// Validate checks that the github app config is complete
+func (c GithubAppConfig) Validate() error {
+	if c.AppID == 0 {
+		return errors.New("missing github-app-id value")
+	}
+	if c.PrivateKeyFile == "" {
+		return errors.New("missing github-app-private-key-file value")
+	}
+	return nil
+}
+
+type githubAppTokenSource struct {
+	ctx            context.Context
+	client         *github.Client
+	installationID int64
+}
+
+// newGithubAppTokenSource returns a token source that mints installation tokens for the given repository,
+// tokens are cached and refreshed once they expire
+func newGithubAppTokenSource(ctx context.Context, conf GithubAppConfig, baseURL, owner, repo string, base *http.Client) (oauth2.TokenSource, error) {
+	key, err := readRSAPrivateKey(conf.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{
+		Transport: &githubAppTransport{
+			appID: conf.AppID,
+			key:   key,
+			base:  base.Transport,
+		},
+	}
+
+	var client *github.Client
+	if baseURL != "" {
+		client, err = github.NewEnterpriseClient(baseURL, baseURL, httpClient)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		client = github.NewClient(httpClient)
+	}
+
+	installationID := conf.InstallationID
+	if installationID == 0 {
+		installation, _, err := client.Apps.FindRepositoryInstallation(ctx, owner, repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find github app installation of repository %s/%s, error: %v", owner, repo, err)
+		}
+		installationID = installation.GetID()
+	}
+
+	ts := &githubAppTokenSource{
+		ctx:            ctx,
+		client:         client,
+		installationID: installationID,
+	}
+	return oauth2.ReuseTokenSource(nil, ts), nil
+}
+
+// Token mints a new installation token
+func (ts *githubAppTokenSource) Token() (*oauth2.Token, error) {
+	token, _, err := ts.client.Apps.CreateInstallationToken(ts.ctx, ts.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create github app installation token, error: %v", err)
+	}
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt(),
+	}, nil
+}
+
+// githubAppTransport authenticates requests as the github app itself using a signed jwt
+type githubAppTransport struct {
+	appID int64
+	key   *rsa.PrivateKey
+	base  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *githubAppTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := signGithubAppJWT(t.appID, t.key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+func signGithubAppJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-githubAppJWTClockDrift).Unix(),
+		"exp": now.Add(githubAppJWTExpiry).Unix(),
+		"iss": fmt.Sprint(appID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString(header),
+		base64.RawURLEncoding.EncodeToString(claims),
+	}, ".")
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign github app jwt, error: %v", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func readRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read github app private key, error: %v", err)
+	}
+
+	block, _ := pem.Decode(in)
+	if block == nil {
+		return nil, fmt.Errorf("invalid github app private key, file: %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid github app private key, file: %s, error: %v", path, err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("github app private key is not an rsa key, file: %s", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,101 @@
+package git
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestPrivateKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "app.pem")
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key, path
+}
+
+func TestSignGithubAppJWT(t *testing.T) {
+	key, _ := writeTestPrivateKey(t)
+	now := time.Now()
+
+	token, err := signGithubAppJWT(123, key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	assert.Len(t, parts, 3)
+
+	in, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(in, &claims); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "123", claims["iss"])
+	assert.Equal(t, float64(now.Add(githubAppJWTExpiry).Unix()), claims["exp"])
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+}
+
+func TestGithubAppTokenSource(t *testing.T) {
+	_, path := writeTestPrivateKey(t)
+
+	var minted int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/owner/repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "))
+		fmt.Fprint(w, `{"id": 42}`)
+	})
+	mux.HandleFunc("/api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		minted++
+		expiry := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		fmt.Fprintf(w, `{"token": "installation-token-%d", "expires_at": "%s"}`, minted, expiry)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	conf := GithubAppConfig{AppID: 1, PrivateKeyFile: path}
+	ts, err := newGithubAppTokenSource(context.Background(), conf, server.URL, "owner", "repo", http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		token, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "installation-token-1", token.AccessToken)
+	}
+	assert.Equal(t, 1, minted, "token should be reused until it expires")
+}
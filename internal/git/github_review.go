@@ -0,0 +1,154 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/weaveworks/weave-policy-validator/internal/markdown"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+var (
+	githubReviewEventComment = "COMMENT"
+	githubReviewSideRight    = "RIGHT"
+	hunkHeaderRegex          = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+)
+
+// CreateReview creates pull request review, remediable violations are commented with suggested changes.
+// The review is created on the pull request head commit, the given sha may be the merge commit of
+// the pull request, e.g. github actions GITHUB_SHA of pull_request events
+func (gh *GithubProvider) CreateReview(ctx context.Context, number int, sha string, result types.Result) error {
+	pull, _, err := gh.client.PullRequests.Get(ctx, gh.owner, gh.repo, number)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request, error: %v", err)
+	}
+	if head := pull.GetHead().GetSHA(); head != "" {
+		sha = head
+	}
+
+	files, err := gh.listPullRequestFiles(ctx, number)
+	if err != nil {
+		return err
+	}
+
+	var comments []*github.DraftReviewComment
+	var outsideDiff []types.Violation
+	for i := range result.Violations {
+		violation := result.Violations[i]
+
+		path, lines := matchPullRequestFile(files, violation.Location.Path)
+		startLine, endLine := violation.Location.StartLine, violation.Location.EndLine
+		if violation.Details.Suggestion != nil {
+			startLine, endLine = violation.Details.Suggestion.StartLine, violation.Details.Suggestion.EndLine
+		}
+
+		if path == "" || !lines[startLine] || !lines[endLine] {
+			outsideDiff = append(outsideDiff, violation)
+			continue
+		}
+
+		body := reviewCommentBody(violation)
+		comment := &github.DraftReviewComment{
+			Path: &path,
+			Body: &body,
+			Side: &githubReviewSideRight,
+			Line: &endLine,
+		}
+		if startLine != endLine {
+			comment.StartLine = &startLine
+			comment.StartSide = &githubReviewSideRight
+		}
+		comments = append(comments, comment)
+	}
+
+	body := reviewBody(result, outsideDiff)
+	review := &github.PullRequestReviewRequest{
+		CommitID: &sha,
+		Body:     &body,
+		Event:    &githubReviewEventComment,
+		Comments: comments,
+	}
+
+	_, _, err = gh.client.PullRequests.CreateReview(ctx, gh.owner, gh.repo, number, review)
+	if err != nil {
+		return fmt.Errorf("failed to create pull request review, error: %v", err)
+	}
+	return nil
+}
+
+// listPullRequestFiles returns pull request files mapped to the lines that can be commented on
+func (gh *GithubProvider) listPullRequestFiles(ctx context.Context, number int) (map[string]map[int]bool, error) {
+	files := make(map[string]map[int]bool)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := gh.client.PullRequests.ListFiles(ctx, gh.owner, gh.repo, number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull request files, error: %v", err)
+		}
+		for _, file := range page {
+			files[file.GetFilename()] = parsePatchLines(file.GetPatch())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return files, nil
+}
+
+// matchPullRequestFile finds the pull request file of the given violation path, the path is relative
+// to the repository root like the pull request file names
+func matchPullRequestFile(files map[string]map[int]bool, path string) (string, map[int]bool) {
+	path = filepath.ToSlash(path)
+	if lines, ok := files[path]; ok {
+		return path, lines
+	}
+	return "", nil
+}
+
+// parsePatchLines returns the lines of the new file version covered by the patch hunks
+func parsePatchLines(patch string) map[int]bool {
+	lines := make(map[int]bool)
+	var current int
+	for _, line := range strings.Split(patch, "\n") {
+		if groups := hunkHeaderRegex.FindStringSubmatch(line); groups != nil {
+			current, _ = strconv.Atoi(groups[1])
+			continue
+		}
+		if current == 0 || line == "" || strings.HasPrefix(line, "-") || strings.HasPrefix(line, `\`) {
+			continue
+		}
+		lines[current] = true
+		current++
+	}
+	return lines
+}
+
+func reviewCommentBody(violation types.Violation) string {
+	md := markdown.New()
+	md.Paragraph("**%s** (%s)", violation.Policy.Name, violation.Policy.Severity)
+	md.Paragraph("%s", violation.Message)
+	if violation.Details.Suggestion != nil {
+		md.Code("suggestion", strings.Join(violation.Details.Suggestion.Lines, "\n"))
+	} else if violation.Policy.HowToSolve != "" {
+		md.Paragraph("%s", violation.Policy.HowToSolve)
+	}
+	return md.String()
+}
+
+func reviewBody(result types.Result, outsideDiff []types.Violation) string {
+	md := markdown.New()
+	md.Head3("Scanned %d resources, found %d violations", result.Scanned, result.ViolationCount)
+	if len(outsideDiff) > 0 {
+		md.Paragraph("The following violations are outside of the pull request changes:")
+		for _, violation := range outsideDiff {
+			md.ListItem("%s: %s (%s#%d)", violation.Policy.Name, violation.Message, violation.Location.Path, violation.Location.StartLine)
+		}
+	}
+	return md.String()
+}
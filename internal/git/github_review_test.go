@@ -0,0 +1,35 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePatchLines(t *testing.T) {
+	patch := "@@ -1,3 +1,4 @@\n apiVersion: apps/v1\n-kind: Pod\n+kind: Deployment\n+metadata:\n   name: frontend\n@@ -10 +11,2 @@ spec:\n+  replicas: 2\n   template:\n\\ No newline at end of file"
+
+	lines := parsePatchLines(patch)
+	assert.Equal(t, map[int]bool{1: true, 2: true, 3: true, 4: true, 11: true, 12: true}, lines)
+}
+
+func TestMatchPullRequestFile(t *testing.T) {
+	files := map[string]map[int]bool{
+		"app.yaml":        {1: true},
+		"deploy/app.yaml": {2: true},
+	}
+
+	// violation paths are relative to the repository root, files with the same name are not mixed up
+	for i := 0; i < 10; i++ {
+		path, lines := matchPullRequestFile(files, "deploy/app.yaml")
+		assert.Equal(t, "deploy/app.yaml", path)
+		assert.True(t, lines[2])
+	}
+
+	path, lines := matchPullRequestFile(files, "app.yaml")
+	assert.Equal(t, "app.yaml", path)
+	assert.True(t, lines[1])
+
+	path, _ = matchPullRequestFile(files, "other/deploy/app.yaml")
+	assert.Equal(t, "", path)
+}
@@ -2,8 +2,10 @@ package git
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
 
 	"github.com/weaveworks/weave-policy-validator/internal/types"
 	"github.com/xanzy/go-gitlab"
@@ -14,8 +16,13 @@ type GitlabProvider struct {
 	id     string
 }
 
-func newGitlabProvider(owenr, repo, token string) (*GitlabProvider, error) {
-	client, err := gitlab.NewClient(token)
+func newGitlabProvider(owenr, repo, token, baseURL string, httpClient *http.Client) (*GitlabProvider, error) {
+	// retries are handled by the shared http client
+	opts := []gitlab.ClientOptionFunc{gitlab.WithHTTPClient(httpClient), gitlab.WithoutRetries()}
+	if baseURL != "" {
+		opts = append(opts, gitlab.WithBaseURL(baseURL))
+	}
+	client, err := gitlab.NewClient(token, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init gitlab client, error: %v", err)
 	}
@@ -28,7 +35,7 @@ func newGitlabProvider(owenr, repo, token string) (*GitlabProvider, error) {
 
 // CreateBranch creates new branch from given commit SHA
 func (gl *GitlabProvider) CreateBranch(ctx context.Context, name string, sha string) error {
-	_, _, err := gl.client.Branches.GetBranch(gl.id, name)
+	_, _, err := gl.client.Branches.GetBranch(gl.id, name, gitlab.WithContext(ctx))
 	if err == nil {
 		return nil
 	}
@@ -38,7 +45,7 @@ func (gl *GitlabProvider) CreateBranch(ctx context.Context, name string, sha str
 		Ref:    &sha,
 	}
 
-	_, _, err = gl.client.Branches.CreateBranch(gl.id, opts)
+	_, _, err = gl.client.Branches.CreateBranch(gl.id, opts, gitlab.WithContext(ctx))
 	if err != nil {
 		return err
 	}
@@ -47,7 +54,7 @@ func (gl *GitlabProvider) CreateBranch(ctx context.Context, name string, sha str
 }
 
 // CreateCommit creates new commit
-func (gl *GitlabProvider) CreateCommit(ctx context.Context, branch, message string, files []*types.File) error {
+func (gl *GitlabProvider) CreateCommit(ctx context.Context, branch, message string, files []*types.File) (*types.CommitSignature, error) {
 	opts := &gitlab.CreateCommitOptions{
 		Branch:        &branch,
 		CommitMessage: &message,
@@ -58,7 +65,7 @@ func (gl *GitlabProvider) CreateCommit(ctx context.Context, branch, message stri
 	for _, file := range files {
 		content, err := file.Content()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		opts.Actions = append(opts.Actions, &gitlab.CommitActionOptions{
@@ -68,12 +75,12 @@ func (gl *GitlabProvider) CreateCommit(ctx context.Context, branch, message stri
 		})
 	}
 
-	_, _, err := gl.client.Commits.CreateCommit(gl.id, opts)
-	return err
+	_, _, err := gl.client.Commits.CreateCommit(gl.id, opts, gitlab.WithContext(ctx))
+	return nil, err
 }
 
-// CreatePullRequest creates new pull request
-func (gl *GitlabProvider) CreatePullRequest(ctx context.Context, source, target, title, description string) (*string, error) {
+// CreatePullRequest creates new pull request, the reviewers usernames are resolved to gitlab users
+func (gl *GitlabProvider) CreatePullRequest(ctx context.Context, source, target, title, description string, reviewers []string) (*string, error) {
 	state := "opened"
 	listOpts := &gitlab.ListProjectMergeRequestsOptions{
 		SourceBranch: &source,
@@ -81,7 +88,7 @@ func (gl *GitlabProvider) CreatePullRequest(ctx context.Context, source, target,
 		State:        &state,
 	}
 
-	pulls, _, err := gl.client.MergeRequests.ListProjectMergeRequests(gl.id, listOpts)
+	pulls, _, err := gl.client.MergeRequests.ListProjectMergeRequests(gl.id, listOpts, gitlab.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +104,15 @@ func (gl *GitlabProvider) CreatePullRequest(ctx context.Context, source, target,
 		TargetBranch: &target,
 	}
 
-	pull, _, err := gl.client.MergeRequests.CreateMergeRequest(gl.id, createOpts)
+	reviewerIDs, err := gl.reviewerIDs(ctx, reviewers)
+	if err != nil {
+		return nil, err
+	}
+	if len(reviewerIDs) > 0 {
+		createOpts.ReviewerIDs = &reviewerIDs
+	}
+
+	pull, _, err := gl.client.MergeRequests.CreateMergeRequest(gl.id, createOpts, gitlab.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -105,7 +120,79 @@ func (gl *GitlabProvider) CreatePullRequest(ctx context.Context, source, target,
 	return &pull.WebURL, err
 }
 
+// reviewerIDs returns the ids of the reviewers users, groups, emails and unknown users are logged and skipped
+func (gl *GitlabProvider) reviewerIDs(ctx context.Context, reviewers []string) ([]int, error) {
+	var ids []int
+	var skipped []string
+	for _, reviewer := range reviewers {
+		if !strings.HasPrefix(reviewer, "@") || strings.Contains(reviewer, "/") {
+			skipped = append(skipped, reviewer)
+			continue
+		}
+		username := strings.TrimPrefix(reviewer, "@")
+		users, _, err := gl.client.Users.ListUsers(&gitlab.ListUsersOptions{Username: &username}, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %s, error: %v", username, err)
+		}
+		if len(users) > 0 {
+			ids = append(ids, users[0].ID)
+		} else {
+			skipped = append(skipped, reviewer)
+		}
+	}
+	if len(skipped) > 0 {
+		log.Printf("skipped pull request reviewers: %s, only gitlab users are requested", strings.Join(skipped, ", "))
+	}
+	return ids, nil
+}
+
 // CreateReport not implemented
-func (gl *GitlabProvider) CreateReport(ctx context.Context, sha string, result types.Result) error {
-	return errors.New("not implemented")
+func (gl *GitlabProvider) CreateReport(ctx context.Context, sha string, result types.Result, thresholds types.SeverityThresholds, ownerMaxViolations map[string]int) error {
+	return ErrNotImplemented
+}
+
+// CreateReview not implemented
+func (gl *GitlabProvider) CreateReview(ctx context.Context, number int, sha string, result types.Result) error {
+	return ErrNotImplemented
+}
+
+// UpsertComment updates the merge request note of the authenticated user containing the marker or
+// creates a new one
+func (gl *GitlabProvider) UpsertComment(ctx context.Context, number int, marker, body string) error {
+	user, _, err := gl.client.Users.CurrentUser(gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to get current user, error: %v", err)
+	}
+
+	opts := &gitlab.ListMergeRequestNotesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+	}
+	for {
+		notes, resp, err := gl.client.Notes.ListMergeRequestNotes(gl.id, number, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to list merge request notes, error: %v", err)
+		}
+		for _, note := range notes {
+			if !strings.Contains(note.Body, marker) || note.Author.ID != user.ID {
+				continue
+			}
+			updateOpts := &gitlab.UpdateMergeRequestNoteOptions{Body: &body}
+			_, _, err := gl.client.Notes.UpdateMergeRequestNote(gl.id, number, note.ID, updateOpts, gitlab.WithContext(ctx))
+			if err != nil {
+				return fmt.Errorf("failed to update merge request note, error: %v", err)
+			}
+			return nil
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	createOpts := &gitlab.CreateMergeRequestNoteOptions{Body: &body}
+	_, _, err = gl.client.Notes.CreateMergeRequestNote(gl.id, number, createOpts, gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to create merge request note, error: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,300 @@
+package gittest
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const azureRefPrefix = "refs/heads/"
+
+// azureLocations are the api resource locations used by the git client, the client resolves the
+// request urls from the route templates returned by the location service
+var azureLocations = []struct {
+	id       string
+	area     string
+	resource string
+	template string
+}{
+	{"e81700f7-3be2-46de-8624-2eb35882fcaa", "Location", "ResourceAreas", "_apis/{resource}/{areaId}"},
+	{"00d9565f-ed9c-4a06-9a50-00e7896ccab4", "Location", "ConnectionData", "_apis/connectionData"},
+	{"d5b216de-d8d5-4d32-ae76-51df755b16d3", "git", "branchStats", "{project}/_apis/{area}/repositories/{repositoryId}/stats/branches"},
+	{"2d874a60-a811-4f62-9c9f-963a6ea0a55b", "git", "refs", "{project}/_apis/{area}/repositories/{repositoryId}/refs/{*filter}"},
+	{"ea98d07b-3c87-4971-8ede-a613694ffb55", "git", "pushes", "{project}/_apis/{area}/repositories/{repositoryId}/pushes/{pushId}"},
+	{"9946fd70-0d40-406e-b686-b4744cbbcc37", "git", "pullRequests", "{project}/_apis/{area}/repositories/{repositoryId}/pullRequests/{pullRequestId}"},
+	{"ab6e2e5d-a0b7-4153-b64a-a4efe0d49449", "git", "pullRequestThreads", "{project}/_apis/{area}/repositories/{repositoryId}/pullRequests/{pullRequestId}/threads/{threadId}"},
+	{"965a3ec7-5ed8-455a-bdcb-835a5ea7fe7b", "git", "pullRequestThreadComments", "{project}/_apis/{area}/repositories/{repositoryId}/pullRequests/{pullRequestId}/threads/{threadId}/comments/{commentId}"},
+}
+
+type azureServer struct {
+	forge *Forge
+}
+
+// NewAzureDevopsHandler returns handler serving the azure devops rest api of the forge repository,
+// the forge owner is used as the project name and the organization is served at the root path
+func NewAzureDevopsHandler(forge *Forge) http.Handler {
+	s := &azureServer{forge: forge}
+
+	prefix := fmt.Sprintf("/%s/_apis/git/repositories/%s", regexp.QuoteMeta(forge.Owner), regexp.QuoteMeta(forge.Repo))
+	rt := &router{}
+	rt.handle(http.MethodOptions, "/_apis/?", s.listLocations)
+	rt.handle(http.MethodGet, "/_apis/ResourceAreas/?", s.listResourceAreas)
+	rt.handle(http.MethodGet, "/_apis/connectionData", s.getConnectionData)
+	rt.handle(http.MethodGet, prefix+"/stats/branches", s.getBranch)
+	rt.handle(http.MethodPost, prefix+"/refs", s.updateRefs)
+	rt.handle(http.MethodPost, prefix+"/pushes", s.createPush)
+	rt.handle(http.MethodGet, prefix+"/pullRequests", s.listPullRequests)
+	rt.handle(http.MethodPost, prefix+"/pullRequests", s.createPullRequest)
+	rt.handle(http.MethodGet, prefix+"/pullRequests/([0-9]+)/threads", s.listThreads)
+	rt.handle(http.MethodPost, prefix+"/pullRequests/([0-9]+)/threads", s.createThread)
+	rt.handle(http.MethodPatch, prefix+"/pullRequests/([0-9]+)/threads/([0-9]+)/comments/([0-9]+)", s.updateComment)
+	return rt
+}
+
+func azureError(w http.ResponseWriter, err error) {
+	writeJSON(w, errorStatus(err), map[string]string{"message": err.Error()})
+}
+
+func azureCollection(w http.ResponseWriter, values []interface{}) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"count": len(values), "value": values})
+}
+
+func (s *azureServer) listLocations(w http.ResponseWriter, r *http.Request, params []string) {
+	var locations []interface{}
+	for _, location := range azureLocations {
+		locations = append(locations, map[string]interface{}{
+			"id":              location.id,
+			"area":            location.area,
+			"resourceName":    location.resource,
+			"routeTemplate":   location.template,
+			"resourceVersion": 1,
+			"minVersion":      "1.0",
+			"maxVersion":      "7.0",
+			"releasedVersion": "7.0",
+		})
+	}
+	azureCollection(w, locations)
+}
+
+// listResourceAreas responds with no resource areas like on premise servers do, so that all
+// clients use the organization url
+func (s *azureServer) listResourceAreas(w http.ResponseWriter, r *http.Request, params []string) {
+	azureCollection(w, []interface{}{})
+}
+
+// getConnectionData responds with the authenticated user of the connection
+func (s *azureServer) getConnectionData(w http.ResponseWriter, r *http.Request, params []string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"authenticatedUser": map[string]string{"id": userUUID(BotUser)},
+	})
+}
+
+func (s *azureServer) getBranch(w http.ResponseWriter, r *http.Request, params []string) {
+	name := r.URL.Query().Get("name")
+	commit, err := s.forge.getBranch(name)
+	if err != nil {
+		azureError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":   name,
+		"commit": map[string]string{"commitId": commit.SHA},
+	})
+}
+
+func (s *azureServer) updateRefs(w http.ResponseWriter, r *http.Request, params []string) {
+	var body []struct {
+		Name        string `json:"name"`
+		OldObjectID string `json:"oldObjectId"`
+		NewObjectID string `json:"newObjectId"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	var results []interface{}
+	for _, update := range body {
+		name := strings.TrimPrefix(update.Name, azureRefPrefix)
+		var err error
+		if strings.Trim(update.OldObjectID, "0") == "" {
+			err = s.forge.createBranch(name, update.NewObjectID)
+		} else {
+			err = s.forge.updateBranch(name, update.NewObjectID)
+		}
+		results = append(results, map[string]interface{}{
+			"name":        update.Name,
+			"newObjectId": update.NewObjectID,
+			"success":     err == nil,
+		})
+	}
+	azureCollection(w, results)
+}
+
+func (s *azureServer) createPush(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Commits []struct {
+			Comment string `json:"comment"`
+			Changes []struct {
+				ChangeType string `json:"changeType"`
+				Item       struct {
+					Path string `json:"path"`
+				} `json:"item"`
+				NewContent struct {
+					Content string `json:"content"`
+				} `json:"newContent"`
+			} `json:"changes"`
+		} `json:"commits"`
+		RefUpdates []struct {
+			Name        string `json:"name"`
+			OldObjectID string `json:"oldObjectId"`
+		} `json:"refUpdates"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if len(body.Commits) != 1 || len(body.RefUpdates) != 1 {
+		http.Error(w, "exactly one commit and ref update are expected", http.StatusBadRequest)
+		return
+	}
+
+	branch := strings.TrimPrefix(body.RefUpdates[0].Name, azureRefPrefix)
+	head, err := s.forge.getBranch(branch)
+	if err != nil {
+		azureError(w, err)
+		return
+	}
+	if head.SHA != body.RefUpdates[0].OldObjectID {
+		azureError(w, fmt.Errorf("%w: branch %s has been updated", errConflict, branch))
+		return
+	}
+
+	files := make(map[string]string)
+	for _, change := range body.Commits[0].Changes {
+		if change.ChangeType != "edit" {
+			http.Error(w, "unsupported change type: "+change.ChangeType, http.StatusBadRequest)
+			return
+		}
+		// item paths are absolute to the repository root
+		files[strings.TrimPrefix(change.Item.Path, "/")] = change.NewContent.Content
+	}
+
+	commit, err := s.forge.commitToBranch(branch, body.Commits[0].Comment, files, true)
+	if err != nil {
+		azureError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"pushId":  1,
+		"commits": []interface{}{map[string]string{"commitId": commit.SHA}},
+	})
+}
+
+func (s *azureServer) pullRequest(r *http.Request, pull *PullRequest) map[string]interface{} {
+	webURL := fmt.Sprintf("http://%s/%s/_git/%s", r.Host, s.forge.Owner, s.forge.Repo)
+	return map[string]interface{}{
+		"pullRequestId": pull.ID,
+		"title":         pull.Title,
+		"description":   pull.Description,
+		"status":        "active",
+		"sourceRefName": azureRefPrefix + pull.Source,
+		"targetRefName": azureRefPrefix + pull.Target,
+		"url":           fmt.Sprintf("http://%s%s/%d", r.Host, r.URL.Path, pull.ID),
+		"repository": map[string]string{
+			"name":   s.forge.Repo,
+			"webUrl": webURL,
+		},
+	}
+}
+
+func (s *azureServer) listPullRequests(w http.ResponseWriter, r *http.Request, params []string) {
+	query := r.URL.Query()
+	source := strings.TrimPrefix(query.Get("searchCriteria.sourceRefName"), azureRefPrefix)
+	target := strings.TrimPrefix(query.Get("searchCriteria.targetRefName"), azureRefPrefix)
+
+	pulls := []interface{}{}
+	for _, pull := range s.forge.findPullRequests(source, target) {
+		pulls = append(pulls, s.pullRequest(r, pull))
+	}
+	azureCollection(w, pulls)
+}
+
+func (s *azureServer) createPullRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Title         string `json:"title"`
+		Description   string `json:"description"`
+		SourceRefName string `json:"sourceRefName"`
+		TargetRefName string `json:"targetRefName"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	source := strings.TrimPrefix(body.SourceRefName, azureRefPrefix)
+	target := strings.TrimPrefix(body.TargetRefName, azureRefPrefix)
+	pull, err := s.forge.createPullRequest(source, target, body.Title, body.Description)
+	if err != nil {
+		azureError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.pullRequest(r, pull))
+}
+
+// azureThread returns the thread of the comment, every comment is served in its own thread
+func azureThread(comment Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       comment.ID,
+		"comments": []interface{}{azureComment(comment)},
+	}
+}
+
+func azureComment(comment Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      comment.ID,
+		"content": comment.Body,
+		"author":  map[string]string{"id": userUUID(comment.Author), "displayName": comment.Author},
+	}
+}
+
+func (s *azureServer) listThreads(w http.ResponseWriter, r *http.Request, params []string) {
+	threads := []interface{}{}
+	for _, comment := range s.forge.Comments(atoi(params[0])) {
+		threads = append(threads, azureThread(comment))
+	}
+	azureCollection(w, threads)
+}
+
+func (s *azureServer) createThread(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Comments []struct {
+			Content string `json:"content"`
+		} `json:"comments"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if len(body.Comments) != 1 {
+		http.Error(w, "exactly one comment is expected", http.StatusBadRequest)
+		return
+	}
+	comment, err := s.forge.createComment(atoi(params[0]), BotUser, body.Comments[0].Content)
+	if err != nil {
+		azureError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, azureThread(*comment))
+}
+
+func (s *azureServer) updateComment(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Content string `json:"content"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	comment, err := s.forge.updateComment(atoi(params[2]), body.Content)
+	if err != nil {
+		azureError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, azureComment(*comment))
+}
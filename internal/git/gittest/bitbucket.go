@@ -0,0 +1,277 @@
+package gittest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+// BitbucketMaxAnnotationsPerRequest is the maximum number of report annotations accepted per request
+const BitbucketMaxAnnotationsPerRequest = 100
+
+var bitbucketQueryRegex = regexp.MustCompile(`([a-z.]+)="([^"]*)"`)
+
+type bitbucketServer struct {
+	forge *Forge
+}
+
+// NewBitbucketHandler returns handler serving the bitbucket cloud rest api of the forge repository
+func NewBitbucketHandler(forge *Forge) http.Handler {
+	s := &bitbucketServer{forge: forge}
+
+	prefix := fmt.Sprintf("/repositories/%s/%s", regexp.QuoteMeta(forge.Owner), regexp.QuoteMeta(forge.Repo))
+	rt := &router{}
+	rt.handle(http.MethodGet, "/user", s.getUser)
+	rt.handle(http.MethodGet, prefix+"/refs/branches/(.+)", s.getBranch)
+	rt.handle(http.MethodPost, prefix+"/refs/branches", s.createBranch)
+	rt.handle(http.MethodPost, prefix+"/src", s.createCommit)
+	rt.handle(http.MethodGet, prefix+"/pullrequests", s.listPullRequests)
+	rt.handle(http.MethodPost, prefix+"/pullrequests", s.createPullRequest)
+	rt.handle(http.MethodPut, prefix+"/commit/([^/]+)/reports/([^/]+)", s.createReport)
+	rt.handle(http.MethodPost, prefix+"/commit/([^/]+)/reports/([^/]+)/annotations", s.addAnnotations)
+	rt.handle(http.MethodGet, prefix+"/pullrequests/([0-9]+)/comments", s.listComments)
+	rt.handle(http.MethodPost, prefix+"/pullrequests/([0-9]+)/comments", s.createComment)
+	rt.handle(http.MethodPut, prefix+"/pullrequests/([0-9]+)/comments/([0-9]+)", s.updateComment)
+	return rt
+}
+
+func bitbucketError(w http.ResponseWriter, err error) {
+	writeJSON(w, errorStatus(err), map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"message": err.Error()},
+	})
+}
+
+func bitbucketBranch(name string, commit *Commit) map[string]interface{} {
+	return map[string]interface{}{
+		"name":   name,
+		"target": map[string]string{"hash": commit.SHA},
+	}
+}
+
+func (s *bitbucketServer) getBranch(w http.ResponseWriter, r *http.Request, params []string) {
+	commit, err := s.forge.getBranch(params[0])
+	if err != nil {
+		bitbucketError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bitbucketBranch(params[0], commit))
+}
+
+func (s *bitbucketServer) createBranch(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Name   string `json:"name"`
+		Target struct {
+			Hash string `json:"hash"`
+		} `json:"target"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if err := s.forge.createBranch(body.Name, body.Target.Hash); err != nil {
+		bitbucketError(w, err)
+		return
+	}
+	commit, _ := s.forge.getBranch(body.Name)
+	writeJSON(w, http.StatusCreated, bitbucketBranch(body.Name, commit))
+}
+
+func (s *bitbucketServer) createCommit(w http.ResponseWriter, r *http.Request, params []string) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files := make(map[string]string)
+	for path, headers := range r.MultipartForm.File {
+		file, err := headers[0].Open()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		files[path] = string(content)
+	}
+
+	_, err := s.forge.commitToBranch(r.FormValue("branch"), r.FormValue("message"), files, false)
+	if err != nil {
+		bitbucketError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *bitbucketServer) pullRequest(r *http.Request, pull *PullRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          pull.ID,
+		"title":       pull.Title,
+		"description": pull.Description,
+		"state":       "OPEN",
+		"source":      map[string]interface{}{"branch": map[string]string{"name": pull.Source}},
+		"destination": map[string]interface{}{"branch": map[string]string{"name": pull.Target}},
+		"links": map[string]interface{}{
+			"html": map[string]string{
+				"href": fmt.Sprintf("http://%s/%s/%s/pull-requests/%d", r.Host, s.forge.Owner, s.forge.Repo, pull.ID),
+			},
+		},
+	}
+}
+
+func (s *bitbucketServer) listPullRequests(w http.ResponseWriter, r *http.Request, params []string) {
+	filters := make(map[string]string)
+	for _, groups := range bitbucketQueryRegex.FindAllStringSubmatch(r.URL.Query().Get("q"), -1) {
+		filters[groups[1]] = groups[2]
+	}
+
+	pulls := []interface{}{}
+	if state, ok := filters["state"]; !ok || state == "OPEN" {
+		for _, pull := range s.forge.findPullRequests(filters["source.branch.name"], filters["destination.branch.name"]) {
+			pulls = append(pulls, s.pullRequest(r, pull))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"values": pulls})
+}
+
+func (s *bitbucketServer) createPullRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Source      struct {
+			Branch struct {
+				Name string `json:"name"`
+			} `json:"branch"`
+		} `json:"source"`
+		Destination struct {
+			Branch struct {
+				Name string `json:"name"`
+			} `json:"branch"`
+		} `json:"destination"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	pull, err := s.forge.createPullRequest(body.Source.Branch.Name, body.Destination.Branch.Name, body.Title, body.Description)
+	if err != nil {
+		bitbucketError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.pullRequest(r, pull))
+}
+
+func (s *bitbucketServer) createReport(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Title  string `json:"title"`
+		Result string `json:"result"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if _, err := s.forge.upsertReport(params[1], params[0], body.Result == "PASSED", nil); err != nil {
+		bitbucketError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"uuid":        "{" + params[1] + "}",
+		"external_id": params[1],
+		"title":       body.Title,
+		"result":      body.Result,
+	})
+}
+
+func (s *bitbucketServer) addAnnotations(w http.ResponseWriter, r *http.Request, params []string) {
+	var body []struct {
+		ExternalID string `json:"external_id"`
+		Title      string `json:"title"`
+		Summary    string `json:"summary"`
+		Path       string `json:"path"`
+		Line       int    `json:"line"`
+		Severity   string `json:"severity"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if len(body) > BitbucketMaxAnnotationsPerRequest {
+		bitbucketError(w, fmt.Errorf("too many annotations: %d", len(body)))
+		return
+	}
+
+	var annotations []Annotation
+	for _, annotation := range body {
+		annotations = append(annotations, Annotation{
+			Path:    annotation.Path,
+			Line:    annotation.Line,
+			Title:   annotation.Title,
+			Message: annotation.Summary,
+			Warning: annotation.Severity == "LOW",
+		})
+	}
+	if _, err := s.forge.annotateReport(params[1], annotations); err != nil {
+		bitbucketError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func bitbucketUser(name string) map[string]string {
+	return map[string]string{"uuid": "{" + userUUID(name) + "}", "display_name": name}
+}
+
+func (s *bitbucketServer) getUser(w http.ResponseWriter, r *http.Request, params []string) {
+	writeJSON(w, http.StatusOK, bitbucketUser(BotUser))
+}
+
+func bitbucketComment(comment Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      comment.ID,
+		"content": map[string]string{"raw": comment.Body},
+		"user":    bitbucketUser(comment.Author),
+	}
+}
+
+func (s *bitbucketServer) listComments(w http.ResponseWriter, r *http.Request, params []string) {
+	comments := []interface{}{}
+	for _, comment := range s.forge.Comments(atoi(params[0])) {
+		comments = append(comments, bitbucketComment(comment))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"values": comments})
+}
+
+func (s *bitbucketServer) createComment(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Content struct {
+			Raw string `json:"raw"`
+		} `json:"content"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	comment, err := s.forge.createComment(atoi(params[0]), BotUser, body.Content.Raw)
+	if err != nil {
+		bitbucketError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, bitbucketComment(*comment))
+}
+
+func (s *bitbucketServer) updateComment(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Content struct {
+			Raw string `json:"raw"`
+		} `json:"content"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	comment, err := s.forge.updateComment(atoi(params[1]), body.Content.Raw)
+	if err != nil {
+		bitbucketError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bitbucketComment(*comment))
+}
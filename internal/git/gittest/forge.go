@@ -0,0 +1,381 @@
+// Package gittest provides in-memory fake git forges to test the git providers against
+package gittest
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"sync"
+)
+
+// BotUser is the user authenticated by the servers, the comments created through the servers are
+// authored by it
+const BotUser = "weave-bot"
+
+var (
+	errNotFound = errors.New("not found")
+	errConflict = errors.New("conflict")
+)
+
+// Commit is a commit stored in the forge, it holds the full file tree
+type Commit struct {
+	SHA     string
+	Parent  string
+	Message string
+	Files   map[string]string
+	// Signature is the commit signature of Payload, forges do not verify it
+	Signature string
+	Payload   string
+}
+
+// PullRequest is a pull request stored in the forge
+type PullRequest struct {
+	ID          int
+	Source      string
+	Target      string
+	Title       string
+	Description string
+	// Reviewers are the requested reviewers, users are prefixed with @ and teams with @owner/
+	Reviewers []string
+}
+
+// Annotation is a report annotation
+type Annotation struct {
+	Path    string
+	Line    int
+	Title   string
+	Message string
+	// Warning is set on the annotations of the github warning level or the bitbucket low severity
+	Warning bool
+}
+
+// Report is a commit report such as a github check run or a bitbucket code insights report
+type Report struct {
+	ID          string
+	SHA         string
+	Passed      bool
+	Annotations []Annotation
+}
+
+// Comment is a pull request comment
+type Comment struct {
+	ID     int
+	Number int
+	Author string
+	Body   string
+}
+
+// Forge is the in-memory state of a single repository shared by the fake servers
+type Forge struct {
+	Owner string
+	Repo  string
+
+	mu           sync.Mutex
+	lastID       int
+	commits      map[string]*Commit
+	branches     map[string]string
+	pullRequests []*PullRequest
+	reports      map[string]*Report
+	comments     []*Comment
+}
+
+// NewForge creates empty forge of the given repository
+func NewForge(owner, repo string) *Forge {
+	return &Forge{
+		Owner:    owner,
+		Repo:     repo,
+		commits:  make(map[string]*Commit),
+		branches: make(map[string]string),
+		reports:  make(map[string]*Report),
+	}
+}
+
+// Commit commits the files to the branch, the branch is created if it does not exist
+func (f *Forge) Commit(branch, message string, files map[string]string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commit := f.createCommit(f.branches[branch], message, files)
+	f.branches[branch] = commit.SHA
+	return commit.SHA
+}
+
+// Branch returns the head commit of the branch
+func (f *Forge) Branch(name string) (*Commit, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sha, ok := f.branches[name]
+	if !ok {
+		return nil, false
+	}
+	return f.commits[sha], true
+}
+
+// Branches returns the sorted branch names
+func (f *Forge) Branches() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for name := range f.branches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PullRequests returns all pull requests
+func (f *Forge) PullRequests() []PullRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var pulls []PullRequest
+	for _, pull := range f.pullRequests {
+		pulls = append(pulls, *pull)
+	}
+	return pulls
+}
+
+// Reports returns the reports of the given commit
+func (f *Forge) Reports(sha string) []Report {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var reports []Report
+	for _, report := range f.reports {
+		if report.SHA == sha {
+			reports = append(reports, *report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ID < reports[j].ID })
+	return reports
+}
+
+// Comments returns the comments of the given pull request
+func (f *Forge) Comments(number int) []Comment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var comments []Comment
+	for _, comment := range f.comments {
+		if comment.Number == number {
+			comments = append(comments, *comment)
+		}
+	}
+	return comments
+}
+
+// userUUID returns the stable uuid of the user for the servers identifying users by uuids
+func userUUID(name string) string {
+	return fmt.Sprintf("%08x-0000-4000-8000-000000000000", crc32.ChecksumIEEE([]byte(name)))
+}
+
+func (f *Forge) nextID() int {
+	f.lastID++
+	return f.lastID
+}
+
+func (f *Forge) createCommit(parent, message string, files map[string]string) *Commit {
+	tree := make(map[string]string)
+	if commit, ok := f.commits[parent]; ok {
+		for path, content := range commit.Files {
+			tree[path] = content
+		}
+	}
+	for path, content := range files {
+		tree[path] = content
+	}
+
+	sha := fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%d-%s-%s", f.nextID(), parent, message))))
+	commit := &Commit{
+		SHA:     sha,
+		Parent:  parent,
+		Message: message,
+		Files:   tree,
+	}
+	f.commits[sha] = commit
+	return commit
+}
+
+func (f *Forge) getCommit(sha string) (*Commit, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commit, ok := f.commits[sha]
+	if !ok {
+		return nil, errNotFound
+	}
+	return commit, nil
+}
+
+func (f *Forge) getBranch(name string) (*Commit, error) {
+	commit, ok := f.Branch(name)
+	if !ok {
+		return nil, errNotFound
+	}
+	return commit, nil
+}
+
+func (f *Forge) createBranch(name, sha string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.branches[name]; ok {
+		return errConflict
+	}
+	if _, ok := f.commits[sha]; !ok {
+		return errNotFound
+	}
+	f.branches[name] = sha
+	return nil
+}
+
+func (f *Forge) updateBranch(name, sha string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.branches[name]; !ok {
+		return errNotFound
+	}
+	if _, ok := f.commits[sha]; !ok {
+		return errNotFound
+	}
+	f.branches[name] = sha
+	return nil
+}
+
+// newCommit creates detached commit on top of parent, the signature of the payload is optional
+func (f *Forge) newCommit(parent, message string, files map[string]string, signature, payload string) (*Commit, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.commits[parent]; !ok {
+		return nil, errNotFound
+	}
+	commit := f.createCommit(parent, message, files)
+	commit.Signature, commit.Payload = signature, payload
+	return commit, nil
+}
+
+// commitToBranch commits the files on top of the branch head, only existing files can be updated
+// when update is set
+func (f *Forge) commitToBranch(branch, message string, files map[string]string, update bool) (*Commit, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	head, ok := f.branches[branch]
+	if !ok {
+		return nil, errNotFound
+	}
+	if update {
+		for path := range files {
+			if _, ok := f.commits[head].Files[path]; !ok {
+				return nil, fmt.Errorf("file does not exist: %s", path)
+			}
+		}
+	}
+	commit := f.createCommit(head, message, files)
+	f.branches[branch] = commit.SHA
+	return commit, nil
+}
+
+func (f *Forge) findPullRequests(source, target string) []*PullRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var pulls []*PullRequest
+	for _, pull := range f.pullRequests {
+		if (source == "" || pull.Source == source) && (target == "" || pull.Target == target) {
+			pulls = append(pulls, pull)
+		}
+	}
+	return pulls
+}
+
+func (f *Forge) createPullRequest(source, target, title, description string) (*PullRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.branches[source]; !ok {
+		return nil, errNotFound
+	}
+	if _, ok := f.branches[target]; !ok {
+		return nil, errNotFound
+	}
+	for _, pull := range f.pullRequests {
+		if pull.Source == source && pull.Target == target {
+			return nil, errConflict
+		}
+	}
+	pull := &PullRequest{
+		ID:          len(f.pullRequests) + 1,
+		Source:      source,
+		Target:      target,
+		Title:       title,
+		Description: description,
+	}
+	f.pullRequests = append(f.pullRequests, pull)
+	return pull, nil
+}
+
+func (f *Forge) requestReviewers(id int, reviewers []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, pull := range f.pullRequests {
+		if pull.ID == id {
+			pull.Reviewers = append(pull.Reviewers, reviewers...)
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+func (f *Forge) upsertReport(id, sha string, passed bool, annotations []Annotation) (*Report, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.commits[sha]; !ok {
+		return nil, errNotFound
+	}
+	report := &Report{
+		ID:          id,
+		SHA:         sha,
+		Passed:      passed,
+		Annotations: annotations,
+	}
+	f.reports[id] = report
+	return report, nil
+}
+
+func (f *Forge) annotateReport(id string, annotations []Annotation) (*Report, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	report, ok := f.reports[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	report.Annotations = append(report.Annotations, annotations...)
+	return report, nil
+}
+
+// AddComment adds comment of the author to the given pull request, e.g. a comment of another user
+func (f *Forge) AddComment(number int, author, body string) (*Comment, error) {
+	return f.createComment(number, author, body)
+}
+
+func (f *Forge) createComment(number int, author, body string) (*Comment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if number < 1 || number > len(f.pullRequests) {
+		return nil, errNotFound
+	}
+	comment := &Comment{
+		ID:     f.nextID(),
+		Number: number,
+		Author: author,
+		Body:   body,
+	}
+	f.comments = append(f.comments, comment)
+	return comment, nil
+}
+
+func (f *Forge) updateComment(id int, body string) (*Comment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, comment := range f.comments {
+		if comment.ID == id {
+			comment.Body = body
+			return comment, nil
+		}
+	}
+	return nil, errNotFound
+}
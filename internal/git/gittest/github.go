@@ -0,0 +1,448 @@
+package gittest
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GithubMaxAnnotationsPerRequest is the maximum number of check run annotations accepted per request
+	GithubMaxAnnotationsPerRequest = 50
+	// GithubAuthor is the login of the user creating pull requests, its review can not be requested
+	GithubAuthor = BotUser
+	// GithubOutsider is a user who is not a collaborator of the repository, its review can not be requested
+	GithubOutsider = "outsider"
+)
+
+type githubServer struct {
+	forge *Forge
+
+	mu     sync.Mutex
+	lastID int
+	trees  map[string]map[string]string
+}
+
+type githubCheckRunOutput struct {
+	Title       string `json:"title"`
+	Summary     string `json:"summary"`
+	Annotations []struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		Title     string `json:"title"`
+		Message   string `json:"message"`
+		Level     string `json:"annotation_level"`
+	} `json:"annotations,omitempty"`
+}
+
+// NewGithubHandler returns handler serving the github enterprise rest api of the forge repository
+func NewGithubHandler(forge *Forge) http.Handler {
+	s := &githubServer{
+		forge: forge,
+		trees: make(map[string]map[string]string),
+	}
+
+	prefix := fmt.Sprintf("/api/v3/repos/%s/%s", regexp.QuoteMeta(forge.Owner), regexp.QuoteMeta(forge.Repo))
+	rt := &router{}
+	rt.handle(http.MethodGet, "/api/v3/user", s.getUser)
+	rt.handle(http.MethodGet, prefix+"/git/ref/heads/(.+)", s.getRef)
+	rt.handle(http.MethodPost, prefix+"/git/refs", s.createRef)
+	rt.handle(http.MethodPatch, prefix+"/git/refs/heads/(.+)", s.updateRef)
+	rt.handle(http.MethodGet, prefix+"/branches/(.+)", s.getBranch)
+	rt.handle(http.MethodPost, prefix+"/git/trees", s.createTree)
+	rt.handle(http.MethodPost, prefix+"/git/commits", s.createCommit)
+	rt.handle(http.MethodGet, prefix+"/pulls", s.listPullRequests)
+	rt.handle(http.MethodPost, prefix+"/pulls", s.createPullRequest)
+	rt.handle(http.MethodPost, prefix+"/pulls/([0-9]+)/requested_reviewers", s.requestReviewers)
+	rt.handle(http.MethodPost, prefix+"/check-runs", s.createCheckRun)
+	rt.handle(http.MethodPatch, prefix+"/check-runs/([0-9]+)", s.updateCheckRun)
+	rt.handle(http.MethodGet, prefix+"/issues/([0-9]+)/comments", s.listComments)
+	rt.handle(http.MethodPost, prefix+"/issues/([0-9]+)/comments", s.createComment)
+	rt.handle(http.MethodPatch, prefix+"/issues/comments/([0-9]+)", s.updateComment)
+	return rt
+}
+
+func (s *githubServer) nextID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	return fmt.Sprint(s.lastID)
+}
+
+func githubError(w http.ResponseWriter, err error) {
+	writeJSON(w, errorStatus(err), map[string]string{"message": err.Error()})
+}
+
+func githubRef(name, sha string) map[string]interface{} {
+	return map[string]interface{}{
+		"ref":    "refs/heads/" + name,
+		"object": map[string]string{"type": "commit", "sha": sha},
+	}
+}
+
+func (s *githubServer) getRef(w http.ResponseWriter, r *http.Request, params []string) {
+	commit, err := s.forge.getBranch(params[0])
+	if err != nil {
+		githubError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, githubRef(params[0], commit.SHA))
+}
+
+func (s *githubServer) createRef(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	name := strings.TrimPrefix(body.Ref, "refs/heads/")
+	if err := s.forge.createBranch(name, body.SHA); err != nil {
+		// github responds with unprocessable entity when the reference already exists
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, githubRef(name, body.SHA))
+}
+
+func (s *githubServer) updateRef(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		SHA string `json:"sha"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if err := s.forge.updateBranch(params[0], body.SHA); err != nil {
+		githubError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, githubRef(params[0], body.SHA))
+}
+
+func (s *githubServer) getBranch(w http.ResponseWriter, r *http.Request, params []string) {
+	commit, err := s.forge.getBranch(params[0])
+	if err != nil {
+		githubError(w, err)
+		return
+	}
+	// the commit tree is addressed by the commit sha
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name": params[0],
+		"commit": map[string]interface{}{
+			"sha": commit.SHA,
+			"commit": map[string]interface{}{
+				"tree": map[string]string{"sha": commit.SHA},
+			},
+		},
+	})
+}
+
+func (s *githubServer) tree(sha string) (map[string]string, error) {
+	s.mu.Lock()
+	files, ok := s.trees[sha]
+	s.mu.Unlock()
+	if ok {
+		return files, nil
+	}
+	commit, err := s.forge.getCommit(sha)
+	if err != nil {
+		return nil, err
+	}
+	return commit.Files, nil
+}
+
+func (s *githubServer) createTree(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		BaseTree string `json:"base_tree"`
+		Tree     []struct {
+			Path    string `json:"path"`
+			Content string `json:"content"`
+		} `json:"tree"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	base, err := s.tree(body.BaseTree)
+	if err != nil {
+		githubError(w, err)
+		return
+	}
+
+	files := make(map[string]string)
+	for path, content := range base {
+		files[path] = content
+	}
+	for _, entry := range body.Tree {
+		files[entry.Path] = entry.Content
+	}
+
+	sha := "tree-" + s.nextID()
+	s.mu.Lock()
+	s.trees[sha] = files
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]string{"sha": sha})
+}
+
+type githubCommitAuthor struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Date  time.Time `json:"date"`
+}
+
+func (a githubCommitAuthor) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", a.Name, a.Email, a.Date.Unix(), a.Date.Format("-0700"))
+}
+
+func (s *githubServer) createCommit(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Message   string              `json:"message"`
+		Tree      string              `json:"tree"`
+		Parents   []string            `json:"parents"`
+		Author    *githubCommitAuthor `json:"author"`
+		Committer *githubCommitAuthor `json:"committer"`
+		Signature string              `json:"signature"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if len(body.Parents) != 1 {
+		http.Error(w, "exactly one parent is expected", http.StatusBadRequest)
+		return
+	}
+
+	files, err := s.tree(body.Tree)
+	if err != nil {
+		githubError(w, err)
+		return
+	}
+
+	// signatures are reported as valid without verification, tests verify them against the stored payload
+	var payload string
+	verification := map[string]interface{}{"verified": false, "reason": "unsigned"}
+	if body.Signature != "" && body.Author != nil {
+		committer := body.Author
+		if body.Committer != nil {
+			committer = body.Committer
+		}
+		payload = fmt.Sprintf("tree %s\nparent %s\nauthor %s\ncommitter %s\n\n%s", body.Tree, body.Parents[0], body.Author, committer, body.Message)
+		verification = map[string]interface{}{"verified": true, "reason": "valid", "signature": body.Signature, "payload": payload}
+	}
+
+	commit, err := s.forge.newCommit(body.Parents[0], body.Message, files, body.Signature, payload)
+	if err != nil {
+		githubError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"sha": commit.SHA, "message": commit.Message, "verification": verification})
+}
+
+func (s *githubServer) pullRequest(r *http.Request, pull *PullRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"number":   pull.ID,
+		"title":    pull.Title,
+		"body":     pull.Description,
+		"html_url": fmt.Sprintf("http://%s/%s/%s/pull/%d", r.Host, s.forge.Owner, s.forge.Repo, pull.ID),
+		"head":     map[string]string{"ref": pull.Source},
+		"base":     map[string]string{"ref": pull.Target},
+		"user":     map[string]string{"login": GithubAuthor},
+	}
+}
+
+func (s *githubServer) listPullRequests(w http.ResponseWriter, r *http.Request, params []string) {
+	// the head filter must be in the owner:branch format, otherwise github ignores it
+	var source string
+	if head := r.URL.Query().Get("head"); head != "" {
+		owner, branch, ok := strings.Cut(head, ":")
+		if !ok || owner != s.forge.Owner {
+			writeJSON(w, http.StatusOK, []interface{}{})
+			return
+		}
+		source = branch
+	}
+
+	pulls := []interface{}{}
+	for _, pull := range s.forge.findPullRequests(source, r.URL.Query().Get("base")) {
+		pulls = append(pulls, s.pullRequest(r, pull))
+	}
+	writeJSON(w, http.StatusOK, pulls)
+}
+
+func (s *githubServer) createPullRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+		Head  string `json:"head"`
+		Base  string `json:"base"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	pull, err := s.forge.createPullRequest(body.Head, body.Base, body.Title, body.Body)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.pullRequest(r, pull))
+}
+
+func (s *githubServer) requestReviewers(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Reviewers     []string `json:"reviewers"`
+		TeamReviewers []string `json:"team_reviewers"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	var reviewers []string
+	for _, reviewer := range body.Reviewers {
+		if strings.EqualFold(reviewer, GithubAuthor) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Review cannot be requested from pull request author."})
+			return
+		}
+		if strings.EqualFold(reviewer, GithubOutsider) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Reviews may only be requested from collaborators."})
+			return
+		}
+		reviewers = append(reviewers, "@"+reviewer)
+	}
+	for _, team := range body.TeamReviewers {
+		reviewers = append(reviewers, fmt.Sprintf("@%s/%s", s.forge.Owner, team))
+	}
+	if err := s.forge.requestReviewers(atoi(params[0]), reviewers); err != nil {
+		writeJSON(w, errorStatus(err), map[string]string{"message": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"number": atoi(params[0])})
+}
+
+func githubAnnotations(w http.ResponseWriter, output *githubCheckRunOutput) ([]Annotation, bool) {
+	if output == nil {
+		return nil, true
+	}
+	if len(output.Annotations) > GithubMaxAnnotationsPerRequest {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "too many annotations"})
+		return nil, false
+	}
+	var annotations []Annotation
+	for _, annotation := range output.Annotations {
+		annotations = append(annotations, Annotation{
+			Path:    annotation.Path,
+			Line:    annotation.StartLine,
+			Title:   annotation.Title,
+			Message: annotation.Message,
+			Warning: annotation.Level == "warning",
+		})
+	}
+	return annotations, true
+}
+
+func (s *githubServer) createCheckRun(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Name       string                `json:"name"`
+		HeadSHA    string                `json:"head_sha"`
+		Conclusion string                `json:"conclusion"`
+		Output     *githubCheckRunOutput `json:"output"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	annotations, ok := githubAnnotations(w, body.Output)
+	if !ok {
+		return
+	}
+
+	id := s.nextID()
+	if _, err := s.forge.upsertReport(id, body.HeadSHA, body.Conclusion == "success", annotations); err != nil {
+		githubError(w, err)
+		return
+	}
+
+	checkRun := map[string]interface{}{
+		"id":         atoi(id),
+		"name":       body.Name,
+		"head_sha":   body.HeadSHA,
+		"conclusion": body.Conclusion,
+	}
+	if body.Output != nil {
+		checkRun["output"] = map[string]string{"title": body.Output.Title, "summary": body.Output.Summary}
+	}
+	writeJSON(w, http.StatusCreated, checkRun)
+}
+
+func (s *githubServer) updateCheckRun(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Name   string                `json:"name"`
+		Output *githubCheckRunOutput `json:"output"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	annotations, ok := githubAnnotations(w, body.Output)
+	if !ok {
+		return
+	}
+	if _, err := s.forge.annotateReport(params[0], annotations); err != nil {
+		githubError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": atoi(params[0]), "name": body.Name})
+}
+
+func githubUser(login string) map[string]string {
+	userType := "User"
+	if login == BotUser {
+		userType = "Bot"
+	}
+	return map[string]string{"login": login, "type": userType}
+}
+
+func (s *githubServer) getUser(w http.ResponseWriter, r *http.Request, params []string) {
+	writeJSON(w, http.StatusOK, githubUser(BotUser))
+}
+
+func githubComment(comment Comment) map[string]interface{} {
+	return map[string]interface{}{"id": comment.ID, "body": comment.Body, "user": githubUser(comment.Author)}
+}
+
+func (s *githubServer) listComments(w http.ResponseWriter, r *http.Request, params []string) {
+	comments := []interface{}{}
+	for _, comment := range s.forge.Comments(atoi(params[0])) {
+		comments = append(comments, githubComment(comment))
+	}
+	writeJSON(w, http.StatusOK, comments)
+}
+
+func (s *githubServer) createComment(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Body string `json:"body"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	comment, err := s.forge.createComment(atoi(params[0]), BotUser, body.Body)
+	if err != nil {
+		githubError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, githubComment(*comment))
+}
+
+func (s *githubServer) updateComment(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Body string `json:"body"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	comment, err := s.forge.updateComment(atoi(params[0]), body.Body)
+	if err != nil {
+		githubError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, githubComment(*comment))
+}
@@ -0,0 +1,232 @@
+package gittest
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+type gitlabServer struct {
+	forge *Forge
+}
+
+// GitlabUsers are the users known to the gitlab server by id
+var GitlabUsers = map[int]string{
+	1: "alice",
+	2: "bob",
+}
+
+// gitlabBotID is the id of the bot user, the bot is not listed in the users so it can not be a reviewer
+const gitlabBotID = 100
+
+// NewGitlabHandler returns handler serving the gitlab rest api of the forge repository
+func NewGitlabHandler(forge *Forge) http.Handler {
+	s := &gitlabServer{forge: forge}
+
+	prefix := fmt.Sprintf("/api/v4/projects/%s", regexp.QuoteMeta(forge.Owner+"%2F"+forge.Repo))
+	rt := &router{}
+	rt.handle(http.MethodGet, "/api/v4/users", s.listUsers)
+	rt.handle(http.MethodGet, "/api/v4/user", s.getUser)
+	rt.handle(http.MethodGet, prefix+"/repository/branches/(.+)", s.getBranch)
+	rt.handle(http.MethodPost, prefix+"/repository/branches", s.createBranch)
+	rt.handle(http.MethodPost, prefix+"/repository/commits", s.createCommit)
+	rt.handle(http.MethodGet, prefix+"/merge_requests", s.listMergeRequests)
+	rt.handle(http.MethodPost, prefix+"/merge_requests", s.createMergeRequest)
+	rt.handle(http.MethodGet, prefix+"/merge_requests/([0-9]+)/notes", s.listNotes)
+	rt.handle(http.MethodPost, prefix+"/merge_requests/([0-9]+)/notes", s.createNote)
+	rt.handle(http.MethodPut, prefix+"/merge_requests/([0-9]+)/notes/([0-9]+)", s.updateNote)
+	return rt
+}
+
+func gitlabError(w http.ResponseWriter, err error) {
+	writeJSON(w, errorStatus(err), map[string]string{"message": err.Error()})
+}
+
+func gitlabBranch(name string, commit *Commit) map[string]interface{} {
+	return map[string]interface{}{
+		"name":   name,
+		"commit": map[string]string{"id": commit.SHA},
+	}
+}
+
+func (s *gitlabServer) getBranch(w http.ResponseWriter, r *http.Request, params []string) {
+	commit, err := s.forge.getBranch(params[0])
+	if err != nil {
+		gitlabError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, gitlabBranch(params[0], commit))
+}
+
+func (s *gitlabServer) createBranch(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Branch string `json:"branch"`
+		Ref    string `json:"ref"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if err := s.forge.createBranch(body.Branch, body.Ref); err != nil {
+		// gitlab responds with bad request when the branch already exists
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	commit, _ := s.forge.getBranch(body.Branch)
+	writeJSON(w, http.StatusCreated, gitlabBranch(body.Branch, commit))
+}
+
+func (s *gitlabServer) createCommit(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Branch        string `json:"branch"`
+		CommitMessage string `json:"commit_message"`
+		Actions       []struct {
+			Action   string `json:"action"`
+			FilePath string `json:"file_path"`
+			Content  string `json:"content"`
+		} `json:"actions"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	files := make(map[string]string)
+	for _, action := range body.Actions {
+		if action.Action != "update" {
+			http.Error(w, "unsupported action: "+action.Action, http.StatusBadRequest)
+			return
+		}
+		files[action.FilePath] = action.Content
+	}
+
+	commit, err := s.forge.commitToBranch(body.Branch, body.CommitMessage, files, true)
+	if err != nil {
+		gitlabError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"id": commit.SHA, "message": commit.Message})
+}
+
+func (s *gitlabServer) mergeRequest(r *http.Request, pull *PullRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"iid":           pull.ID,
+		"title":         pull.Title,
+		"description":   pull.Description,
+		"source_branch": pull.Source,
+		"target_branch": pull.Target,
+		"state":         "opened",
+		"web_url":       fmt.Sprintf("http://%s/%s/%s/-/merge_requests/%d", r.Host, s.forge.Owner, s.forge.Repo, pull.ID),
+	}
+}
+
+func (s *gitlabServer) listMergeRequests(w http.ResponseWriter, r *http.Request, params []string) {
+	query := r.URL.Query()
+	pulls := []interface{}{}
+	if state := query.Get("state"); state == "" || state == "opened" {
+		for _, pull := range s.forge.findPullRequests(query.Get("source_branch"), query.Get("target_branch")) {
+			pulls = append(pulls, s.mergeRequest(r, pull))
+		}
+	}
+	writeJSON(w, http.StatusOK, pulls)
+}
+
+func (s *gitlabServer) createMergeRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		ReviewerIDs  []int  `json:"reviewer_ids"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	var reviewers []string
+	for _, id := range body.ReviewerIDs {
+		username, ok := GitlabUsers[id]
+		if !ok {
+			gitlabError(w, errNotFound)
+			return
+		}
+		reviewers = append(reviewers, "@"+username)
+	}
+	pull, err := s.forge.createPullRequest(body.SourceBranch, body.TargetBranch, body.Title, body.Description)
+	if err != nil {
+		gitlabError(w, err)
+		return
+	}
+	if len(reviewers) > 0 {
+		if err := s.forge.requestReviewers(pull.ID, reviewers); err != nil {
+			gitlabError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, s.mergeRequest(r, pull))
+}
+
+func (s *gitlabServer) listUsers(w http.ResponseWriter, r *http.Request, params []string) {
+	users := []interface{}{}
+	for id, username := range GitlabUsers {
+		if username == r.URL.Query().Get("username") {
+			users = append(users, map[string]interface{}{"id": id, "username": username})
+		}
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func gitlabUser(username string) map[string]interface{} {
+	if username == BotUser {
+		return map[string]interface{}{"id": gitlabBotID, "username": username}
+	}
+	for id, name := range GitlabUsers {
+		if name == username {
+			return map[string]interface{}{"id": id, "username": username}
+		}
+	}
+	return map[string]interface{}{"id": 0, "username": username}
+}
+
+func (s *gitlabServer) getUser(w http.ResponseWriter, r *http.Request, params []string) {
+	writeJSON(w, http.StatusOK, gitlabUser(BotUser))
+}
+
+func gitlabNote(comment Comment) map[string]interface{} {
+	return map[string]interface{}{"id": comment.ID, "body": comment.Body, "author": gitlabUser(comment.Author)}
+}
+
+func (s *gitlabServer) listNotes(w http.ResponseWriter, r *http.Request, params []string) {
+	notes := []interface{}{}
+	for _, comment := range s.forge.Comments(atoi(params[0])) {
+		notes = append(notes, gitlabNote(comment))
+	}
+	writeJSON(w, http.StatusOK, notes)
+}
+
+func (s *gitlabServer) createNote(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Body string `json:"body"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	comment, err := s.forge.createComment(atoi(params[0]), BotUser, body.Body)
+	if err != nil {
+		gitlabError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, gitlabNote(*comment))
+}
+
+func (s *gitlabServer) updateNote(w http.ResponseWriter, r *http.Request, params []string) {
+	var body struct {
+		Body string `json:"body"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	comment, err := s.forge.updateComment(atoi(params[1]), body.Body)
+	if err != nil {
+		gitlabError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, gitlabNote(*comment))
+}
@@ -0,0 +1,88 @@
+package gittest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request, params []string)
+
+type route struct {
+	method  string
+	pattern *regexp.Regexp
+	handler handlerFunc
+}
+
+// router matches the escaped request path against regular expressions, so that escaped
+// slashes such as gitlab's url encoded project ids are kept in a single parameter
+type router struct {
+	routes []route
+}
+
+func (rt *router) handle(method, pattern string, handler handlerFunc) {
+	rt.routes = append(rt.routes, route{
+		method:  method,
+		pattern: regexp.MustCompile("^" + pattern + "$"),
+		handler: handler,
+	})
+}
+
+// ServeHTTP implements http.Handler
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range rt.routes {
+		if route.method != r.Method {
+			continue
+		}
+		groups := route.pattern.FindStringSubmatch(r.URL.EscapedPath())
+		if groups == nil {
+			continue
+		}
+		params := make([]string, len(groups)-1)
+		for i, group := range groups[1:] {
+			param, err := url.PathUnescape(group)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			params[i] = param
+		}
+		route.handler(w, r, params)
+		return
+	}
+	http.Error(w, "route not found: "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// errorStatus maps forge errors to http status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
@@ -0,0 +1,149 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+const (
+	gitBinary       = "git"
+	gitFileMode     = "100644"
+	gitSignatureKey = "gpgsig"
+)
+
+// httpUsers are the basic auth user names of token authenticated git operations over https
+var httpUsers = map[string]string{
+	Github:           "x-access-token",
+	GithubEnterprise: "x-access-token",
+	Gitlab:           "oauth2",
+	Bitbucket:        "x-token-auth",
+	AzureDevops:      "",
+}
+
+// AuthEnv returns the environment variables authenticating the git https operations of the provider
+// with the token, they are passed in the environment so that the credentials are not visible in the
+// process arguments and the errors of the git commands
+func AuthEnv(provider, token string) []string {
+	user, ok := httpUsers[provider]
+	if !ok || token == "" {
+		return nil
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte(user + ":" + token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + credentials,
+	}
+}
+
+// localCommitter creates signed commits in the local repository and pushes them to the remote, it is
+// used by providers whose commit apis do not accept signatures
+type localCommitter struct {
+	dir    string
+	url    string
+	auth   []string
+	signer Signer
+	author CommitAuthor
+}
+
+func newLocalCommitter(dir, url, provider, token string, signer Signer, author CommitAuthor) *localCommitter {
+	return &localCommitter{
+		dir:    dir,
+		url:    url,
+		auth:   AuthEnv(provider, token),
+		signer: signer,
+		author: author,
+	}
+}
+
+// CreateCommit creates the signed commit of the files on top of the remote branch head and pushes it,
+// the working tree and index of the local repository are not modified
+func (c *localCommitter) CreateCommit(ctx context.Context, branch, message string, files []*types.File) (*types.CommitSignature, error) {
+	if _, err := c.git(ctx, c.auth, "", "fetch", "--quiet", c.url, getRefName(branch)); err != nil {
+		return nil, fmt.Errorf("failed to fetch branch: %s, error: %v", branch, err)
+	}
+	parent, err := c.git(ctx, nil, "", "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "weave-commit-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create commit, error: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+
+	if _, err := c.git(ctx, env, "", "read-tree", parent); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := file.Content()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file content, file: %s, error: %v", file.Path, err)
+		}
+		blob, err := c.git(ctx, env, content, "hash-object", "-w", "--stdin")
+		if err != nil {
+			return nil, err
+		}
+		cacheInfo := fmt.Sprintf("%s,%s,%s", gitFileMode, blob, file.Path)
+		if _, err := c.git(ctx, env, "", "update-index", "--add", "--cacheinfo", cacheInfo); err != nil {
+			return nil, err
+		}
+	}
+	tree, err := c.git(ctx, env, "", "write-tree")
+	if err != nil {
+		return nil, err
+	}
+
+	author := c.author
+	author.Date = time.Now().UTC().Truncate(time.Second)
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	payload := commitPayload(tree, []string{parent}, author, message)
+	signature, err := c.signer.Sign([]byte(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := c.git(ctx, nil, signedCommitObject(payload, signature), "hash-object", "-t", "commit", "-w", "--stdin")
+	if err != nil {
+		return nil, err
+	}
+	refspec := fmt.Sprintf("%s:%s", commit, getRefName(branch))
+	if _, err := c.git(ctx, c.auth, "", "push", "--quiet", c.url, refspec); err != nil {
+		return nil, fmt.Errorf("failed to push commit, error: %v", err)
+	}
+	return &types.CommitSignature{Signed: true}, nil
+}
+
+// signedCommitObject inserts the signature header after the committer header of the commit payload
+func signedCommitObject(payload, signature string) string {
+	headers, message, _ := strings.Cut(payload, "\n\n")
+	signature = strings.TrimSuffix(signature, "\n")
+	return fmt.Sprintf("%s\n%s %s\n\n%s", headers, gitSignatureKey, strings.ReplaceAll(signature, "\n", "\n "), message)
+}
+
+func (c *localCommitter) git(ctx context.Context, env []string, stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gitBinary, args...)
+	cmd.Dir = c.dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,30 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const dotGit = ".git"
+
+// FindRepositoryRoot returns the closest directory of the path containing .git, worktrees and
+// submodules having a .git file are supported
+func FindRepositoryRoot(path string) (string, bool) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, dotGit)); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,43 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindRepositoryRoot(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	submodule := filepath.Join(repo, "vendor", "charts")
+	for _, path := range []string{
+		filepath.Join(repo, dotGit),
+		filepath.Join(repo, "deploy", "base"),
+		submodule,
+		filepath.Join(dir, "other"),
+	} {
+		assert.NoError(t, os.MkdirAll(path, 0755))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(repo, "deploy", "app.yaml"), nil, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(submodule, dotGit), []byte("gitdir: ../../.git/modules/charts"), 0644))
+
+	tests := []struct {
+		path  string
+		root  string
+		found bool
+	}{
+		{path: repo, root: repo, found: true},
+		{path: filepath.Join(repo, "deploy", "base"), root: repo, found: true},
+		{path: filepath.Join(repo, "deploy", "app.yaml"), root: repo, found: true},
+		{path: submodule, root: submodule, found: true},
+		{path: filepath.Join(dir, "other"), found: false},
+	}
+
+	for _, test := range tests {
+		root, found := FindRepositoryRoot(test.path)
+		assert.Equal(t, test.found, found, test.path)
+		assert.Equal(t, test.root, root, test.path)
+	}
+}
@@ -0,0 +1,220 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/weave-policy-validator/internal/git/gittest"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+const (
+	testAuthorName  = "weave bot"
+	testAuthorEmail = "bot@weave.works"
+)
+
+// newGPGKey writes armored private key of new gpg entity
+func newGPGKey(t *testing.T) (*openpgp.Entity, string) {
+	entity, err := openpgp.NewEntity(testAuthorName, "", testAuthorEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.asc")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	w, err := armor.Encode(out, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return entity, path
+}
+
+// newSSHKey generates ssh key with ssh-keygen and returns its path and allowed signers file
+func newSSHKey(t *testing.T, passphrase string) (string, string) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "id_ed25519")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", passphrase, "-C", testAuthorEmail, "-f", path).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	publicKey, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowedSigners := filepath.Join(dir, "allowed_signers")
+	if err := os.WriteFile(allowedSigners, []byte(testAuthorEmail+" "+string(publicKey)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, allowedSigners
+}
+
+func verifyGPGSignature(t *testing.T, entity *openpgp.Entity, payload, signature string) {
+	_, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, strings.NewReader(payload), strings.NewReader(signature), nil)
+	assert.NoError(t, err)
+}
+
+func verifySSHSignature(t *testing.T, allowedSigners, payload, signature string) {
+	signatureFile := filepath.Join(t.TempDir(), "payload.sig")
+	if err := os.WriteFile(signatureFile, []byte(signature), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", allowedSigners, "-I", testAuthorEmail, "-n", sshSignatureNamespace, "-s", signatureFile)
+	cmd.Stdin = strings.NewReader(payload)
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+}
+
+func TestSigner(t *testing.T) {
+	payload := commitPayload("4b825dc642cb6eb9a060e54bf8d69288fbee4904", []string{"9f8e7d6c5b4a39281706f5e4d3c2b1a098765432"}, CommitAuthor{
+		Name:  testAuthorName,
+		Email: testAuthorEmail,
+		Date:  time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, "fix iac violations\n")
+	assert.Equal(t, "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"+
+		"parent 9f8e7d6c5b4a39281706f5e4d3c2b1a098765432\n"+
+		"author weave bot <bot@weave.works> 1672628645 +0000\n"+
+		"committer weave bot <bot@weave.works> 1672628645 +0000\n"+
+		"\nfix iac violations\n", payload)
+
+	t.Run("gpg", func(t *testing.T) {
+		entity, keyFile := newGPGKey(t)
+		signer, err := NewSigner(SigningConfig{KeyFile: keyFile})
+		if !assert.NoError(t, err) {
+			return
+		}
+		signature, err := signer.Sign([]byte(payload))
+		assert.NoError(t, err)
+		verifyGPGSignature(t, entity, payload, signature)
+	})
+
+	for name, passphrase := range map[string]string{"ssh": "", "ssh with passphrase": "secret"} {
+		passphrase := passphrase
+		t.Run(name, func(t *testing.T) {
+			keyFile, allowedSigners := newSSHKey(t, passphrase)
+			signer, err := NewSigner(SigningConfig{KeyFile: keyFile, Passphrase: passphrase})
+			if !assert.NoError(t, err) {
+				return
+			}
+			signature, err := signer.Sign([]byte(payload))
+			assert.NoError(t, err)
+			verifySSHSignature(t, allowedSigners, payload, signature)
+		})
+	}
+
+	t.Run("invalid key", func(t *testing.T) {
+		keyFile := filepath.Join(t.TempDir(), "key")
+		assert.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0600))
+		_, err := NewSigner(SigningConfig{KeyFile: keyFile})
+		assert.Error(t, err)
+	})
+}
+
+func TestGithubSignedCommit(t *testing.T) {
+	forge, sha := newConformanceForge()
+	server, httpClient := newConformanceServer(t, gittest.NewGithubHandler(forge))
+	p, err := newGithubProvider(forge.Owner, forge.Repo, "token", server.URL, GithubAppConfig{}, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity, keyFile := newGPGKey(t)
+	p.signer, err = NewSigner(SigningConfig{KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.author = CommitAuthor{Name: testAuthorName, Email: testAuthorEmail}
+
+	ctx := context.Background()
+	assert.NoError(t, p.CreateBranch(ctx, "feature", sha))
+	signature, err := p.CreateCommit(ctx, "feature", "fix violations", newConformanceFiles(t))
+	assert.NoError(t, err)
+	assert.Equal(t, &types.CommitSignature{Signed: true, Verified: true, Reason: "valid"}, signature)
+
+	branch, _ := forge.Branch("feature")
+	assert.Contains(t, branch.Payload, "author weave bot <bot@weave.works> ")
+	verifyGPGSignature(t, entity, branch.Payload, branch.Signature)
+}
+
+func TestLocalSignedCommit(t *testing.T) {
+	keyFile, allowedSigners := newSSHKey(t, "")
+	if _, err := exec.LookPath(gitBinary); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	remote, work := filepath.Join(dir, "remote.git"), filepath.Join(dir, "work")
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command(gitBinary, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(work, "deploy"), 0755))
+	run(dir, "init", "--quiet", "--bare", remote)
+	run(work, "init", "--quiet", "--initial-branch", conformanceBase)
+	assert.NoError(t, os.WriteFile(filepath.Join(work, "deploy", "app.yaml"), []byte(conformanceApp), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(work, "README.md"), []byte("# policies"), 0644))
+	run(work, "add", "-A")
+	run(work, "commit", "--quiet", "-m", "initial commit")
+	run(work, "push", "--quiet", remote, conformanceBase, conformanceBase+":"+branchPrefix+conformanceBase)
+	sha := run(work, "rev-parse", "HEAD")
+
+	signer, err := NewSigner(SigningConfig{KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	committer := newLocalCommitter(work, "file://"+filepath.ToSlash(remote), Gitlab, "token", signer, CommitAuthor{Name: testAuthorName, Email: testAuthorEmail})
+	files := newConformanceFiles(t)
+	signature, err := committer.CreateCommit(context.Background(), branchPrefix+conformanceBase, "fix violations", files)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &types.CommitSignature{Signed: true}, signature)
+
+	branch := branchPrefix + conformanceBase
+	assert.Equal(t, sha, run(remote, "rev-parse", branch+"^"))
+	assert.Equal(t, "fix violations", run(remote, "log", "-1", "--format=%s", branch))
+	assert.Equal(t, "# policies", run(remote, "show", branch+":README.md"))
+	for _, file := range files {
+		content, err := file.Content()
+		assert.NoError(t, err)
+		assert.Equal(t, strings.TrimSpace(content), run(remote, "show", branch+":"+file.Path))
+	}
+	run(remote, "-c", "gpg.format=ssh", "-c", "gpg.ssh.allowedSignersFile="+allowedSigners, "verify-commit", branch)
+	assert.Equal(t, "", run(work, "status", "--porcelain"), "working tree should not be modified")
+}
+
+func TestAuthEnv(t *testing.T) {
+	assert.Equal(t, []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic b2F1dGgyOnRva2Vu",
+	}, AuthEnv(Gitlab, "token"))
+	assert.Nil(t, AuthEnv(Gitlab, ""))
+	assert.Nil(t, AuthEnv("unknown", "token"))
+}
@@ -0,0 +1,278 @@
+package git
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout    = 30 * time.Second
+	defaultHTTPMaxRetries = 3
+	retryBaseDelay        = time.Second
+	retryMaxDelay         = 30 * time.Second
+	// responses asking to wait longer than this are returned instead of retried
+	retryMaxWait = time.Minute
+)
+
+// HTTPConfig holds the http client configuration shared by all providers
+type HTTPConfig struct {
+	// Timeout limits the time of each attempt of an api call, waiting between retries is not limited
+	Timeout    time.Duration
+	MaxRetries int
+	ProxyURL   string
+	CAFile     string
+}
+
+// DefaultHTTPConfig returns the default http client configuration
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		Timeout:    defaultHTTPTimeout,
+		MaxRetries: defaultHTTPMaxRetries,
+	}
+}
+
+// TLSConfig returns the tls configuration trusting the configured ca file in addition to the system pool
+func (c HTTPConfig) TLSConfig() (*tls.Config, error) {
+	if c.CAFile == "" {
+		return nil, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	in, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca file, error: %v", err)
+	}
+
+	if !pool.AppendCertsFromPEM(in) {
+		return nil, fmt.Errorf("no certificates found in ca file: %s", c.CAFile)
+	}
+
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// NewHTTPClient returns http client which retries failed and rate limited requests
+func NewHTTPClient(conf HTTPConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if conf.ProxyURL != "" {
+		proxy, err := url.Parse(conf.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %s", conf.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig, err := conf.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	// the timeout is applied per attempt by the transport, a client timeout would also cover the
+	// delays requested by rate limited responses
+	return &http.Client{
+		Transport: &retryTransport{
+			base:       transport,
+			maxRetries: conf.MaxRetries,
+			timeout:    conf.Timeout,
+		},
+	}, nil
+}
+
+// retryTransport retries requests failed due to network errors, server errors or rate limits
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	timeout    time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("cannot retry request with non rewindable body")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		resp, err := t.roundTrip(req)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+
+		if attempt >= t.maxRetries || !shouldRetry(req.Method, resp, err) {
+			return resp, err
+		}
+
+		delay, ok := retryDelay(resp, attempt, time.Now())
+		if !ok {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// roundTrip sends a single attempt of the request limited by the timeout, the timeout covers reading
+// the response body until it is closed
+func (t *retryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody cancels the context of the attempt once the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// shouldRetry checks if the request failed for a transient reason. Requests of non idempotent methods may
+// have been processed when failing with network or server errors, so they are only retried when rate
+// limited
+func shouldRetry(method string, resp *http.Response, err error) bool {
+	if !idempotent(method) {
+		return err == nil && isRateLimited(resp)
+	}
+
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return isRateLimited(resp)
+}
+
+// isRateLimited checks if the request was rejected by the rate limits without being processed
+func isRateLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		// github responds with forbidden when the primary or secondary rate limit is exceeded
+		return resp.Header.Get("Retry-After") != "" || resp.Header.Get("X-RateLimit-Remaining") == "0"
+	}
+	return false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns the time to wait before the next attempt, the server requested delay is honored
+// and reported as not retryable if it is too long
+func retryDelay(resp *http.Response, attempt int, now time.Time) (time.Duration, bool) {
+	if resp != nil {
+		if delay, ok := serverRetryDelay(resp.Header, now); ok {
+			if delay > retryMaxWait {
+				return 0, false
+			}
+			return delay, true
+		}
+	}
+
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	// add up to 50% jitter to avoid retrying in lockstep
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter, true
+}
+
+// serverRetryDelay parses Retry-After and rate limit reset headers
+func serverRetryDelay(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return nonNegative(date.Sub(now)), true
+		}
+	}
+
+	if header.Get("X-RateLimit-Remaining") != "0" && header.Get("RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+
+	for _, name := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		if value := header.Get(name); value != "" {
+			if reset, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return nonNegative(time.Unix(reset, 0).Sub(now)), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		headers  map[string]string
+		retries  int
+		timeout  time.Duration
+		status   int
+		attempts int
+	}{
+		{
+			name:     "retries bad gateway",
+			method:   http.MethodPut,
+			statuses: []int{http.StatusBadGateway, http.StatusOK},
+			retries:  3,
+			status:   http.StatusOK,
+			attempts: 2,
+		},
+		{
+			name:     "does not retry post after bad gateway",
+			method:   http.MethodPost,
+			statuses: []int{http.StatusBadGateway, http.StatusOK},
+			retries:  3,
+			status:   http.StatusBadGateway,
+			attempts: 1,
+		},
+		{
+			name:     "retries rate limited post",
+			method:   http.MethodPost,
+			statuses: []int{http.StatusTooManyRequests, http.StatusCreated},
+			headers:  map[string]string{"Retry-After": "0"},
+			retries:  3,
+			status:   http.StatusCreated,
+			attempts: 2,
+		},
+		{
+			name:     "waits for retry after longer than the timeout",
+			method:   http.MethodPatch,
+			statuses: []int{http.StatusTooManyRequests, http.StatusOK},
+			headers:  map[string]string{"Retry-After": "1"},
+			retries:  3,
+			timeout:  500 * time.Millisecond,
+			status:   http.StatusOK,
+			attempts: 2,
+		},
+		{
+			name:     "honors retry after of secondary rate limit",
+			method:   http.MethodPost,
+			statuses: []int{http.StatusForbidden, http.StatusForbidden, http.StatusCreated},
+			headers:  map[string]string{"Retry-After": "0"},
+			retries:  3,
+			status:   http.StatusCreated,
+			attempts: 3,
+		},
+		{
+			name:     "does not retry forbidden without rate limit",
+			method:   http.MethodPost,
+			statuses: []int{http.StatusForbidden, http.StatusOK},
+			retries:  3,
+			status:   http.StatusForbidden,
+			attempts: 1,
+		},
+		{
+			name:     "does not wait for distant rate limit reset",
+			method:   http.MethodPost,
+			statuses: []int{http.StatusTooManyRequests, http.StatusOK},
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     fmt.Sprint(time.Now().Add(time.Hour).Unix()),
+			},
+			retries:  3,
+			status:   http.StatusTooManyRequests,
+			attempts: 1,
+		},
+		{
+			name:     "stops after max retries",
+			method:   http.MethodPut,
+			statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			headers:  map[string]string{"Retry-After": "0"},
+			retries:  1,
+			status:   http.StatusServiceUnavailable,
+			attempts: 2,
+		},
+	}
+
+	for _, test := range tests {
+		var attempts int
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			status := test.statuses[attempts]
+			attempts++
+			if status != http.StatusOK && status != http.StatusCreated {
+				for k, v := range test.headers {
+					w.Header().Set(k, v)
+				}
+			}
+			w.WriteHeader(status)
+		}))
+
+		timeout := test.timeout
+		if timeout == 0 {
+			timeout = 10 * time.Second
+		}
+		client, err := NewHTTPClient(HTTPConfig{Timeout: timeout, MaxRetries: test.retries})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequestWithContext(context.Background(), test.method, server.URL, strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error, %v", test.name, err)
+		}
+		resp.Body.Close()
+		server.Close()
+
+		assert.Equal(t, test.status, resp.StatusCode, test.name)
+		assert.Equal(t, test.attempts, attempts, test.name)
+		for _, body := range bodies {
+			assert.Equal(t, "payload", body, test.name)
+		}
+	}
+}
+
+func TestServerRetryDelay(t *testing.T) {
+	now := time.Now()
+
+	delay, ok := serverRetryDelay(http.Header{"Retry-After": []string{"5"}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, delay)
+
+	header := http.Header{}
+	header.Set("RateLimit-Remaining", "0")
+	header.Set("RateLimit-Reset", fmt.Sprint(now.Add(10*time.Second).Unix()))
+	delay, ok = serverRetryDelay(header, now)
+	assert.True(t, ok)
+	assert.InDelta(t, 10*time.Second, delay, float64(time.Second))
+
+	_, ok = serverRetryDelay(http.Header{"X-RateLimit-Reset": []string{"1"}}, now)
+	assert.False(t, ok, "reset is ignored while the rate limit is not exhausted")
+}
@@ -51,6 +51,28 @@ func (md *Markdown) Link(text, link string) {
 	md.writeln(fmt.Sprintf("[%s](%s) ", text, link))
 }
 
+// ListItem adds unordered list item
+func (md *Markdown) ListItem(text string, args ...interface{}) {
+	md.writeln(fmt.Sprintf("- %s", fmt.Sprintf(text, args...)))
+}
+
+// Code adds fenced code block
+func (md *Markdown) Code(lang, code string) {
+	md.writeln(fmt.Sprintf("```%s", lang))
+	md.writeln(code)
+	md.writeln("```")
+}
+
+// Details adds collapsible section, the content is written by the given function
+func (md *Markdown) Details(summary string, content func(*Markdown)) {
+	md.writeln("<details>")
+	md.writeln(fmt.Sprintf("<summary>%s</summary>", summary))
+	md.write("\n")
+	content(md)
+	md.writeln("</details>")
+	md.write("\n")
+}
+
 // Table adds table
 func (md *Markdown) Table(columns []string, rows [][]string) {
 	sperator := []string{}
@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+	"github.com/weaveworks/weave-policy-validator/internal/yaml"
+)
+
+const (
+	// ConfigKind is the kind of the PolicyConfig resources
+	ConfigKind = "PolicyConfig"
+
+	helmReleaseKind   = "HelmRelease"
+	kustomizationKind = "Kustomization"
+)
+
+// app labels set by flux on the resources of the helm releases and kustomizations
+var appLabels = map[string][2]string{
+	helmReleaseKind:   {"helm.toolkit.fluxcd.io/name", "helm.toolkit.fluxcd.io/namespace"},
+	kustomizationKind: {"kustomize.toolkit.fluxcd.io/name", "kustomize.toolkit.fluxcd.io/namespace"},
+}
+
+// Config is a PolicyConfig resource overriding the policy parameters of the matching entities
+type Config struct {
+	Name  string
+	Path  string
+	Match domain.PolicyConfigMatch
+	// Parameters are the overridden parameter values by policy id
+	Parameters map[string]map[string]interface{}
+}
+
+type configTarget struct {
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+type policyConfig struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Match struct {
+			Namespaces   []string       `yaml:"namespaces"`
+			Applications []configTarget `yaml:"apps"`
+			Resources    []configTarget `yaml:"resources"`
+		} `yaml:"match"`
+		Config map[string]struct {
+			Parameters map[string]interface{} `yaml:"parameters"`
+		} `yaml:"config"`
+	} `yaml:"spec"`
+}
+
+// ConfigsFromFiles returns the PolicyConfig resources of the files
+func ConfigsFromFiles(files []*types.File) ([]*Config, error) {
+	var configs []*Config
+	for _, file := range files {
+		for _, resource := range file.Resources {
+			if resource.Rendered == nil || resource.Rendered.Kind() != ConfigKind {
+				continue
+			}
+			config, err := configFromResource(resource.Rendered.Node(), file.Path)
+			if err != nil {
+				return nil, err
+			}
+			configs = append(configs, config)
+		}
+	}
+	return configs, nil
+}
+
+func configFromResource(node *yaml.Node, path string) (*Config, error) {
+	var resource policyConfig
+	if err := node.Decode(&resource); err != nil {
+		return nil, fmt.Errorf("invalid %s at %s, error: %v", ConfigKind, path, err)
+	}
+	config := &Config{
+		Name:       resource.Metadata.Name,
+		Path:       path,
+		Parameters: make(map[string]map[string]interface{}),
+	}
+	invalid := func(err error) error {
+		return fmt.Errorf("invalid %s: %s at %s, error: %v", ConfigKind, config.Name, path, err)
+	}
+	if config.Name == "" {
+		return nil, invalid(errors.New("missing name"))
+	}
+
+	match := resource.Spec.Match
+	var targets int
+	for _, count := range []int{len(match.Namespaces), len(match.Applications), len(match.Resources)} {
+		if count > 0 {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return nil, invalid(errors.New("match must have exactly one of namespaces, apps or resources"))
+	}
+	config.Match.Namespaces = match.Namespaces
+	for _, app := range match.Applications {
+		if _, ok := appLabels[app.Kind]; !ok {
+			return nil, invalid(fmt.Errorf("invalid app kind: %s, expected %s or %s", app.Kind, helmReleaseKind, kustomizationKind))
+		}
+		if app.Name == "" {
+			return nil, invalid(errors.New("missing app name"))
+		}
+		config.Match.Applications = append(config.Match.Applications, domain.ConfigMatchApplication(app))
+	}
+	for _, resource := range match.Resources {
+		config.Match.Resources = append(config.Match.Resources, domain.ConfigMatchResource(resource))
+	}
+
+	for policyID, policyConfig := range resource.Spec.Config {
+		config.Parameters[policyID] = policyConfig.Parameters
+	}
+	return config, nil
+}
+
+// ResolveConfig resolves the parameters of the configs matching the entity like the policy agent does in the
+// cluster, configs matching apps override the ones matching namespaces and configs matching resources override
+// both, configs of the same match are applied in name order
+func ResolveConfig(configs []*Config, entity domain.Entity) *domain.PolicyConfig {
+	var namespaces, apps, resources []*Config
+	for _, config := range configs {
+		switch {
+		case len(config.Match.Namespaces) > 0:
+			if config.matchNamespace(entity) {
+				namespaces = append(namespaces, config)
+			}
+		case len(config.Match.Applications) > 0:
+			if config.matchApplication(entity) {
+				apps = append(apps, config)
+			}
+		case len(config.Match.Resources) > 0:
+			if config.matchResource(entity) {
+				resources = append(resources, config)
+			}
+		}
+	}
+	if len(namespaces)+len(apps)+len(resources) == 0 {
+		return nil
+	}
+
+	result := &domain.PolicyConfig{Config: make(map[string]domain.PolicyConfigConfig)}
+	for _, matched := range [][]*Config{namespaces, apps, resources} {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].Name < matched[j].Name
+		})
+		for _, config := range matched {
+			for policyID, parameters := range config.Parameters {
+				policyConfig, ok := result.Config[policyID]
+				if !ok {
+					policyConfig = domain.PolicyConfigConfig{Parameters: make(map[string]domain.PolicyConfigParameter)}
+					result.Config[policyID] = policyConfig
+				}
+				for name, value := range parameters {
+					policyConfig.Parameters[name] = domain.PolicyConfigParameter{
+						Value:     value,
+						ConfigRef: config.Name,
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+func (c *Config) matchNamespace(entity domain.Entity) bool {
+	for _, namespace := range c.Match.Namespaces {
+		if namespace == entity.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) matchApplication(entity domain.Entity) bool {
+	for _, app := range c.Match.Applications {
+		labels := appLabels[app.Kind]
+		if entity.Labels[labels[0]] == app.Name && entity.Labels[labels[1]] == app.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) matchResource(entity domain.Entity) bool {
+	for _, resource := range c.Match.Resources {
+		if resource.Kind == entity.Kind && resource.Name == entity.Name && resource.Namespace == entity.Namespace {
+			return true
+		}
+	}
+	return false
+}
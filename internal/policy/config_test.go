@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/weave-policy-validator/internal/source"
+)
+
+func TestResolveConfig(t *testing.T) {
+	files, err := source.NewKubernetesSource("testdata/configs.yaml").ResourceFiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs, err := ConfigsFromFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, configs, 4)
+
+	const (
+		replicaCount = "weave.policies.containers-minimum-replica-count"
+		privileged   = "weave.policies.containers-running-in-privileged-mode"
+	)
+	releaseLabels := map[string]string{
+		"helm.toolkit.fluxcd.io/name":      "frontend",
+		"helm.toolkit.fluxcd.io/namespace": "flux-system",
+	}
+
+	tests := []struct {
+		name   string
+		entity domain.Entity
+		config map[string]map[string]domain.PolicyConfigParameter
+	}{
+		{
+			name:   "no matching config",
+			entity: domain.Entity{Kind: "Deployment", Name: "frontend", Namespace: "dev"},
+		},
+		{
+			name:   "namespace configs in name order",
+			entity: domain.Entity{Kind: "Deployment", Name: "backend", Namespace: "prod"},
+			config: map[string]map[string]domain.PolicyConfigParameter{
+				replicaCount: {"replica_count": {Value: 3, ConfigRef: "prod-namespace"}},
+				privileged:   {"privilege": {Value: false, ConfigRef: "prod-namespace"}},
+			},
+		},
+		{
+			name:   "app overrides namespace",
+			entity: domain.Entity{Kind: "Deployment", Name: "backend", Namespace: "prod", Labels: releaseLabels},
+			config: map[string]map[string]domain.PolicyConfigParameter{
+				replicaCount: {"replica_count": {Value: 2, ConfigRef: "frontend-release"}},
+				privileged:   {"privilege": {Value: false, ConfigRef: "prod-namespace"}},
+			},
+		},
+		{
+			name:   "resource overrides app and namespace",
+			entity: domain.Entity{Kind: "Deployment", Name: "frontend", Namespace: "prod", Labels: releaseLabels},
+			config: map[string]map[string]domain.PolicyConfigParameter{
+				replicaCount: {"replica_count": {Value: 2, ConfigRef: "frontend-release"}},
+				privileged:   {"privilege": {Value: true, ConfigRef: "frontend-deployment"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := ResolveConfig(configs, test.entity)
+			if test.config == nil {
+				assert.Nil(t, config)
+				return
+			}
+			if !assert.NotNil(t, config) {
+				return
+			}
+			parameters := make(map[string]map[string]domain.PolicyConfigParameter)
+			for policyID, policyConfig := range config.Config {
+				parameters[policyID] = policyConfig.Parameters
+			}
+			assert.Equal(t, test.config, parameters)
+		})
+	}
+}
+
+func TestConfigsFromFilesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "multiple match targets",
+			content: `kind: PolicyConfig
+metadata:
+  name: config
+spec:
+  match:
+    namespaces: [prod]
+    resources:
+      - kind: Deployment
+        name: frontend
+`,
+		},
+		{
+			name: "invalid app kind",
+			content: `kind: PolicyConfig
+metadata:
+  name: config
+spec:
+  match:
+    apps:
+      - kind: Deployment
+        name: frontend
+`,
+		},
+		{
+			name: "missing name",
+			content: `kind: PolicyConfig
+spec:
+  match:
+    namespaces: [prod]
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(test.content), 0644))
+			files, err := source.NewKubernetesSource(path).ResourceFiles(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ConfigsFromFiles(files)
+			assert.Error(t, err)
+		})
+	}
+}
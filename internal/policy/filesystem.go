@@ -5,11 +5,24 @@ import (
 	"fmt"
 
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/weave-policy-validator/internal/exception"
 	"github.com/weaveworks/weave-policy-validator/internal/source"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+const (
+	// KubernetesProvider is the provider of the policies validating kubernetes resources
+	KubernetesProvider = "kubernetes"
+
+	providerField = "spec.provider"
 )
 
 type FilesystemPolicySource struct {
-	source source.Source
+	source     source.Source
+	configs    []*Config
+	parameters []Parameter
+	mode       string
+	warnOnly   []string
 }
 
 // NewFilesystemSource creates new Policy filesystem source
@@ -19,28 +32,79 @@ func NewFilesystemSource(source source.Source) *FilesystemPolicySource {
 	}
 }
 
-// GetAll gets all policies
+// GetAll gets all policies with their overridden parameters, the overrides are checked against all the
+// policies including the ones not applying to the mode or to kubernetes
 func (l *FilesystemPolicySource) GetAll(ctx context.Context) ([]domain.Policy, error) {
 	files, err := l.source.ResourceFiles(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get kustomization resources, error: %v", err)
 	}
 	var policies []domain.Policy
+	var applied []bool
 	for _, file := range files {
 		for _, resource := range file.Resources {
-			if resource.Rendered == nil {
+			// policy exceptions and configs are kept alongside the policies
+			if resource.Rendered == nil || resource.Rendered.Kind() == exception.Kind || resource.Rendered.Kind() == ConfigKind {
 				continue
 			}
 			policy, err := resource.Rendered.Policy()
 			if err != nil {
 				return nil, err
 			}
+			if matchIDs(l.warnOnly, policy.ID) && !matchAny(policy.Modes, types.ModeWarnOnly) {
+				policy.Modes = append(policy.Modes, types.ModeWarnOnly)
+			}
 			policies = append(policies, policy)
+			applied = append(applied, l.applies(resource.Rendered, policy))
+		}
+	}
+	if err := applyParameters(policies, l.parameters); err != nil {
+		return nil, err
+	}
+	result := policies[:0]
+	for i := range policies {
+		if applied[i] {
+			result = append(result, policies[i])
+		}
+	}
+	return result, nil
+}
+
+// SetParameters sets the overrides of the policy parameters, later overrides take precedence
+func (l *FilesystemPolicySource) SetParameters(parameters []Parameter) {
+	l.parameters = parameters
+}
+
+// SetMode sets the mode of the validation trigger, policies declaring modes apply only if they declare the
+// mode or the warn-only mode
+func (l *FilesystemPolicySource) SetMode(mode string) {
+	l.mode = mode
+}
+
+// SetWarnOnly sets the globs of the ids of the policies reporting violations without failing the validation
+func (l *FilesystemPolicySource) SetWarnOnly(globs []string) {
+	l.warnOnly = globs
+}
+
+// applies reports whether the policy applies to the kubernetes resources in the mode of the trigger
+func (l *FilesystemPolicySource) applies(object *types.Object, policy domain.Policy) bool {
+	if provider, err := object.GetField(providerField); err == nil && provider != nil {
+		if value := provider.YNode().Value; value != "" && value != KubernetesProvider {
+			return false
 		}
 	}
-	return policies, nil
+	if l.mode == "" || len(policy.Modes) == 0 {
+		return true
+	}
+	return matchAny(policy.Modes, l.mode) || matchAny(policy.Modes, types.ModeWarnOnly)
+}
+
+// SetConfigs sets the policy configs overriding the policy parameters
+func (l *FilesystemPolicySource) SetConfigs(configs []*Config) {
+	l.configs = configs
 }
 
+// GetPolicyConfig gets the parameters of the policy configs matching the entity
 func (l *FilesystemPolicySource) GetPolicyConfig(ctx context.Context, entity domain.Entity) (*domain.PolicyConfig, error) {
-	return nil, nil
+	return ResolveConfig(l.configs, entity), nil
 }
@@ -203,3 +203,60 @@ func TestFileSystemPolicySource(t *testing.T) {
 		}
 	}
 }
+
+func TestFileSystemPolicySourceModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		warnOnly []string
+		policies map[string][]string
+	}{
+		{
+			name: "all modes",
+			policies: map[string][]string{
+				"weave.policies.no-modes":  nil,
+				"weave.policies.admission": {"admission", "audit"},
+				"weave.policies.iac":       {"iac", "admission"},
+				"weave.policies.warn-only": {"warn-only"},
+			},
+		},
+		{
+			name: "iac mode",
+			mode: "iac",
+			policies: map[string][]string{
+				"weave.policies.no-modes":  nil,
+				"weave.policies.iac":       {"iac", "admission"},
+				"weave.policies.warn-only": {"warn-only"},
+			},
+		},
+		{
+			name:     "warn-only policies",
+			mode:     "iac",
+			warnOnly: []string{"weave.policies.i*"},
+			policies: map[string][]string{
+				"weave.policies.no-modes":  nil,
+				"weave.policies.iac":       {"iac", "admission", "warn-only"},
+				"weave.policies.warn-only": {"warn-only"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policySource := NewFilesystemSource(source.NewKubernetesSource("testdata/modes"))
+			policySource.SetMode(test.mode)
+			policySource.SetWarnOnly(test.warnOnly)
+			// overrides of the policies not applying to the mode are valid
+			policySource.SetParameters([]Parameter{{Policy: "weave.policies.admission", Name: "replica_count", Value: "3"}})
+			policies, err := policySource.GetAll(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			modes := make(map[string][]string)
+			for _, policy := range policies {
+				modes[policy.ID] = policy.Modes
+			}
+			assert.Equal(t, test.policies, modes)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package policy
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/weave-policy-validator/internal/yaml"
+)
+
+// Parameter overrides the value of a policy parameter, values parsed from strings are converted to the
+// declared type of the parameter
+type Parameter struct {
+	Policy string
+	Name   string
+	Value  interface{}
+	// Source is the origin of the override reported as the config reference of the parameter
+	Source string
+}
+
+// ParseParameter parses the policy.name=value override, policy ids contain dots so the last dot before the
+// value separates the parameter name
+func ParseParameter(value, source string) (Parameter, error) {
+	key, value, ok := strings.Cut(value, "=")
+	i := strings.LastIndex(key, ".")
+	if !ok || i <= 0 || i == len(key)-1 {
+		return Parameter{}, fmt.Errorf("invalid policy parameter: %s, expected policy.name=value", key)
+	}
+	return Parameter{Policy: key[:i], Name: key[i+1:], Value: value, Source: source}, nil
+}
+
+// ParametersFromMap returns the overrides of the parameters by policy id sorted by policy and name
+func ParametersFromMap(values map[string]map[string]interface{}, source string) []Parameter {
+	var parameters []Parameter
+	for policyID, policyValues := range values {
+		for name, value := range policyValues {
+			parameters = append(parameters, Parameter{Policy: policyID, Name: name, Value: value, Source: source})
+		}
+	}
+	sort.Slice(parameters, func(i, j int) bool {
+		if parameters[i].Policy != parameters[j].Policy {
+			return parameters[i].Policy < parameters[j].Policy
+		}
+		return parameters[i].Name < parameters[j].Name
+	})
+	return parameters
+}
+
+// applyParameters overrides the parameters of the policies, overrides of unknown policies or parameters
+// and values not matching the declared types are invalid
+func applyParameters(policies []domain.Policy, parameters []Parameter) error {
+	index := make(map[string]int)
+	for i := range policies {
+		index[policies[i].ID] = i
+	}
+	for _, parameter := range parameters {
+		i, ok := index[parameter.Policy]
+		if !ok {
+			return fmt.Errorf("invalid policy parameter: %s.%s, unknown policy", parameter.Policy, parameter.Name)
+		}
+		var found bool
+		for j := range policies[i].Parameters {
+			declared := &policies[i].Parameters[j]
+			if declared.Name != parameter.Name {
+				continue
+			}
+			value, err := convertParameter(declared.Type, parameter.Value)
+			if err != nil {
+				return fmt.Errorf("invalid policy parameter: %s.%s, error: %v", parameter.Policy, parameter.Name, err)
+			}
+			declared.Value = value
+			declared.ConfigRef = parameter.Source
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("invalid policy parameter: %s.%s, unknown parameter", parameter.Policy, parameter.Name)
+		}
+	}
+	return nil
+}
+
+// convertParameter converts the value to the declared parameter type, strings are parsed
+func convertParameter(kind string, value interface{}) (interface{}, error) {
+	raw, isString := value.(string)
+	switch kind {
+	case "string":
+		if !isString {
+			return nil, fmt.Errorf("expected string, found: %v", value)
+		}
+		return raw, nil
+	case "integer":
+		if isString {
+			integer, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("expected integer, found: %s", raw)
+			}
+			return integer, nil
+		}
+		switch number := value.(type) {
+		case int, int64, uint64:
+			return number, nil
+		case float64:
+			if number == math.Trunc(number) {
+				return int(number), nil
+			}
+		}
+		return nil, fmt.Errorf("expected integer, found: %v", value)
+	case "boolean":
+		if isString {
+			boolean, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("expected boolean, found: %s", raw)
+			}
+			return boolean, nil
+		}
+		if _, ok := value.(bool); !ok {
+			return nil, fmt.Errorf("expected boolean, found: %v", value)
+		}
+		return value, nil
+	case "array":
+		if isString {
+			var parsed interface{}
+			if err := yaml.Unmarshal([]byte(raw), &parsed); err == nil {
+				if items, ok := parsed.([]interface{}); ok {
+					return items, nil
+				}
+			}
+			var items []interface{}
+			for _, item := range strings.Split(raw, ",") {
+				items = append(items, strings.TrimSpace(item))
+			}
+			return items, nil
+		}
+		if _, ok := value.([]interface{}); !ok {
+			return nil, fmt.Errorf("expected array, found: %v", value)
+		}
+		return value, nil
+	default:
+		// parameters of other types are passed as parsed
+		if isString {
+			var parsed interface{}
+			if err := yaml.Unmarshal([]byte(raw), &parsed); err == nil {
+				return parsed, nil
+			}
+		}
+		return value, nil
+	}
+}
+
+// WriteParameters writes the effective parameters of the policies and the sources of their overrides
+func WriteParameters(w io.Writer, policies []domain.Policy) error {
+	if _, err := fmt.Fprintln(w, "Policy parameters", ":"); err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if _, err := fmt.Fprintln(w, "-", policy.ID); err != nil {
+			return err
+		}
+		for _, parameter := range policy.Parameters {
+			line := fmt.Sprintf("    %s (%s): %v", parameter.Name, parameter.Type, parameter.Value)
+			if parameter.ConfigRef != "" {
+				line += fmt.Sprintf(" [%s]", parameter.ConfigRef)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+)
+
+func TestParseParameter(t *testing.T) {
+	parameter, err := ParseParameter("weave.policies.containers-minimum-replica-count.replica_count=3", "--policy-param")
+	assert.NoError(t, err)
+	assert.Equal(t, Parameter{
+		Policy: "weave.policies.containers-minimum-replica-count",
+		Name:   "replica_count",
+		Value:  "3",
+		Source: "--policy-param",
+	}, parameter)
+
+	for _, value := range []string{"replica_count=3", "weave.policies.replicas.=3", ".replica_count=3", "weave.policies.replicas.replica_count"} {
+		_, err := ParseParameter(value, "--policy-param")
+		assert.Error(t, err, value)
+	}
+}
+
+func TestApplyParameters(t *testing.T) {
+	newPolicies := func() []domain.Policy {
+		return []domain.Policy{{
+			ID: "weave.policies.containers",
+			Parameters: []domain.PolicyParameters{
+				{Name: "replica_count", Type: "integer", Value: 2},
+				{Name: "privilege", Type: "boolean", Value: false},
+				{Name: "registry", Type: "string", Value: "docker.io"},
+				{Name: "capabilities", Type: "array", Value: []interface{}{"NET_ADMIN"}},
+			},
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		parameters []Parameter
+		values     map[string]interface{}
+		err        bool
+	}{
+		{
+			name: "flag values are converted",
+			parameters: []Parameter{
+				{Policy: "weave.policies.containers", Name: "replica_count", Value: "3", Source: "--policy-param"},
+				{Policy: "weave.policies.containers", Name: "privilege", Value: "true", Source: "--policy-param"},
+				{Policy: "weave.policies.containers", Name: "registry", Value: "ghcr.io", Source: "--policy-param"},
+				{Policy: "weave.policies.containers", Name: "capabilities", Value: "SYS_TIME, NET_RAW", Source: "--policy-param"},
+			},
+			values: map[string]interface{}{
+				"replica_count": 3,
+				"privilege":     true,
+				"registry":      "ghcr.io",
+				"capabilities":  []interface{}{"SYS_TIME", "NET_RAW"},
+			},
+		},
+		{
+			name: "config values are checked",
+			parameters: []Parameter{
+				{Policy: "weave.policies.containers", Name: "replica_count", Value: 1, Source: "weave.yaml"},
+				{Policy: "weave.policies.containers", Name: "capabilities", Value: []interface{}{"SYS_TIME"}, Source: "weave.yaml"},
+			},
+			values: map[string]interface{}{
+				"replica_count": 1,
+				"privilege":     false,
+				"registry":      "docker.io",
+				"capabilities":  []interface{}{"SYS_TIME"},
+			},
+		},
+		{
+			name: "later overrides take precedence",
+			parameters: []Parameter{
+				{Policy: "weave.policies.containers", Name: "replica_count", Value: 1, Source: "weave.yaml"},
+				{Policy: "weave.policies.containers", Name: "replica_count", Value: "4", Source: "--policy-param"},
+			},
+			values: map[string]interface{}{
+				"replica_count": 4,
+				"privilege":     false,
+				"registry":      "docker.io",
+				"capabilities":  []interface{}{"NET_ADMIN"},
+			},
+		},
+		{name: "invalid integer", parameters: []Parameter{{Policy: "weave.policies.containers", Name: "replica_count", Value: "two"}}, err: true},
+		{name: "invalid boolean", parameters: []Parameter{{Policy: "weave.policies.containers", Name: "privilege", Value: 1}}, err: true},
+		{name: "invalid string", parameters: []Parameter{{Policy: "weave.policies.containers", Name: "registry", Value: true}}, err: true},
+		{name: "unknown policy", parameters: []Parameter{{Policy: "weave.policies.unknown", Name: "replica_count", Value: "3"}}, err: true},
+		{name: "unknown parameter", parameters: []Parameter{{Policy: "weave.policies.containers", Name: "replicas", Value: "3"}}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policies := newPolicies()
+			err := applyParameters(policies, test.parameters)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.values, policies[0].GetParametersMap())
+		})
+	}
+}
+
+func TestWriteParameters(t *testing.T) {
+	var out bytes.Buffer
+	err := WriteParameters(&out, []domain.Policy{{
+		ID: "weave.policies.containers-minimum-replica-count",
+		Parameters: []domain.PolicyParameters{
+			{Name: "replica_count", Type: "integer", Value: 3, ConfigRef: "--policy-param"},
+			{Name: "exclude_namespaces", Type: "array", Value: []interface{}{"kube-system"}},
+		},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, `Policy parameters :
+- weave.policies.containers-minimum-replica-count
+    replica_count (integer): 3 [--policy-param]
+    exclude_namespaces (array): [kube-system]
+`, out.String())
+}
@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+// SelectedPolicySource filters the policies of the source by the policy selection
+type SelectedPolicySource struct {
+	source    domain.PoliciesSource
+	selection types.PolicySelection
+	selected  []string
+}
+
+// NewSelectedSource creates new policy source of the selected policies of the source
+func NewSelectedSource(source domain.PoliciesSource, selection types.PolicySelection) *SelectedPolicySource {
+	return &SelectedPolicySource{
+		source:    source,
+		selection: selection,
+	}
+}
+
+// GetAll gets the selected policies
+func (s *SelectedPolicySource) GetAll(ctx context.Context) ([]domain.Policy, error) {
+	policies, err := s.source.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policies = Select(policies, s.selection)
+	s.selected = make([]string, len(policies))
+	for i := range policies {
+		s.selected[i] = policies[i].ID
+	}
+	return policies, nil
+}
+
+// GetPolicyConfig gets the policy config of the source
+func (s *SelectedPolicySource) GetPolicyConfig(ctx context.Context, entity domain.Entity) (*domain.PolicyConfig, error) {
+	return s.source.GetPolicyConfig(ctx, entity)
+}
+
+// Selected returns the ids of the policies selected by the last GetAll
+func (s *SelectedPolicySource) Selected() []string {
+	return s.selected
+}
+
+// Select returns the policies matching the include selector and none of the exclude selector values
+func Select(policies []domain.Policy, selection types.PolicySelection) []domain.Policy {
+	var selected []domain.Policy
+	for _, policy := range policies {
+		if !include(selection.Include, policy) || exclude(selection.Exclude, policy) {
+			continue
+		}
+		selected = append(selected, policy)
+	}
+	return selected
+}
+
+// ParseSelector parses the field=value selectors, fields are id, category, tag, severity and standard
+func ParseSelector(values []string) (types.PolicySelector, error) {
+	var selector types.PolicySelector
+	for _, item := range values {
+		field, value, ok := strings.Cut(item, "=")
+		if !ok || value == "" {
+			return selector, fmt.Errorf("invalid policy selector: %s, expected field=value", item)
+		}
+		switch field {
+		case "id":
+			selector.IDs = append(selector.IDs, value)
+		case "category":
+			selector.Categories = append(selector.Categories, value)
+		case "tag":
+			selector.Tags = append(selector.Tags, value)
+		case "severity":
+			selector.Severities = append(selector.Severities, value)
+		case "standard":
+			selector.Standards = append(selector.Standards, value)
+		default:
+			return selector, fmt.Errorf("invalid policy selector field: %s, expected id, category, tag, severity or standard", field)
+		}
+	}
+	return selector, nil
+}
+
+// ValidateSelection validates the id globs and severities of the selection
+func ValidateSelection(selection types.PolicySelection) error {
+	for _, selector := range []types.PolicySelector{selection.Include, selection.Exclude} {
+		for _, glob := range selector.IDs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("invalid policy id glob: %s", glob)
+			}
+		}
+		for _, severity := range selector.Severities {
+			if _, ok := types.SeverityLevels[severity]; !ok {
+				return fmt.Errorf("invalid policy severity: %s", severity)
+			}
+		}
+	}
+	return nil
+}
+
+// include reports whether the policy matches one of the values of each non empty field of the selector
+func include(selector types.PolicySelector, policy domain.Policy) bool {
+	if len(selector.IDs) > 0 && !matchIDs(selector.IDs, policy.ID) {
+		return false
+	}
+	if len(selector.Categories) > 0 && !matchAny(selector.Categories, policy.Category) {
+		return false
+	}
+	if len(selector.Tags) > 0 && !matchAny(selector.Tags, policy.Tags...) {
+		return false
+	}
+	if len(selector.Severities) > 0 && !matchAny(selector.Severities, policy.Severity) {
+		return false
+	}
+	if len(selector.Standards) > 0 && !matchStandards(selector.Standards, policy.Standards) {
+		return false
+	}
+	return true
+}
+
+// exclude reports whether the policy matches any value of the selector
+func exclude(selector types.PolicySelector, policy domain.Policy) bool {
+	return matchIDs(selector.IDs, policy.ID) ||
+		matchAny(selector.Categories, policy.Category) ||
+		matchAny(selector.Tags, policy.Tags...) ||
+		matchAny(selector.Severities, policy.Severity) ||
+		matchStandards(selector.Standards, policy.Standards)
+}
+
+func matchIDs(globs []string, id string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(values []string, items ...string) bool {
+	for _, value := range values {
+		for _, item := range items {
+			if value == item {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchStandards matches standard ids optionally followed by /control
+func matchStandards(values []string, standards []domain.PolicyStandard) bool {
+	for _, value := range values {
+		id, control, hasControl := strings.Cut(value, "/")
+		for _, standard := range standards {
+			if standard.ID != id {
+				continue
+			}
+			if !hasControl || matchAny([]string{control}, standard.Controls...) {
+				return true
+			}
+		}
+	}
+	return false
+}
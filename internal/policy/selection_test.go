@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+func TestSelect(t *testing.T) {
+	policies := []domain.Policy{
+		{
+			ID:        "weave.policies.containers-running-in-privileged-mode",
+			Category:  "weave.categories.pod-security",
+			Tags:      []string{"pci-dss", "cis-benchmark"},
+			Severity:  "high",
+			Standards: []domain.PolicyStandard{{ID: "weave.standards.pci-dss", Controls: []string{"weave.controls.pci-dss.2.2.4"}}},
+		},
+		{
+			ID:       "weave.policies.containers-minimum-replica-count",
+			Category: "weave.categories.reliability",
+			Tags:     []string{"experimental"},
+			Severity: "medium",
+		},
+		{
+			ID:        "weave.policies.containers-read-only-root-filesystem",
+			Category:  "weave.categories.pod-security",
+			Severity:  "low",
+			Standards: []domain.PolicyStandard{{ID: "weave.standards.pci-dss", Controls: []string{"weave.controls.pci-dss.2.2.5"}}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		selection types.PolicySelection
+		selected  []string
+	}{
+		{
+			name:     "empty selection",
+			selected: []string{"weave.policies.containers-running-in-privileged-mode", "weave.policies.containers-minimum-replica-count", "weave.policies.containers-read-only-root-filesystem"},
+		},
+		{
+			name:      "include id glob",
+			selection: types.PolicySelection{Include: types.PolicySelector{IDs: []string{"weave.policies.containers-r*"}}},
+			selected:  []string{"weave.policies.containers-running-in-privileged-mode", "weave.policies.containers-read-only-root-filesystem"},
+		},
+		{
+			name: "include fields must all match",
+			selection: types.PolicySelection{Include: types.PolicySelector{
+				Categories: []string{"weave.categories.pod-security"},
+				Severities: []string{"high", "medium"},
+			}},
+			selected: []string{"weave.policies.containers-running-in-privileged-mode"},
+		},
+		{
+			name:      "include tag",
+			selection: types.PolicySelection{Include: types.PolicySelector{Tags: []string{"experimental", "cis-benchmark"}}},
+			selected:  []string{"weave.policies.containers-running-in-privileged-mode", "weave.policies.containers-minimum-replica-count"},
+		},
+		{
+			name:      "include standard",
+			selection: types.PolicySelection{Include: types.PolicySelector{Standards: []string{"weave.standards.pci-dss"}}},
+			selected:  []string{"weave.policies.containers-running-in-privileged-mode", "weave.policies.containers-read-only-root-filesystem"},
+		},
+		{
+			name:      "include standard control",
+			selection: types.PolicySelection{Include: types.PolicySelector{Standards: []string{"weave.standards.pci-dss/weave.controls.pci-dss.2.2.5"}}},
+			selected:  []string{"weave.policies.containers-read-only-root-filesystem"},
+		},
+		{
+			name:      "exclude any field",
+			selection: types.PolicySelection{Exclude: types.PolicySelector{Tags: []string{"experimental"}, Severities: []string{"low"}}},
+			selected:  []string{"weave.policies.containers-running-in-privileged-mode"},
+		},
+		{
+			name: "exclude overrides include",
+			selection: types.PolicySelection{
+				Include: types.PolicySelector{Categories: []string{"weave.categories.pod-security"}},
+				Exclude: types.PolicySelector{IDs: []string{"*privileged-mode"}},
+			},
+			selected: []string{"weave.policies.containers-read-only-root-filesystem"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var selected []string
+			for _, policy := range Select(policies, test.selection) {
+				selected = append(selected, policy.ID)
+			}
+			assert.Equal(t, test.selected, selected)
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	selector, err := ParseSelector([]string{
+		"id=weave.policies.*",
+		"category=weave.categories.pod-security",
+		"tag=pci-dss",
+		"severity=high",
+		"standard=weave.standards.pci-dss/weave.controls.pci-dss.2.2.4",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, types.PolicySelector{
+		IDs:        []string{"weave.policies.*"},
+		Categories: []string{"weave.categories.pod-security"},
+		Tags:       []string{"pci-dss"},
+		Severities: []string{"high"},
+		Standards:  []string{"weave.standards.pci-dss/weave.controls.pci-dss.2.2.4"},
+	}, selector)
+
+	for _, value := range []string{"weave.policies.*", "id=", "owner=@platform"} {
+		_, err := ParseSelector([]string{value})
+		assert.Error(t, err, value)
+	}
+
+	assert.Error(t, ValidateSelection(types.PolicySelection{Include: types.PolicySelector{IDs: []string{"weave.policies.["}}}))
+	assert.Error(t, ValidateSelection(types.PolicySelection{Exclude: types.PolicySelector{Severities: []string{"severe"}}}))
+}
@@ -1,8 +1,25 @@
 package sarif
 
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
 const (
 	schema  = "http://json.schemastore.org/sarif-2.1.0-rtm.4"
 	version = "2.1.0"
+
+	// SourceRootID is the uri base id of the locations relative to the repository root
+	SourceRootID = "%SRCROOT%"
+
+	// FingerprintKey is the partial fingerprint key of the violation fingerprints
+	FingerprintKey = "weaveFingerprint/v1"
+
+	// SuppressionInSource is the kind of suppressions declared in the scanned files
+	SuppressionInSource = "inSource"
+	// SuppressionExternal is the kind of suppressions declared outside of the scanned files
+	SuppressionExternal = "external"
 )
 
 type Report struct {
@@ -12,8 +29,10 @@ type Report struct {
 }
 
 type Run struct {
-	Tool    Tool      `json:"tool"`
-	Results []*Result `json:"results"`
+	Tool               Tool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]ArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []*Result                   `json:"results"`
+	Properties         map[string]interface{}      `json:"properties,omitempty"`
 }
 
 type Tool struct {
@@ -39,11 +58,18 @@ type Rule struct {
 }
 
 type Result struct {
-	RuleID              string              `json:"ruleId"`
-	Message             Text                `json:"message"`
-	Locations           []Location          `json:"locations"`
-	Level               string              `json:"level"`
-	PartialFingerprints PartialFingerprints `json:"partialFingerprints"`
+	RuleID              string                 `json:"ruleId"`
+	Message             Text                   `json:"message"`
+	Locations           []Location             `json:"locations"`
+	Level               string                 `json:"level"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+	Suppressions        []Suppression          `json:"suppressions,omitempty"`
+}
+
+type Suppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
 }
 
 type Location struct {
@@ -56,7 +82,8 @@ type PhysicalLocation struct {
 }
 
 type ArtifactLocation struct {
-	URI string `json:"uri"`
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
 }
 
 type Region struct {
@@ -66,10 +93,6 @@ type Region struct {
 	EndColumn   int `json:"endColumn"`
 }
 
-type PartialFingerprints struct {
-	PrimaryLocationLineHash string `json:"primaryLocationLineHash"`
-}
-
 // New creates a new report
 func New() *Report {
 	return &Report{
@@ -95,6 +118,30 @@ func (rprt *Report) AddRun(name string) *Run {
 	return run
 }
 
+// SetSourceRoot sets the absolute directory the locations of the SourceRootID base id are relative to
+func (rn *Run) SetSourceRoot(dir string) {
+	path := filepath.ToSlash(dir)
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	uri := url.URL{Scheme: "file", Path: path}
+	rn.OriginalURIBaseIDs = map[string]ArtifactLocation{
+		SourceRootID: {URI: uri.String()},
+	}
+}
+
+// SetProperty sets run property
+func (rn *Run) SetProperty(key string, value interface{}) *Run {
+	if rn.Properties == nil {
+		rn.Properties = make(map[string]interface{})
+	}
+	rn.Properties[key] = value
+	return rn
+}
+
 // AddRule adds a new rule to the report
 func (rn *Run) AddRule(id, name, description, help string) *Rule {
 	rule := Rule{
@@ -128,11 +175,12 @@ func (rn *Run) AddResult(ruleID, message, level string) *Result {
 }
 
 // SetResultLocation sets violation location
-func (rs *Result) SetResultLocation(file string, startLine, endLine int) *Result {
+func (rs *Result) SetResultLocation(file, uriBaseID string, startLine, endLine int) *Result {
 	location := Location{
 		PhysicalLocation: PhysicalLocation{
 			ArtifactLocation: ArtifactLocation{
-				URI: file,
+				URI:       file,
+				URIBaseID: uriBaseID,
 			},
 			Region: Region{
 				StartLine:   startLine,
@@ -145,3 +193,30 @@ func (rs *Result) SetResultLocation(file string, startLine, endLine int) *Result
 	rs.Locations = []Location{location}
 	return rs
 }
+
+// SetProperty sets result property
+func (rs *Result) SetProperty(key string, value interface{}) *Result {
+	if rs.Properties == nil {
+		rs.Properties = make(map[string]interface{})
+	}
+	rs.Properties[key] = value
+	return rs
+}
+
+// AddSuppression marks the result as suppressed
+func (rs *Result) AddSuppression(kind, justification string) *Result {
+	rs.Suppressions = append(rs.Suppressions, Suppression{
+		Kind:          kind,
+		Justification: justification,
+	})
+	return rs
+}
+
+// SetPartialFingerprint sets result partial fingerprint
+func (rs *Result) SetPartialFingerprint(key, value string) *Result {
+	if rs.PartialFingerprints == nil {
+		rs.PartialFingerprints = make(map[string]string)
+	}
+	rs.PartialFingerprints[key] = value
+	return rs
+}
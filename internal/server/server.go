@@ -0,0 +1,175 @@
+// Package server runs the validator as a service validating pull requests on webhook events
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	DefaultConcurrency = 2
+	DefaultQueueSize   = 100
+)
+
+// ErrQueueFull is returned when the job queue has no capacity left
+var ErrQueueFull = errors.New("job queue is full")
+
+// Job is a pull request validation job
+type Job struct {
+	Provider     string
+	RepoURL      string
+	CloneURL     string
+	BaseCloneURL string
+	Branch       string
+	BaseBranch   string
+	SHA          string
+	PullRequest  int
+	// Fork is set when the head branch belongs to another repository than the pull request
+	Fork bool
+}
+
+// key returns the pull request the job belongs to
+func (j Job) key() string {
+	return fmt.Sprintf("%s#%d", j.RepoURL, j.PullRequest)
+}
+
+// RunFunc validates the job head checked out into dir
+type RunFunc func(ctx context.Context, job Job, dir string) error
+
+// Config holds server configuration
+type Config struct {
+	// Workspace is the directory jobs are checked out into, defaults to the temp directory
+	Workspace   string
+	Concurrency int
+	QueueSize   int
+	// Token authenticates checkouts of private repositories
+	Token string
+
+	GithubWebhookSecret    string
+	GitlabWebhookToken     string
+	BitbucketWebhookSecret string
+}
+
+type Server struct {
+	conf   Config
+	run    RunFunc
+	queue  chan Job
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	latest map[string]string
+}
+
+// New returns new server running the given function for every accepted job
+func New(conf Config, run RunFunc) *Server {
+	if conf.Workspace == "" {
+		conf.Workspace = os.TempDir()
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = DefaultConcurrency
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = DefaultQueueSize
+	}
+	return &Server{
+		conf:   conf,
+		run:    run,
+		queue:  make(chan Job, conf.QueueSize),
+		latest: make(map[string]string),
+	}
+}
+
+// Handler returns the webhooks http handler
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("/webhooks/github", s.webhookHandler(s.parseGithubWebhook))
+	mux.Handle("/webhooks/gitlab", s.webhookHandler(s.parseGitlabWebhook))
+	mux.Handle("/webhooks/bitbucket", s.webhookHandler(s.parseBitbucketWebhook))
+	return mux
+}
+
+// Start starts the workers processing the queued jobs until Shutdown is called
+func (s *Server) Start(ctx context.Context) {
+	queue := s.queue
+	for i := 0; i < s.conf.Concurrency; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for job := range queue {
+				s.process(ctx, job)
+			}
+		}()
+	}
+}
+
+// Shutdown stops accepting jobs and waits for the queued jobs to be processed
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	close(s.queue)
+	s.queue = nil
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Enqueue queues the job, queued jobs of the same pull request are superseded by the new one
+func (s *Server) Enqueue(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue == nil {
+		return errors.New("server is shutting down")
+	}
+
+	select {
+	case s.queue <- job:
+		s.latest[job.key()] = job.SHA
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// superseded reports whether a newer job of the same pull request was queued
+func (s *Server) superseded(job Job) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest[job.key()] != job.SHA
+}
+
+func (s *Server) done(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest[job.key()] == job.SHA {
+		delete(s.latest, job.key())
+	}
+}
+
+func (s *Server) process(ctx context.Context, job Job) {
+	if s.superseded(job) {
+		log.Printf("skipping superseded job, pull request: %s, sha: %s", job.key(), job.SHA)
+		return
+	}
+	defer s.done(job)
+
+	log.Printf("validating pull request: %s, sha: %s", job.key(), job.SHA)
+	dir, err := checkout(ctx, s.conf.Workspace, s.conf.Token, &job)
+	if dir != "" {
+		defer os.RemoveAll(dir)
+	}
+	if err != nil {
+		log.Printf("failed to checkout pull request: %s, error: %v", job.key(), err)
+		return
+	}
+
+	if err := s.run(ctx, job, dir); err != nil {
+		log.Printf("failed to validate pull request: %s, error: %v", job.key(), err)
+		return
+	}
+	log.Printf("validated pull request: %s, sha: %s", job.key(), job.SHA)
+}
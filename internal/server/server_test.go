@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSecret = "secret"
+	// recordedSHA is the head commit sha of the recorded payloads
+	recordedSHA = "9f8e7d6c5b4a39281706f5e4d3c2b1a098765432"
+)
+
+type testRepo struct {
+	dir      string
+	baseSHA  string
+	headSHA  string
+	hostURLs *strings.Replacer
+}
+
+type testRun struct {
+	job     Job
+	content string
+}
+
+// newTestRepo creates bare repository with main and feature branches, the recorded payloads
+// repository urls are rewritten to the local repository
+func newTestRepo(t *testing.T) *testRepo {
+	if _, err := exec.LookPath(gitBinary); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	bare := filepath.Join(dir, "weaveworks", "policies.git")
+	work := filepath.Join(dir, "work")
+
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command(gitBinary, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(content string) {
+		path := filepath.Join(work, "deploy", "app.yaml")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.MkdirAll(bare, 0755); err != nil {
+		t.Fatal(err)
+	}
+	run(bare, "init", "--quiet", "--bare")
+	if err := os.MkdirAll(work, 0755); err != nil {
+		t.Fatal(err)
+	}
+	run(work, "init", "--quiet", "--initial-branch", "main")
+	write("replicas: 1\n")
+	run(work, "add", "-A")
+	run(work, "commit", "--quiet", "-m", "initial")
+	run(work, "checkout", "--quiet", "-b", "feature")
+	write("replicas: 2\n")
+	run(work, "commit", "--quiet", "-am", "scale")
+	run(work, "push", "--quiet", bare, "main", "feature")
+
+	repoURL := "file://" + filepath.ToSlash(dir) + "/"
+	return &testRepo{
+		dir:     dir,
+		baseSHA: run(work, "rev-parse", "main"),
+		headSHA: run(work, "rev-parse", "feature"),
+		hostURLs: strings.NewReplacer(
+			"https://github.com/", repoURL,
+			"https://gitlab.com/", repoURL,
+			"https://bitbucket.org/", repoURL,
+		),
+	}
+}
+
+// payload returns the recorded payload pointing to the local repository
+func (r *testRepo) payload(t *testing.T, name string) []byte {
+	in, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := r.hostURLs.Replace(string(in))
+	payload = strings.ReplaceAll(payload, recordedSHA, r.headSHA)
+	payload = strings.ReplaceAll(payload, recordedSHA[:12], r.headSHA[:12])
+	return []byte(payload)
+}
+
+func (r *testRepo) url(path string) string {
+	return "file://" + filepath.ToSlash(r.dir) + "/" + path
+}
+
+func newTestServer(t *testing.T, conf Config) (*Server, chan testRun) {
+	runs := make(chan testRun, 10)
+	conf.Workspace = t.TempDir()
+	conf.GithubWebhookSecret = testSecret
+	conf.GitlabWebhookToken = testSecret
+	conf.BitbucketWebhookSecret = testSecret
+	s := New(conf, func(ctx context.Context, job Job, dir string) error {
+		content, err := os.ReadFile(filepath.Join(dir, "deploy", "app.yaml"))
+		if err != nil {
+			return err
+		}
+		runs <- testRun{job: job, content: string(content)}
+		return nil
+	})
+	return s, runs
+}
+
+func sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(t *testing.T, url string, headers map[string]string, payload []byte) int {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebhooks(t *testing.T) {
+	repo := newTestRepo(t)
+
+	tests := []struct {
+		provider    string
+		payload     string
+		headers     func(payload []byte) map[string]string
+		pullRequest int
+	}{
+		{
+			provider: "github",
+			payload:  "github_pull_request.json",
+			headers: func(payload []byte) map[string]string {
+				return map[string]string{"X-GitHub-Event": "pull_request", "X-Hub-Signature-256": sign(payload)}
+			},
+			pullRequest: 42,
+		},
+		{
+			provider: "gitlab",
+			payload:  "gitlab_merge_request.json",
+			headers: func(payload []byte) map[string]string {
+				return map[string]string{"X-Gitlab-Event": "Merge Request Hook", "X-Gitlab-Token": testSecret}
+			},
+			pullRequest: 7,
+		},
+		{
+			provider: "bitbucket",
+			payload:  "bitbucket_pullrequest.json",
+			headers: func(payload []byte) map[string]string {
+				return map[string]string{"X-Event-Key": "pullrequest:updated", "X-Hub-Signature": sign(payload)}
+			},
+			pullRequest: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.provider, func(t *testing.T) {
+			s, runs := newTestServer(t, Config{Concurrency: 1})
+			s.Start(context.Background())
+			defer s.Shutdown()
+			server := httptest.NewServer(s.Handler())
+			defer server.Close()
+
+			url := server.URL + "/webhooks/" + test.provider
+			payload := repo.payload(t, test.payload)
+
+			assert.Equal(t, http.StatusUnauthorized, postWebhook(t, url, map[string]string{
+				"X-GitHub-Event":      "pull_request",
+				"X-Event-Key":         "pullrequest:updated",
+				"X-Hub-Signature-256": sign([]byte("tampered")),
+				"X-Hub-Signature":     sign([]byte("tampered")),
+				"X-Gitlab-Token":      "invalid",
+			}, payload))
+			assert.Equal(t, http.StatusAccepted, postWebhook(t, url, test.headers(payload), payload))
+
+			select {
+			case run := <-runs:
+				assert.Equal(t, Job{
+					Provider:     test.provider,
+					RepoURL:      repo.url("weaveworks/policies"),
+					CloneURL:     repo.url("weaveworks/policies.git"),
+					BaseCloneURL: repo.url("weaveworks/policies.git"),
+					Branch:       "feature",
+					BaseBranch:   "main",
+					SHA:          repo.headSHA,
+					PullRequest:  test.pullRequest,
+				}, run.job)
+				assert.Equal(t, "replicas: 2\n", run.content)
+			case <-time.After(10 * time.Second):
+				t.Fatal("job was not processed")
+			}
+		})
+	}
+}
+
+func TestWebhookIgnoredEvent(t *testing.T) {
+	s, _ := newTestServer(t, Config{})
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	payload := []byte(`{"action": "closed", "number": 42}`)
+	status := postWebhook(t, server.URL+"/webhooks/github", map[string]string{
+		"X-GitHub-Event":      "pull_request",
+		"X-Hub-Signature-256": sign(payload),
+	}, payload)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// merge request updates without new commits are ignored
+	payload = []byte(`{"object_kind": "merge_request", "object_attributes": {"iid": 7, "action": "update"}}`)
+	status = postWebhook(t, server.URL+"/webhooks/gitlab", map[string]string{
+		"X-Gitlab-Event": "Merge Request Hook",
+		"X-Gitlab-Token": testSecret,
+	}, payload)
+	assert.Equal(t, http.StatusNoContent, status)
+}
+
+func TestWebhookFork(t *testing.T) {
+	repo := newTestRepo(t)
+	fork := filepath.Join(repo.dir, "octocat", "policies.git")
+	out, err := exec.Command(gitBinary, "clone", "--quiet", "--bare", filepath.Join(repo.dir, "weaveworks", "policies.git"), fork).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git clone: %v: %s", err, out)
+	}
+
+	s, runs := newTestServer(t, Config{Concurrency: 1, Token: "token"})
+	s.Start(context.Background())
+	defer s.Shutdown()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	// the head repository clone url comes first in the payload
+	payload := []byte(strings.Replace(string(repo.payload(t, "github_pull_request.json")),
+		repo.url("weaveworks/policies.git"), repo.url("octocat/policies.git"), 1))
+	assert.Equal(t, http.StatusAccepted, postWebhook(t, server.URL+"/webhooks/github", map[string]string{
+		"X-GitHub-Event":      "pull_request",
+		"X-Hub-Signature-256": sign(payload),
+	}, payload))
+
+	select {
+	case run := <-runs:
+		assert.True(t, run.job.Fork)
+		assert.Equal(t, repo.url("weaveworks/policies"), run.job.RepoURL)
+		assert.Equal(t, repo.url("octocat/policies.git"), run.job.CloneURL)
+		assert.Equal(t, repo.url("weaveworks/policies.git"), run.job.BaseCloneURL)
+		assert.Equal(t, "replicas: 2\n", run.content)
+	case <-time.After(10 * time.Second):
+		t.Fatal("job was not processed")
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	s, _ := newTestServer(t, Config{QueueSize: 1})
+
+	assert.NoError(t, s.Enqueue(Job{RepoURL: "repo", PullRequest: 1, SHA: "a"}))
+	assert.ErrorIs(t, s.Enqueue(Job{RepoURL: "repo", PullRequest: 2, SHA: "b"}), ErrQueueFull)
+}
+
+func TestSupersededJob(t *testing.T) {
+	repo := newTestRepo(t)
+	s, runs := newTestServer(t, Config{Concurrency: 1})
+
+	job := Job{
+		Provider:    "github",
+		RepoURL:     repo.url("weaveworks/policies"),
+		CloneURL:    repo.url("weaveworks/policies.git"),
+		PullRequest: 1,
+	}
+	first, second := job, job
+	first.Branch, first.SHA = "main", repo.baseSHA
+	second.Branch, second.SHA = "feature", repo.headSHA
+	assert.NoError(t, s.Enqueue(first))
+	assert.NoError(t, s.Enqueue(second))
+
+	s.Start(context.Background())
+	s.Shutdown()
+
+	close(runs)
+	var shas []string
+	for run := range runs {
+		shas = append(shas, run.job.SHA)
+	}
+	assert.Equal(t, []string{repo.headSHA}, shas)
+}
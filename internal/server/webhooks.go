@@ -0,0 +1,251 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/weaveworks/weave-policy-validator/internal/git"
+)
+
+const (
+	maxPayloadSize  = 25 << 20
+	signaturePrefix = "sha256="
+)
+
+var (
+	errInvalidSignature = errors.New("invalid webhook signature")
+	errIgnoredEvent     = errors.New("ignored webhook event")
+)
+
+// webhookParser verifies the webhook request and returns the job of the event
+type webhookParser func(r *http.Request, payload []byte) (*Job, error)
+
+func (s *Server) webhookHandler(parse webhookParser) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+		if err != nil {
+			http.Error(w, "failed to read payload", http.StatusBadRequest)
+			return
+		}
+
+		job, err := parse(r, payload)
+		switch {
+		case errors.Is(err, errInvalidSignature):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case errors.Is(err, errIgnoredEvent):
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := s.Enqueue(*job); err != nil {
+			log.Printf("failed to queue pull request: %s, error: %v", job.key(), err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// verifyHMAC verifies the hex encoded sha256 hmac signature of the payload
+func verifyHMAC(secret, signature string, payload []byte) error {
+	if secret == "" {
+		return fmt.Errorf("%w: webhook secret is not configured", errInvalidSignature)
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil || !strings.HasPrefix(signature, signaturePrefix) {
+		return errInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+type githubPullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head githubRef `json:"head"`
+		Base githubRef `json:"base"`
+	} `json:"pull_request"`
+}
+
+type githubRef struct {
+	Ref  string `json:"ref"`
+	SHA  string `json:"sha"`
+	Repo struct {
+		HTMLURL  string `json:"html_url"`
+		CloneURL string `json:"clone_url"`
+	} `json:"repo"`
+}
+
+// parseGithubWebhook parses github pull request events signed by the X-Hub-Signature-256 header
+func (s *Server) parseGithubWebhook(r *http.Request, payload []byte) (*Job, error) {
+	if err := verifyHMAC(s.conf.GithubWebhookSecret, r.Header.Get("X-Hub-Signature-256"), payload); err != nil {
+		return nil, err
+	}
+	if r.Header.Get("X-GitHub-Event") != "pull_request" {
+		return nil, errIgnoredEvent
+	}
+
+	var event githubPullRequestEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse payload, error: %v", err)
+	}
+	switch event.Action {
+	case "opened", "reopened", "synchronize":
+	default:
+		return nil, errIgnoredEvent
+	}
+
+	head, base := event.PullRequest.Head, event.PullRequest.Base
+	return &Job{
+		Provider:     git.Github,
+		RepoURL:      base.Repo.HTMLURL,
+		CloneURL:     head.Repo.CloneURL,
+		BaseCloneURL: base.Repo.CloneURL,
+		Branch:       head.Ref,
+		BaseBranch:   base.Ref,
+		SHA:          head.SHA,
+		PullRequest:  event.Number,
+		Fork:         head.Repo.CloneURL != base.Repo.CloneURL,
+	}, nil
+}
+
+type gitlabMergeRequestEvent struct {
+	ObjectKind       string `json:"object_kind"`
+	ObjectAttributes struct {
+		IID          int    `json:"iid"`
+		Action       string `json:"action"`
+		OldRev       string `json:"oldrev"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		LastCommit   struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+		Source gitlabProject `json:"source"`
+		Target gitlabProject `json:"target"`
+	} `json:"object_attributes"`
+}
+
+type gitlabProject struct {
+	WebURL     string `json:"web_url"`
+	GitHTTPURL string `json:"git_http_url"`
+}
+
+// parseGitlabWebhook parses gitlab merge request events authenticated by the X-Gitlab-Token header
+func (s *Server) parseGitlabWebhook(r *http.Request, payload []byte) (*Job, error) {
+	if s.conf.GitlabWebhookToken == "" {
+		return nil, fmt.Errorf("%w: webhook token is not configured", errInvalidSignature)
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(s.conf.GitlabWebhookToken)) != 1 {
+		return nil, errInvalidSignature
+	}
+
+	var event gitlabMergeRequestEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse payload, error: %v", err)
+	}
+	if event.ObjectKind != "merge_request" {
+		return nil, errIgnoredEvent
+	}
+
+	attrs := event.ObjectAttributes
+	switch attrs.Action {
+	case "open", "reopen":
+	case "update":
+		// updates without the previous revision change only the merge request attributes, not its commits
+		if attrs.OldRev == "" {
+			return nil, errIgnoredEvent
+		}
+	default:
+		return nil, errIgnoredEvent
+	}
+
+	return &Job{
+		Provider:     git.Gitlab,
+		RepoURL:      attrs.Target.WebURL,
+		CloneURL:     attrs.Source.GitHTTPURL,
+		BaseCloneURL: attrs.Target.GitHTTPURL,
+		Branch:       attrs.SourceBranch,
+		BaseBranch:   attrs.TargetBranch,
+		SHA:          attrs.LastCommit.ID,
+		PullRequest:  attrs.IID,
+		Fork:         attrs.Source.GitHTTPURL != attrs.Target.GitHTTPURL,
+	}, nil
+}
+
+type bitbucketPullRequestEvent struct {
+	PullRequest struct {
+		ID          int               `json:"id"`
+		Source      bitbucketEndpoint `json:"source"`
+		Destination bitbucketEndpoint `json:"destination"`
+	} `json:"pullrequest"`
+}
+
+type bitbucketEndpoint struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+	Commit struct {
+		Hash string `json:"hash"`
+	} `json:"commit"`
+	Repository struct {
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	} `json:"repository"`
+}
+
+// parseBitbucketWebhook parses bitbucket pull request events signed by the X-Hub-Signature header,
+// the event commit hash is abbreviated and resolved on checkout
+func (s *Server) parseBitbucketWebhook(r *http.Request, payload []byte) (*Job, error) {
+	if err := verifyHMAC(s.conf.BitbucketWebhookSecret, r.Header.Get("X-Hub-Signature"), payload); err != nil {
+		return nil, err
+	}
+	switch r.Header.Get("X-Event-Key") {
+	case "pullrequest:created", "pullrequest:updated":
+	default:
+		return nil, errIgnoredEvent
+	}
+
+	var event bitbucketPullRequestEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse payload, error: %v", err)
+	}
+
+	source, destination := event.PullRequest.Source, event.PullRequest.Destination
+	return &Job{
+		Provider:     git.Bitbucket,
+		RepoURL:      destination.Repository.Links.HTML.Href,
+		CloneURL:     source.Repository.Links.HTML.Href + ".git",
+		BaseCloneURL: destination.Repository.Links.HTML.Href + ".git",
+		Branch:       source.Branch.Name,
+		BaseBranch:   destination.Branch.Name,
+		SHA:          source.Commit.Hash,
+		PullRequest:  event.PullRequest.ID,
+		Fork:         source.Repository.Links.HTML.Href != destination.Repository.Links.HTML.Href,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/weaveworks/weave-policy-validator/internal/git"
+)
+
+const (
+	gitBinary    = "git"
+	remoteName   = "origin"
+	remotePrefix = "refs/remotes/" + remoteName + "/"
+)
+
+// checkout checks out the job head into a new directory of the workspace and resolves the job sha
+// to the full commit sha, the base branch is fetched as the origin remote tracking branch
+func checkout(ctx context.Context, workspace, token string, job *Job) (string, error) {
+	dir, err := os.MkdirTemp(workspace, "job-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create job directory, error: %v", err)
+	}
+
+	auth := git.AuthEnv(job.Provider, token)
+
+	if _, err := runGit(ctx, dir, nil, "init", "--quiet"); err != nil {
+		return dir, err
+	}
+	// the token of the repository is not sent to forks
+	headAuth := auth
+	if job.Fork {
+		headAuth = nil
+	}
+	if _, err := runGit(ctx, dir, headAuth, "fetch", "--quiet", job.CloneURL, "refs/heads/"+job.Branch); err != nil {
+		return dir, err
+	}
+	if _, err := runGit(ctx, dir, nil, "checkout", "--quiet", "--detach", job.SHA); err != nil {
+		return dir, err
+	}
+	if job.BaseBranch != "" && job.BaseCloneURL != "" {
+		refspec := fmt.Sprintf("+refs/heads/%s:%s%s", job.BaseBranch, remotePrefix, job.BaseBranch)
+		if _, err := runGit(ctx, dir, auth, "fetch", "--quiet", job.BaseCloneURL, refspec); err != nil {
+			return dir, err
+		}
+	}
+
+	sha, err := runGit(ctx, dir, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return dir, err
+	}
+	job.SHA = strings.TrimSpace(sha)
+	return dir, nil
+}
+
+// runGit runs the git command in dir with the additional environment variables
+func runGit(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gitBinary, args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -5,6 +5,15 @@ import (
 	"strings"
 )
 
+// isWithinPath reports whether path is the given parent path or inside it
+func isWithinPath(path, parent string) bool {
+	rel, err := filepath.Rel(filepath.Clean(parent), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../"))
+}
+
 func isHiddenFile(path string) bool {
 	return strings.HasPrefix(filepath.Base(path), ".")
 }
@@ -12,6 +12,8 @@ import (
 	"helm.sh/helm/v3/pkg/engine"
 )
 
+const localRepositoryPrefix = "file://"
+
 type Helm struct {
 	Path      string
 	valueFile *string
@@ -37,14 +39,7 @@ func (h *Helm) ResourceFiles(_ context.Context) ([]*types.File, error) {
 
 	vals := chart.Values
 	if h.valueFile != nil {
-		var valuesFilePath string
-		// if the path is just a the file name, append it to chart path
-		if filepath.Base(*h.valueFile) == *h.valueFile {
-			valuesFilePath = filepath.Join(h.Path, *h.valueFile)
-		} else {
-			valuesFilePath = *h.valueFile
-		}
-		values, err := chartutil.ReadValuesFile(valuesFilePath)
+		values, err := chartutil.ReadValuesFile(h.valuesFilePath())
 		if err != nil {
 			return nil, err
 		}
@@ -91,6 +86,37 @@ func (h *Helm) ResourceFiles(_ context.Context) ([]*types.File, error) {
 	return files, nil
 }
 
+// Dependencies returns the chart directory, the values file and the local chart dependencies
+func (h *Helm) Dependencies() ([]string, error) {
+	chart, err := loader.Load(h.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	dependencies := []string{h.Path}
+	if h.valueFile != nil {
+		dependencies = append(dependencies, h.valuesFilePath())
+	}
+	for _, dependency := range chart.Metadata.Dependencies {
+		if strings.HasPrefix(dependency.Repository, localRepositoryPrefix) {
+			path := strings.TrimPrefix(dependency.Repository, localRepositoryPrefix)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(h.Path, path)
+			}
+			dependencies = append(dependencies, path)
+		}
+	}
+	return dependencies, nil
+}
+
+// valuesFilePath returns the values file path, file names are relative to the chart path
+func (h *Helm) valuesFilePath() string {
+	if filepath.Base(*h.valueFile) == *h.valueFile {
+		return filepath.Join(h.Path, *h.valueFile)
+	}
+	return *h.valueFile
+}
+
 func (h *Helm) IsValidPath() bool {
 	_, err := loader.Load(h.Path)
 	if err != nil {
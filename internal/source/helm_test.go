@@ -149,3 +149,25 @@ func TestHelmSource(t *testing.T) {
 		}
 	}
 }
+
+func TestHelmDependencies(t *testing.T) {
+	helm := NewHelmSource("../../tests/data/entities/helm")
+	helm.SetValueFile("values-dev.yaml")
+
+	dependencies, err := helm.Dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"../../tests/data/entities/helm",
+		"../../tests/data/entities/helm/values-dev.yaml",
+	}, dependencies)
+
+	affected, err := IsAffected(helm, []string{"../../tests/data/entities/helm/templates/deployments.yaml"})
+	assert.NoError(t, err)
+	assert.True(t, affected)
+
+	affected, err = IsAffected(helm, []string{"../../tests/data/entities/kubernetes/deployments.yaml"})
+	assert.NoError(t, err)
+	assert.False(t, affected)
+}
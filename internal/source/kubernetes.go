@@ -42,6 +42,11 @@ func (k *Kubernetes) ResourceFiles(_ context.Context) ([]*types.File, error) {
 	return files, nil
 }
 
+// Dependencies returns the source path
+func (k *Kubernetes) Dependencies() ([]string, error) {
+	return []string{k.Path}, nil
+}
+
 func (k *Kubernetes) IsValidPath() bool {
 	info, err := os.Stat(k.Path)
 	if err != nil {
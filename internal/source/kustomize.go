@@ -2,9 +2,11 @@ package source
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/weaveworks/weave-policy-validator/internal/types"
@@ -127,6 +129,108 @@ func (k *Kustomize) getObjOriginalID(id string) string {
 	return id
 }
 
+// Dependencies returns the kustomization directory and the local bases, components, patches and
+// generator files it references
+func (k *Kustomize) Dependencies() ([]string, error) {
+	visited := make(map[string]bool)
+	if err := kustomizationDependencies(k.Path, visited); err != nil {
+		return nil, err
+	}
+
+	var dependencies []string
+	for path := range visited {
+		dependencies = append(dependencies, path)
+	}
+	sort.Strings(dependencies)
+	return dependencies, nil
+}
+
+// kustomizationDependencies adds the kustomization directory and its local references to visited
+func kustomizationDependencies(dir string, visited map[string]bool) error {
+	dir = filepath.Clean(dir)
+	if visited[dir] {
+		return nil
+	}
+	visited[dir] = true
+
+	obj, err := readKustomization(dir)
+	if err != nil {
+		return err
+	}
+
+	refs := append([]string{}, obj.Resources...)
+	refs = append(refs, obj.Components...)
+	refs = append(refs, obj.Crds...)
+	refs = append(refs, obj.Configurations...)
+	refs = append(refs, obj.Generators...)
+	refs = append(refs, obj.Transformers...)
+	refs = append(refs, obj.Validators...)
+	for _, patch := range obj.PatchesStrategicMerge {
+		refs = append(refs, string(patch))
+	}
+	for _, patch := range append(obj.Patches, obj.PatchesJson6902...) {
+		refs = append(refs, patch.Path)
+	}
+	for _, replacement := range obj.Replacements {
+		refs = append(refs, replacement.Path)
+	}
+	for _, generator := range obj.ConfigMapGenerator {
+		refs = append(refs, generatorFiles(generator.GeneratorArgs)...)
+	}
+	for _, generator := range obj.SecretGenerator {
+		refs = append(refs, generatorFiles(generator.GeneratorArgs)...)
+	}
+
+	for _, ref := range refs {
+		// remote references and inline patches are not files
+		if ref == "" || strings.Contains(ref, "://") || strings.Contains(ref, "\n") {
+			continue
+		}
+		path := filepath.Join(dir, ref)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			if err := kustomizationDependencies(path, visited); err != nil {
+				return err
+			}
+			continue
+		}
+		visited[path] = true
+	}
+	return nil
+}
+
+// generatorFiles returns the file paths of the generator sources, file sources may be prefixed by a key
+func generatorFiles(args ktypes.GeneratorArgs) []string {
+	var files []string
+	for _, source := range args.FileSources {
+		if i := strings.Index(source, "="); i >= 0 {
+			source = source[i+1:]
+		}
+		files = append(files, source)
+	}
+	return append(files, args.EnvSources...)
+}
+
+// readKustomization reads the kustomization file of the directory without modifying it
+func readKustomization(dir string) (*ktypes.Kustomization, error) {
+	for _, filename := range konfig.RecognizedKustomizationFileNames() {
+		in, err := os.ReadFile(filepath.Join(dir, filename))
+		if err != nil {
+			continue
+		}
+		var obj ktypes.Kustomization
+		if err := yaml.Unmarshal(in, &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse kustomization, path: %s, error: %v", dir, err)
+		}
+		obj.FixKustomization()
+		return &obj, nil
+	}
+	return nil, fmt.Errorf("kustomization file not found, path: %s", dir)
+}
+
 func (k *Kustomize) IsValidPath() bool {
 	info, err := os.Stat(k.Path)
 	if err != nil {
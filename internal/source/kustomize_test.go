@@ -146,3 +146,31 @@ func TestKustomizeSource(t *testing.T) {
 		}
 	}
 }
+
+func TestKustomizeDependencies(t *testing.T) {
+	dependencies, err := NewKustomizeSource("../../tests/data/entities/kustomize/overlays/dev").Dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"../../tests/data/entities/kustomize/base",
+		"../../tests/data/entities/kustomize/base/deployments.yaml",
+		"../../tests/data/entities/kustomize/overlays/dev",
+		"../../tests/data/entities/kustomize/overlays/dev/patches.yaml",
+	}, dependencies)
+
+	tests := []struct {
+		changed  string
+		affected bool
+	}{
+		{"../../tests/data/entities/kustomize/base/deployments.yaml", true},
+		{"../../tests/data/entities/kustomize/overlays/dev/kustomization.yaml", true},
+		{"../../tests/data/entities/kustomize/overlays/prod/patches.yaml", false},
+		{"../../tests/data/entities/kustomize/base.yaml", false},
+	}
+	for _, test := range tests {
+		affected, err := IsAffected(NewKustomizeSource("../../tests/data/entities/kustomize/overlays/dev"), []string{test.changed})
+		assert.NoError(t, err)
+		assert.Equal(t, test.affected, affected, test.changed)
+	}
+}
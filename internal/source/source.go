@@ -3,6 +3,7 @@ package source
 import (
 	"context"
 	"errors"
+	"path/filepath"
 
 	"github.com/weaveworks/weave-policy-validator/internal/types"
 )
@@ -17,6 +18,8 @@ type Source interface {
 	Type() string
 	IsValidPath() bool
 	ResourceFiles(context.Context) ([]*types.File, error)
+	// Dependencies returns the files and directories the rendered resources depend on
+	Dependencies() ([]string, error)
 }
 
 func GetSourceFromPath(path string) (Source, error) {
@@ -37,3 +40,23 @@ func GetSourceFromPath(path string) (Source, error) {
 
 	return nil, errors.New("path is not recognized as a valid path")
 }
+
+// IsAffected reports whether any of the changed files is a dependency of the source, the changed
+// files paths are expected to be absolute with symlinks resolved
+func IsAffected(s Source, changedFiles []string) (bool, error) {
+	dependencies, err := s.Dependencies()
+	if err != nil {
+		return false, err
+	}
+	for _, dependency := range dependencies {
+		if resolved, err := filepath.EvalSymlinks(dependency); err == nil {
+			dependency = resolved
+		}
+		for _, changed := range changedFiles {
+			if isWithinPath(changed, dependency) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -2,6 +2,9 @@ package types
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/weaveworks/weave-policy-validator/internal/yaml"
 )
@@ -10,6 +13,7 @@ type File struct {
 	Path       string
 	Remediated bool
 	Resources  map[string]*Resource
+	lines      []string
 }
 
 // NewFile creates new empty file
@@ -41,6 +45,26 @@ func NewFileFromPath(path string) (*File, error) {
 	}, nil
 }
 
+// RelativeTo returns copy of the file with the path relative to the repository root
+func (f *File) RelativeTo(root string) *File {
+	file := *f
+	file.Path = RelativePath(root, f.Path)
+	return &file
+}
+
+// RelativePath returns the slash separated path relative to the repository root, paths outside
+// of the root are kept as is
+func RelativePath(root, path string) string {
+	if root == "" || !filepath.IsAbs(path) {
+		return filepath.ToSlash(path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
 // ResourceExists checks if a resource exists in the file
 func (f *File) ResourceExists(id string) bool {
 	_, found := f.Resources[id]
@@ -66,3 +90,16 @@ func (f *File) Content() (string, error) {
 	}
 	return string(raw), nil
 }
+
+// Lines returns the original file content lines
+func (f *File) Lines() ([]string, error) {
+	if f.lines != nil {
+		return f.lines, nil
+	}
+	in, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	f.lines = strings.Split(string(in), "\n")
+	return f.lines, nil
+}
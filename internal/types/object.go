@@ -21,6 +21,11 @@ func NewObject(node *yaml.Node) *Object {
 	return &Object{node: node}
 }
 
+// Node returns the object yaml node
+func (obj *Object) Node() *yaml.Node {
+	return obj.node
+}
+
 // ApiVersion returns apiVersion
 func (obj *Object) ApiVersion() string {
 	return obj.node.GetApiVersion()
@@ -45,6 +50,11 @@ func (obj *Object) Name() string {
 	return obj.node.GetName()
 }
 
+// Annotations returns object annotations
+func (obj *Object) Annotations() map[string]string {
+	return obj.node.GetAnnotations()
+}
+
 // ID returns object id
 func (obj *Object) ID() string {
 	parts := []string{
@@ -2,6 +2,8 @@ package types
 
 import (
 	"encoding/json"
+
+	"github.com/weaveworks/weave-policy-validator/internal/yaml"
 )
 
 type RemediationHint struct {
@@ -31,6 +33,19 @@ func (r *Resource) FindKey(key string) (int, int) {
 	return field.StartLine(), field.EndLine()
 }
 
+// Suggestion returns the patch of the file lines which sets the key to the given value
+func (r *Resource) Suggestion(lines []string, key string, value interface{}) (*yaml.Patch, error) {
+	if number, ok := value.(json.Number); ok {
+		value, _ = number.Float64()
+	}
+
+	if r.Raw == nil {
+		return nil, nil
+	}
+
+	return r.Raw.node.SetFieldPatch(lines, key, value)
+}
+
 // Remediate rremediates resource value
 func (r *Resource) Remediate(key string, value interface{}) (bool, error) {
 	if number, ok := value.(json.Number); ok {
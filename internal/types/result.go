@@ -1,13 +1,18 @@
 package types
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/weaveworks/weave-policy-validator/internal/markdown"
 	"github.com/weaveworks/weave-policy-validator/internal/sarif"
+	"github.com/weaveworks/weave-policy-validator/internal/yaml"
 	sast "gitlab.com/gitlab-org/security-products/analyzers/report/v3"
 )
 
@@ -19,6 +24,13 @@ const (
 	scannerVersion = "0.0.1"
 )
 
+const (
+	// ModeEnforce is the mode of the policies failing the validation
+	ModeEnforce = "enforce"
+	// ModeWarnOnly is the mode of the policies reporting violations without failing the validation
+	ModeWarnOnly = "warn-only"
+)
+
 type Policy struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
@@ -26,6 +38,7 @@ type Policy struct {
 	Category    string `json:"category"`
 	Description string `json:"description"`
 	HowToSolve  string `json:"how_to_solve"`
+	Mode        string `json:"mode"`
 }
 
 type Entity struct {
@@ -43,28 +56,196 @@ type Location struct {
 type Details struct {
 	ViolatingKey     *string
 	RecommendedValue interface{}
+	Suggestion       *yaml.Patch
+	// Message is the message of the violation occurrence
+	Message string
+	// Content is the normalized content of the violating lines
+	Content string
 }
 
 type Violation struct {
-	ID       string   `json:"id"`
-	Message  string   `json:"message"`
-	Policy   Policy   `json:"policy"`
-	Entity   Entity   `json:"entity"`
-	Details  Details  `json:"-"`
-	Location Location `json:"location"`
+	ID          string   `json:"id"`
+	Fingerprint string   `json:"fingerprint"`
+	Message     string   `json:"message"`
+	Policy      Policy   `json:"policy"`
+	Entity      Entity   `json:"entity"`
+	Details     Details  `json:"-"`
+	Location    Location `json:"location"`
+	PreExisting bool     `json:"pre_existing,omitempty"`
+	Blame       *Blame   `json:"blame,omitempty"`
+	Owners      []string `json:"owners,omitempty"`
+	// Suppression is set on the violations suppressed by the resource annotations or yaml comments
+	Suppression *Suppression `json:"suppression,omitempty"`
+	// Overrides are the policy parameters overridden by the policy configs of the resource, the config file
+	// or the flags
+	Overrides []ParameterOverride `json:"parameter_overrides,omitempty"`
+}
+
+// WarnOnly reports whether the violation policy is warn-only
+func (v Violation) WarnOnly() bool {
+	return v.Policy.Mode == ModeWarnOnly
+}
+
+// ParameterOverride is a policy parameter overridden by a policy config, the config file or the flags
+type ParameterOverride struct {
+	Name   string      `json:"name"`
+	Value  interface{} `json:"value"`
+	Config string      `json:"config"`
+}
+
+// String returns the override in the name=value (config) format
+func (o ParameterOverride) String() string {
+	return fmt.Sprintf("%s=%v (%s)", o.Name, o.Value, o.Config)
+}
+
+const (
+	SuppressionAnnotation = "annotation"
+	SuppressionComment    = "comment"
+	SuppressionException  = "exception"
+)
+
+// Suppression records why a violation is not reported, exceptions also record their name, owner and expiry
+type Suppression struct {
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason"`
+	Exception string `json:"exception,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	Expires   string `json:"expires,omitempty"`
+}
+
+// fingerprint identifies the violation across runs by its policy, resource, violating key, occurrence
+// message, path and normalized violating lines
+func (v Violation) fingerprint() string {
+	var key string
+	if v.Details.ViolatingKey != nil {
+		key = *v.Details.ViolatingKey
+	}
+	hash := sha256.New()
+	for _, part := range []string{v.Policy.ID, v.Entity.Kind, v.Entity.Namespace, v.Entity.Name, key, v.Details.Message, filepath.ToSlash(v.Location.Path), v.Details.Content} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// NormalizeContent returns the lines with their whitespace collapsed so indentation changes do not
+// change the fingerprints
+func NormalizeContent(lines []string) string {
+	normalized := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			normalized = append(normalized, strings.Join(fields, " "))
+		}
+	}
+	return strings.Join(normalized, "\n")
+}
+
+// Blame is the last commit that changed the violating lines
+type Blame struct {
+	Author string    `json:"author"`
+	Email  string    `json:"email"`
+	SHA    string    `json:"sha"`
+	Date   time.Time `json:"date"`
 }
 
 type Result struct {
-	Scanned        int         `json:"scanned"`
-	ViolationCount int         `json:"violations"`
-	Remediated     int         `json:"remediated"`
-	Violations     []Violation `json:"items"`
-	PullRequestURL *string     `json:"pull_request"`
+	Scanned          int              `json:"scanned"`
+	Skipped          int              `json:"skipped,omitempty"`
+	ViolationCount   int              `json:"violations"`
+	PreExistingCount int              `json:"pre_existing,omitempty"`
+	SuppressedCount  int              `json:"suppressed,omitempty"`
+	BaselinedCount   int              `json:"baselined,omitempty"`
+	Remediated       int              `json:"remediated"`
+	Violations       []Violation      `json:"items"`
+	Suppressed       []Violation      `json:"suppressed_items,omitempty"`
+	Baselined        []Violation      `json:"baselined_items,omitempty"`
+	FixedBaseline    []BaselineEntry  `json:"fixed_baseline,omitempty"`
+	PullRequestURL   *string          `json:"pull_request"`
+	CommitSignature  *CommitSignature `json:"commit_signature,omitempty"`
+	Metadata         *Metadata        `json:"metadata,omitempty"`
+
+	// root is the repository root the violation paths are relative to
+	root string
+}
+
+// Metadata describes how the validation was configured
+type Metadata struct {
+	// PolicySelection is the selection of the applied policies
+	PolicySelection *PolicySelection `json:"policy_selection,omitempty"`
+	// Policies are the ids of the applied policies
+	Policies []string `json:"policies,omitempty"`
+}
+
+// PolicySelector selects the policies matching one of the values of each of its non empty fields, ids are
+// globs and standards are standard ids optionally followed by /control
+type PolicySelector struct {
+	IDs        []string `json:"ids,omitempty" yaml:"ids"`
+	Categories []string `json:"categories,omitempty" yaml:"categories"`
+	Tags       []string `json:"tags,omitempty" yaml:"tags"`
+	Severities []string `json:"severities,omitempty" yaml:"severities"`
+	Standards  []string `json:"standards,omitempty" yaml:"standards"`
+}
+
+// Empty reports whether the selector has no values
+func (s PolicySelector) Empty() bool {
+	return len(s.IDs) == 0 && len(s.Categories) == 0 && len(s.Tags) == 0 && len(s.Severities) == 0 && len(s.Standards) == 0
+}
+
+// Merge adds the values of the other selector
+func (s *PolicySelector) Merge(other PolicySelector) {
+	s.IDs = append(s.IDs, other.IDs...)
+	s.Categories = append(s.Categories, other.Categories...)
+	s.Tags = append(s.Tags, other.Tags...)
+	s.Severities = append(s.Severities, other.Severities...)
+	s.Standards = append(s.Standards, other.Standards...)
+}
+
+// PolicySelection selects the policies matching the include selector and none of the exclude selector values
+type PolicySelection struct {
+	Include PolicySelector `json:"include" yaml:"include"`
+	Exclude PolicySelector `json:"exclude" yaml:"exclude"`
+}
+
+// Empty reports whether the selection selects all policies
+func (s PolicySelection) Empty() bool {
+	return s.Include.Empty() && s.Exclude.Empty()
+}
+
+// BaselineEntry is a violation accepted by the baseline
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Policy      string `json:"policy"`
+	Kind        string `json:"kind"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+}
+
+// CommitSignature is the signature status of a commit as reported by the git provider
+type CommitSignature struct {
+	Signed   bool   `json:"signed"`
+	Verified bool   `json:"verified"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// String returns the signature status
+func (s CommitSignature) String() string {
+	status := "unsigned"
+	if s.Verified {
+		status = "verified"
+	} else if s.Signed {
+		status = "signed"
+	}
+	if s.Reason != "" {
+		status += fmt.Sprintf(" (%s)", s.Reason)
+	}
+	return status
 }
 
 type resultSummary struct {
 	Policy     Policy
 	Violations int
+	Owners     []string
 }
 
 var SARIFSeverityMap = map[string]string{
@@ -79,6 +260,185 @@ var SASTSeverityMap = map[string]sast.SeverityLevel{
 	"high":   sast.SeverityLevelCritical,
 }
 
+// MarkPreExisting marks the violations outside the changed lines as pre-existing
+func (r *Result) MarkPreExisting(changed func(path string, start, end int) bool) {
+	r.PreExistingCount = 0
+	for i := range r.Violations {
+		location := r.Violations[i].Location
+		r.Violations[i].PreExisting = !changed(location.Path, location.StartLine, location.EndLine)
+		if r.Violations[i].PreExisting {
+			r.PreExistingCount++
+		}
+	}
+}
+
+// RelativeTo makes the violation paths relative to the repository root
+func (r *Result) RelativeTo(root string) {
+	r.root = root
+	for i := range r.Violations {
+		r.Violations[i].Location.Path = RelativePath(root, r.Violations[i].Location.Path)
+	}
+	for i := range r.Suppressed {
+		r.Suppressed[i].Location.Path = RelativePath(root, r.Suppressed[i].Location.Path)
+	}
+	for i := range r.Baselined {
+		r.Baselined[i].Location.Path = RelativePath(root, r.Baselined[i].Location.Path)
+	}
+	// fingerprints use the relative paths to be stable across checkouts
+	r.SetFingerprints()
+}
+
+// SetFingerprints sets the fingerprints of the violations
+func (r *Result) SetFingerprints() {
+	for _, violations := range [][]Violation{r.Violations, r.Suppressed, r.Baselined} {
+		for i := range violations {
+			violations[i].Fingerprint = violations[i].fingerprint()
+		}
+	}
+}
+
+// Deduplicate removes the exact duplicates of the violations, e.g. of resources rendered by multiple
+// scanned sources, the duplicates have the same fingerprint, message and lines
+func (r *Result) Deduplicate() {
+	dedup := func(violations []Violation) []Violation {
+		seen := make(map[string]bool)
+		result := violations[:0]
+		for _, violation := range violations {
+			key := fmt.Sprintf("%s:%d:%d:%s", violation.Fingerprint, violation.Location.StartLine, violation.Location.EndLine, violation.Message)
+			if !seen[key] {
+				seen[key] = true
+				result = append(result, violation)
+			}
+		}
+		return result
+	}
+	r.Violations = dedup(r.Violations)
+	r.Suppressed = dedup(r.Suppressed)
+	r.ViolationCount = len(r.Violations)
+	r.SuppressedCount = len(r.Suppressed)
+	r.PreExistingCount = 0
+	for _, violation := range r.Violations {
+		if violation.PreExisting {
+			r.PreExistingCount++
+		}
+	}
+}
+
+// AssignOwners sets the owners of the violations by their paths
+func (r *Result) AssignOwners(owners func(path string) []string) {
+	for i := range r.Violations {
+		r.Violations[i].Owners = owners(r.Violations[i].Location.Path)
+	}
+}
+
+// SeverityLevels ranks the policy severities, unknown severities rank above all of them
+var SeverityLevels = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// SeverityThresholds are the min severities of the violations failing the validation, the category
+// thresholds override the default one, all violations fail without threshold
+type SeverityThresholds struct {
+	FailOn     string
+	Categories map[string]string
+}
+
+// Fails reports whether the violation severity reaches the threshold of its policy category, violations of
+// warn-only policies never fail
+func (t SeverityThresholds) Fails(violation Violation) bool {
+	if violation.WarnOnly() {
+		return false
+	}
+	threshold, ok := t.Categories[violation.Policy.Category]
+	if !ok {
+		threshold = t.FailOn
+	}
+	if threshold == "" {
+		return true
+	}
+	level, ok := SeverityLevels[violation.Policy.Severity]
+	if !ok {
+		return true
+	}
+	return level >= SeverityLevels[threshold]
+}
+
+// Failing returns the result of the violations failing the severity thresholds
+func (r *Result) Failing(thresholds SeverityThresholds) *Result {
+	result := &Result{Violations: []Violation{}}
+	for _, violation := range r.Violations {
+		if thresholds.Fails(violation) {
+			result.Violations = append(result.Violations, violation)
+		}
+	}
+	result.ViolationCount = len(result.Violations)
+	return result
+}
+
+// Fails reports whether the violations reaching the severity thresholds fail the validation, they are
+// allowed when they do not exceed the max violations of their owners
+func (r *Result) Fails(thresholds SeverityThresholds, ownerMaxViolations map[string]int) bool {
+	failing := r.Failing(thresholds)
+	if failing.ViolationCount == 0 {
+		return false
+	}
+	return len(ownerMaxViolations) == 0 || failing.ExceedsOwnerThresholds(ownerMaxViolations)
+}
+
+// ExceedsOwnerThresholds reports whether the violations exceed the maximum violations allowed per owner,
+// violations of owners without threshold and violations without owners are not allowed
+func (r *Result) ExceedsOwnerThresholds(thresholds map[string]int) bool {
+	counts := make(map[string]int)
+	for _, violation := range r.Violations {
+		if len(violation.Owners) == 0 {
+			return true
+		}
+		for _, owner := range violation.Owners {
+			if _, ok := thresholds[owner]; !ok {
+				return true
+			}
+			counts[owner]++
+		}
+	}
+	for owner, count := range counts {
+		if count > thresholds[owner] {
+			return true
+		}
+	}
+	return false
+}
+
+// Owners returns the distinct owners of the violations
+func (r *Result) Owners() []string {
+	var owners []string
+	seen := make(map[string]bool)
+	for _, violation := range r.Violations {
+		for _, owner := range violation.Owners {
+			if !seen[owner] {
+				seen[owner] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// WithoutPreExisting returns copy of the result restricted to the violations that are not pre-existing
+func (r *Result) WithoutPreExisting() Result {
+	result := *r
+	result.Violations = []Violation{}
+	for _, violation := range r.Violations {
+		if !violation.PreExisting {
+			result.Violations = append(result.Violations, violation)
+		}
+	}
+	result.ViolationCount = len(result.Violations)
+	return result
+}
+
 // JSON return result in json format
 func (r *Result) JSON() (string, error) {
 	return tojson(r)
@@ -88,9 +448,17 @@ func (r *Result) JSON() (string, error) {
 func (r *Result) SARIF() (string, error) {
 	report := sarif.New()
 	run := report.AddRun(scannerName)
+	if r.root != "" {
+		run.SetSourceRoot(r.root)
+	}
+	if r.Metadata != nil && r.Metadata.PolicySelection != nil {
+		run.SetProperty("policySelection", r.Metadata.PolicySelection)
+		run.SetProperty("policies", r.Metadata.Policies)
+	}
 	rules := map[string]*sarif.Rule{}
-	for i := range r.Violations {
-		violation := r.Violations[i]
+	violations := append(append([]Violation{}, r.Violations...), r.Suppressed...)
+	for i := range violations {
+		violation := violations[i]
 		if !matchSecurityCategory(violation.Policy.Category) {
 			continue
 		}
@@ -103,12 +471,40 @@ func (r *Result) SARIF() (string, error) {
 			)
 			rules[violation.Policy.ID] = rule
 		}
-		ruleResult := run.AddResult(violation.Policy.ID, violation.Message, SARIFSeverityMap[violation.Policy.Severity])
+		level := SARIFSeverityMap[violation.Policy.Severity]
+		if violation.WarnOnly() && level == "error" {
+			level = "warning"
+		}
+		ruleResult := run.AddResult(violation.Policy.ID, violation.Message, level)
+		if violation.Policy.Mode != "" {
+			ruleResult.SetProperty("mode", violation.Policy.Mode)
+		}
+		var uriBaseID string
+		if r.root != "" && !filepath.IsAbs(violation.Location.Path) {
+			uriBaseID = sarif.SourceRootID
+		}
 		ruleResult.SetResultLocation(
 			violation.Location.Path,
+			uriBaseID,
 			violation.Location.StartLine,
 			violation.Location.EndLine,
 		)
+		if violation.Fingerprint != "" {
+			ruleResult.SetPartialFingerprint(sarif.FingerprintKey, violation.Fingerprint)
+		}
+		if violation.Blame != nil {
+			ruleResult.SetProperty("blame", violation.Blame)
+		}
+		if len(violation.Overrides) > 0 {
+			ruleResult.SetProperty("parameterOverrides", violation.Overrides)
+		}
+		if violation.Suppression != nil {
+			kind := sarif.SuppressionInSource
+			if violation.Suppression.Kind == SuppressionException {
+				kind = sarif.SuppressionExternal
+			}
+			ruleResult.AddSuppression(kind, violation.Suppression.Reason)
+		}
 	}
 	return tojson(report)
 }
@@ -121,11 +517,26 @@ func (r *Result) SAST() (string, error) {
 		if !matchSecurityCategory(violation.Policy.Category) {
 			continue
 		}
+		var tracking *sast.Tracking
+		if violation.Fingerprint != "" {
+			tracking = &sast.Tracking{
+				Type: "source",
+				Items: []sast.TrackingItem{{
+					File:       violation.Location.Path,
+					LineStart:  violation.Location.StartLine,
+					LineEnd:    violation.Location.EndLine,
+					Signatures: []sast.TrackingSignature{{Algorithm: "hash", Value: violation.Fingerprint}},
+				}},
+			}
+		}
 		vulnerabilities = append(vulnerabilities, sast.Vulnerability{
+			CompareKey:  violation.Fingerprint,
+			Tracking:    tracking,
 			Name:        violation.Policy.Name,
 			Description: violation.Policy.Description,
 			Message:     violation.Message,
 			Severity:    sast.SeverityLevel(SASTSeverityMap[violation.Policy.Severity]),
+			Details:     sastDetails(violation),
 			Category:    sast.CategorySast,
 			Solution:    violation.Policy.HowToSolve,
 			Scanner: sast.Scanner{
@@ -189,6 +600,16 @@ func (r *Result) SAST() (string, error) {
 	return tojson(report)
 }
 
+// sastDetails returns the details of the vulnerability showing the policy mode
+func sastDetails(violation Violation) *sast.Details {
+	if violation.Policy.Mode == "" {
+		return nil
+	}
+	return &sast.Details{
+		"mode": sast.DetailsTextField{Name: "Mode", Value: violation.Policy.Mode},
+	}
+}
+
 // TEXT return result in text format
 func (r *Result) TEXT() string {
 	var output string
@@ -198,6 +619,9 @@ func (r *Result) TEXT() string {
 		output += fmt.Sprintln("Policy", ":", violation.Policy.Name)
 		output += fmt.Sprintln("Category", ":", violation.Policy.Category)
 		output += fmt.Sprintln("Severity", ":", violation.Policy.Severity)
+		if violation.Policy.Mode != "" {
+			output += fmt.Sprintln("Mode", ":", violation.Policy.Mode)
+		}
 
 		var location string
 		if violation.Location.StartLine == violation.Location.EndLine {
@@ -208,27 +632,79 @@ func (r *Result) TEXT() string {
 
 		output += fmt.Sprintln("File", ":", violation.Location.Path, location)
 		output += fmt.Sprintln("Message", ":", violation.Message)
+		if len(violation.Overrides) > 0 {
+			overrides := make([]string, len(violation.Overrides))
+			for i := range violation.Overrides {
+				overrides[i] = violation.Overrides[i].String()
+			}
+			output += fmt.Sprintln("Parameters", ":", strings.Join(overrides, ", "))
+		}
 	}
 	output += fmt.Sprintln("====================================================================")
 	output += fmt.Sprintln("Summary", ":")
-	output += fmt.Sprintln("scanned:", r.Scanned, "violations:", r.ViolationCount, "remediated:", r.Remediated)
+	summary := []interface{}{"scanned:", r.Scanned}
+	if r.Skipped > 0 {
+		summary = append(summary, "skipped:", r.Skipped)
+	}
+	summary = append(summary, "violations:", r.ViolationCount)
+	if warnings := r.warnings(); warnings > 0 {
+		summary = append(summary, "warn-only:", warnings)
+	}
+	if r.PreExistingCount > 0 {
+		summary = append(summary, "pre-existing:", r.PreExistingCount)
+	}
+	if r.SuppressedCount > 0 {
+		summary = append(summary, "suppressed:", r.SuppressedCount)
+	}
+	if r.BaselinedCount > 0 {
+		summary = append(summary, "baselined:", r.BaselinedCount)
+	}
+	summary = append(summary, "remediated:", r.Remediated)
+	output += fmt.Sprintln(summary...)
+
+	if r.Metadata != nil && r.Metadata.PolicySelection != nil {
+		output += fmt.Sprintln("Selected policies", ":", strings.Join(r.Metadata.Policies, ", "))
+	}
+
+	if len(r.FixedBaseline) > 0 {
+		output += fmt.Sprintln("Fixed baseline entries", ":")
+		for _, entry := range r.FixedBaseline {
+			output += fmt.Sprintln("-", entry.Policy, entry.Kind+"/"+entry.Name, entry.Path, entry.Fingerprint)
+		}
+	}
 
 	return output
 }
 
+// warnings returns the count of the violations of warn-only policies
+func (r *Result) warnings() int {
+	var count int
+	for _, violation := range r.Violations {
+		if violation.WarnOnly() {
+			count++
+		}
+	}
+	return count
+}
+
 // MarkdowSummary returns result summary in markdown
 func (r *Result) MarkdowSummary() string {
+	var owned bool
+	warnOnly := r.warnings() > 0
 	summaryMap := make(map[string]resultSummary)
 	for _, violation := range r.Violations {
-		if summary, ok := summaryMap[violation.Policy.ID]; ok {
-			summary.Violations++
-			summaryMap[violation.Policy.ID] = summary
-		} else {
-			summaryMap[violation.Policy.ID] = resultSummary{
-				Policy:     violation.Policy,
-				Violations: 1,
+		summary, ok := summaryMap[violation.Policy.ID]
+		if !ok {
+			summary = resultSummary{Policy: violation.Policy}
+		}
+		summary.Violations++
+		for _, owner := range violation.Owners {
+			owned = true
+			if !containsString(summary.Owners, owner) {
+				summary.Owners = append(summary.Owners, owner)
 			}
 		}
+		summaryMap[violation.Policy.ID] = summary
 	}
 
 	columns := []string{
@@ -237,28 +713,152 @@ func (r *Result) MarkdowSummary() string {
 		"Severity",
 		"Violations",
 	}
+	if warnOnly {
+		columns = append(columns, "Mode")
+	}
+	if owned {
+		columns = append(columns, "Owners")
+	}
 
 	rows := [][]string{}
 	for _, item := range summaryMap {
-		rows = append(rows, []string{
+		row := []string{
 			item.Policy.Name,
 			item.Policy.Category,
 			item.Policy.Severity,
 			fmt.Sprint(item.Violations),
-		})
+		}
+		if warnOnly {
+			row = append(row, item.Policy.Mode)
+		}
+		if owned {
+			row = append(row, strings.Join(item.Owners, ", "))
+		}
+		rows = append(rows, row)
 	}
 
 	md := markdown.New()
 	md.Head3("Scanned %d resources, found %d violations", r.Scanned, r.ViolationCount)
 	md.Table(columns, rows)
+	if warnOnly {
+		md.Paragraph("%d violation(s) of warn-only policies do not fail the validation", r.warnings())
+	}
+	if r.SuppressedCount > 0 {
+		md.Paragraph("%d violation(s) suppressed by annotations, comments or exceptions", r.SuppressedCount)
+	}
+	if r.BaselinedCount > 0 || len(r.FixedBaseline) > 0 {
+		md.Paragraph("%d violation(s) accepted by the baseline, %d baseline entries fixed", r.BaselinedCount, len(r.FixedBaseline))
+	}
 
 	if r.PullRequestURL != nil {
 		md.Paragraph("This PR %s remediates %d violation(s)", *r.PullRequestURL, r.Remediated)
+		if r.CommitSignature != nil {
+			md.Paragraph("Remediation commit signature: %s", r.CommitSignature)
+		}
 	}
 
+	r.markdownAuthors(md)
+
+	return md.String()
+}
+
+// MarkdownDetails returns the violations of each policy in markdown
+func (r *Result) MarkdownDetails() string {
+	var policies []Policy
+	violationsMap := make(map[string][]Violation)
+	for _, violation := range r.Violations {
+		if _, ok := violationsMap[violation.Policy.ID]; !ok {
+			policies = append(policies, violation.Policy)
+		}
+		violationsMap[violation.Policy.ID] = append(violationsMap[violation.Policy.ID], violation)
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+
+	md := markdown.New()
+	for _, policy := range policies {
+		violations := violationsMap[policy.ID]
+		labels := policy.Severity
+		if policy.Mode == ModeWarnOnly {
+			labels += ", " + ModeWarnOnly
+		}
+		summary := fmt.Sprintf("%s (%s) - %d violation(s)", policy.Name, labels, len(violations))
+		md.Details(summary, func(md *markdown.Markdown) {
+			for _, violation := range violations {
+				md.ListItem(
+					"`%s/%s` %s (%s#%d)",
+					violation.Entity.Kind,
+					violation.Entity.Name,
+					violation.Message,
+					violation.Location.Path,
+					violation.Location.StartLine,
+				)
+			}
+			if policy.HowToSolve != "" {
+				md.Paragraph("")
+				md.Paragraph("**How to solve:** %s", policy.HowToSolve)
+			}
+		})
+	}
 	return md.String()
 }
 
+// markdownAuthors adds the violations grouped by the author of the violating lines, nothing is added if
+// the violations are not blamed
+func (r *Result) markdownAuthors(md *markdown.Markdown) {
+	type authorSummary struct {
+		author     string
+		violations int
+		policies   map[string]bool
+	}
+
+	var blamed bool
+	summaryMap := make(map[string]*authorSummary)
+	for _, violation := range r.Violations {
+		author := "Not committed"
+		if violation.Blame != nil {
+			blamed = true
+			author = fmt.Sprintf("%s (%s)", violation.Blame.Author, violation.Blame.Email)
+		}
+		summary, ok := summaryMap[author]
+		if !ok {
+			summary = &authorSummary{author: author, policies: make(map[string]bool)}
+			summaryMap[author] = summary
+		}
+		summary.violations++
+		summary.policies[violation.Policy.Name] = true
+	}
+	if !blamed {
+		return
+	}
+
+	var summaries []*authorSummary
+	for _, summary := range summaryMap {
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].violations != summaries[j].violations {
+			return summaries[i].violations > summaries[j].violations
+		}
+		return summaries[i].author < summaries[j].author
+	})
+
+	rows := [][]string{}
+	for _, summary := range summaries {
+		var policies []string
+		for policy := range summary.policies {
+			policies = append(policies, policy)
+		}
+		sort.Strings(policies)
+		rows = append(rows, []string{summary.author, fmt.Sprint(summary.violations), strings.Join(policies, ", ")})
+	}
+
+	md.Head3("Violations by author")
+	md.Table([]string{"Author", "Violations", "Policies"}, rows)
+}
+
 func (r *Result) Print() {
 	fmt.Println(r.TEXT())
 }
@@ -271,6 +871,15 @@ func tojson(in interface{}) (string, error) {
 	return string(output), nil
 }
 
+func containsString(items []string, item string) bool {
+	for i := range items {
+		if items[i] == item {
+			return true
+		}
+	}
+	return false
+}
+
 func matchSecurityCategory(category string) bool {
 	return strings.Contains(category, "security")
 }
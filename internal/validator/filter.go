@@ -0,0 +1,71 @@
+package validator
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ResourceFilter selects the validated resources, empty fields select all resources
+type ResourceFilter struct {
+	kinds     []string
+	namespace string
+	name      string
+	selector  labels.Selector
+}
+
+// NewResourceFilter creates new resource filter of the kinds, namespace and name globs and the kubernetes
+// label selector
+func NewResourceFilter(kinds []string, namespace, name, selector string) (*ResourceFilter, error) {
+	filter := &ResourceFilter{
+		kinds:     kinds,
+		namespace: namespace,
+		name:      name,
+	}
+	for _, glob := range []string{namespace, name} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid resource glob: %s", glob)
+		}
+	}
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource label selector: %s, error: %v", selector, err)
+		}
+		filter.selector = parsed
+	}
+	return filter, nil
+}
+
+// Match reports whether the entity is selected by the filter, kinds are case insensitive
+func (f *ResourceFilter) Match(entity domain.Entity) bool {
+	if len(f.kinds) > 0 && !matchKind(f.kinds, entity.Kind) {
+		return false
+	}
+	if f.namespace != "" {
+		if ok, _ := path.Match(f.namespace, entity.Namespace); !ok {
+			return false
+		}
+	}
+	if f.name != "" {
+		if ok, _ := path.Match(f.name, entity.Name); !ok {
+			return false
+		}
+	}
+	if f.selector != nil && !f.selector.Matches(labels.Set(entity.Labels)) {
+		return false
+	}
+	return true
+}
+
+func matchKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if strings.EqualFold(k, kind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package validator
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/weaveworks/weave-policy-validator/internal/types"
+)
+
+const (
+	// IgnoreAnnotation is the resource annotation listing the comma separated ids of the suppressed policies
+	IgnoreAnnotation = "policy.weave.works/ignore"
+	// IgnoreReasonAnnotation is the resource annotation explaining why the policies are suppressed
+	IgnoreReasonAnnotation = "policy.weave.works/ignore-reason"
+	// IgnoreComment prefixes the yaml comments suppressing the policies of the key below them
+	IgnoreComment = "weave:ignore"
+)
+
+var errMissingReason = errors.New("suppression ignored: missing reason")
+
+// findSuppression returns the suppression of the policy by the resource annotations or by the comments
+// directly above the violating line, suppressions without reason are invalid
+func findSuppression(annotations map[string]string, lines []string, line int, policyID string) (*types.Suppression, error) {
+	if matchPolicyID(annotations[IgnoreAnnotation], policyID) {
+		reason := strings.TrimSpace(annotations[IgnoreReasonAnnotation])
+		if reason == "" {
+			return nil, errMissingReason
+		}
+		return &types.Suppression{Kind: types.SuppressionAnnotation, Reason: reason}, nil
+	}
+
+	// lines are 1-indexed, the comments are the lines before the violating line
+	for i := line - 2; i >= 0 && i < len(lines); i-- {
+		comment := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(comment, "#") {
+			break
+		}
+		fields := strings.Fields(strings.TrimPrefix(comment, "#"))
+		if len(fields) < 2 || fields[0] != IgnoreComment || !matchPolicyID(fields[1], policyID) {
+			continue
+		}
+		if len(fields) == 2 {
+			return nil, errMissingReason
+		}
+		return &types.Suppression{Kind: types.SuppressionComment, Reason: strings.Join(fields[2:], " ")}, nil
+	}
+	return nil, nil
+}
+
+// matchPolicyID reports whether the comma separated ids contain the policy id
+func matchPolicyID(ids, policyID string) bool {
+	for _, id := range strings.Split(ids, ",") {
+		if strings.TrimSpace(id) == policyID {
+			return true
+		}
+	}
+	return false
+}
@@ -3,14 +3,19 @@ package validator
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+	"github.com/weaveworks/weave-policy-validator/internal/exception"
 	"github.com/weaveworks/weave-policy-validator/internal/types"
 )
 
 type Validator struct {
-	validator validation.Validator
-	remediate bool
+	validator  validation.Validator
+	remediate  bool
+	suggest    bool
+	exceptions *exception.Matcher
+	filter     *ResourceFilter
 }
 
 // NewValidator return new validator struct
@@ -21,6 +26,21 @@ func NewValidator(validator validation.Validator, remediate bool) *Validator {
 	}
 }
 
+// SetExceptions sets the policy exceptions excepting violations
+func (v *Validator) SetExceptions(exceptions *exception.Matcher) {
+	v.exceptions = exceptions
+}
+
+// SetSuggestions enables the suggested changes of the remediable violations, used by the pull request reviews
+func (v *Validator) SetSuggestions(suggest bool) {
+	v.suggest = suggest
+}
+
+// SetResourceFilter sets the filter of the validated resources, other resources are skipped
+func (v *Validator) SetResourceFilter(filter *ResourceFilter) {
+	v.filter = filter
+}
+
 // Validate validates resources against policies
 func (v *Validator) Validate(ctx context.Context, files []*types.File) (*types.Result, error) {
 	results := types.Result{
@@ -37,12 +57,21 @@ func (v *Validator) Validate(ctx context.Context, files []*types.File) (*types.R
 			if err != nil {
 				return nil, err
 			}
+			if v.filter != nil && !v.filter.Match(entity) {
+				results.Skipped++
+				continue
+			}
 
 			summary, err := v.validator.Validate(ctx, entity, "")
 			if err != nil {
 				return nil, err
 			}
 
+			annotations := resource.Rendered.Annotations()
+
+			// the resource is remediated once its violations are located and suggested, remediation
+			// changes the raw resource they are computed from
+			var remediations []types.Violation
 			for _, violation := range summary.Violations {
 				for id, occurence := range violation.Occurrences {
 					result := types.Violation{
@@ -55,6 +84,7 @@ func (v *Validator) Validate(ctx context.Context, files []*types.File) (*types.R
 							Category:    violation.Policy.Category,
 							Description: violation.Policy.Description,
 							HowToSolve:  violation.Policy.HowToSolve,
+							Mode:        policyMode(violation.Policy.Modes),
 						},
 						Entity: types.Entity{
 							Name:      entity.Name,
@@ -64,8 +94,18 @@ func (v *Validator) Validate(ctx context.Context, files []*types.File) (*types.R
 						Details: types.Details{
 							ViolatingKey:     occurence.ViolatingKey,
 							RecommendedValue: occurence.RecommendedValue,
+							Message:          occurence.Message,
 						},
 					}
+					for _, parameter := range violation.Policy.Parameters {
+						if parameter.ConfigRef != "" {
+							result.Overrides = append(result.Overrides, types.ParameterOverride{
+								Name:   parameter.Name,
+								Value:  parameter.Value,
+								Config: parameter.ConfigRef,
+							})
+						}
+					}
 
 					startLine, endLine := 1, 1
 					if result.Details.ViolatingKey != nil {
@@ -73,15 +113,6 @@ func (v *Validator) Validate(ctx context.Context, files []*types.File) (*types.R
 						if endLine < startLine {
 							endLine = startLine
 						}
-
-						if v.remediate && result.Details.RecommendedValue != nil {
-							remediated, err := resource.Remediate(*result.Details.ViolatingKey, result.Details.RecommendedValue)
-							if err == nil && remediated {
-								file.Remediated = true
-								resource.Remediated = true
-								results.Remediated++
-							}
-						}
 					}
 
 					result.Location = types.Location{
@@ -90,12 +121,76 @@ func (v *Validator) Validate(ctx context.Context, files []*types.File) (*types.R
 						EndLine:   endLine,
 					}
 
+					var lines []string
+					if resource.Raw != nil {
+						lines, _ = file.Lines()
+					}
+					if startLine >= 1 && endLine <= len(lines) {
+						result.Details.Content = types.NormalizeContent(lines[startLine-1 : endLine])
+					}
+					suppression, err := findSuppression(annotations, lines, startLine, result.Policy.ID)
+					if err != nil {
+						result.Message = fmt.Sprintf("%s, %v", result.Message, err)
+					}
+					if suppression == nil && v.exceptions != nil {
+						suppression = v.exceptions.Match(result)
+					}
+					if suppression != nil {
+						result.Suppression = suppression
+						results.Suppressed = append(results.Suppressed, result)
+						results.SuppressedCount++
+						continue
+					}
+
+					if result.Details.ViolatingKey != nil {
+						if v.suggest && result.Details.RecommendedValue != nil && resource.Raw != nil {
+							lines, err := file.Lines()
+							if err == nil {
+								result.Details.Suggestion, err = resource.Suggestion(lines, *result.Details.ViolatingKey, result.Details.RecommendedValue)
+							}
+							if err != nil {
+								log.Printf("failed to suggest change of violation: %s, error: %v", result.ID, err)
+							}
+						}
+
+						if v.remediate && result.Details.RecommendedValue != nil {
+							remediations = append(remediations, result)
+						}
+					}
+
 					results.Violations = append(results.Violations, result)
 					results.ViolationCount++
 				}
 			}
+
+			for _, violation := range remediations {
+				remediated, err := resource.Remediate(*violation.Details.ViolatingKey, violation.Details.RecommendedValue)
+				if err == nil && remediated {
+					file.Remediated = true
+					resource.Remediated = true
+					results.Remediated++
+				}
+			}
 			results.Scanned++
 		}
 	}
+
+	if v.exceptions != nil {
+		for _, violation := range v.exceptions.ExpiredViolations() {
+			results.Violations = append(results.Violations, violation)
+			results.ViolationCount++
+		}
+	}
 	return &results, nil
 }
+
+// policyMode returns the mode of the policy in the validation, policies declaring the warn-only mode do not
+// fail the validation
+func policyMode(modes []string) string {
+	for _, mode := range modes {
+		if mode == types.ModeWarnOnly {
+			return types.ModeWarnOnly
+		}
+	}
+	return types.ModeEnforce
+}
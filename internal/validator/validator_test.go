@@ -2,13 +2,17 @@ package validator
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
 	"github.com/weaveworks/weave-policy-validator/internal/policy"
 	"github.com/weaveworks/weave-policy-validator/internal/source"
 	"github.com/weaveworks/weave-policy-validator/internal/types"
+	"github.com/weaveworks/weave-policy-validator/internal/yaml"
 )
 
 func TestValidator(t *testing.T) {
@@ -147,3 +151,241 @@ func TestValidator(t *testing.T) {
 		assert.Equal(t, test.result.Remediated, result.Remediated, "wrong remediated")
 	}
 }
+
+func TestSuppressions(t *testing.T) {
+	entitySource, err := source.GetSourceFromPath("testdata/suppressions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policySource, err := source.GetSourceFromPath("../../tests/data/policies/kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opaValidator := validation.NewOPAValidator(policy.NewFilesystemSource(policySource), false, "", "", "", false)
+	validator := NewValidator(opaValidator, true)
+
+	ctx := context.Background()
+	files, err := entitySource.ResourceFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := validator.Validate(ctx, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 0, result.ViolationCount)
+	assert.Equal(t, 2, result.SuppressedCount)
+	assert.Equal(t, 0, result.Remediated, "suppressed violations should not be remediated")
+
+	suppressions := make(map[string]*types.Suppression)
+	for _, violation := range result.Suppressed {
+		suppressions[violation.Policy.ID] = violation.Suppression
+	}
+	assert.Equal(t, map[string]*types.Suppression{
+		"magalix.policies.containers-running-in-privileged-mode": {
+			Kind:   types.SuppressionAnnotation,
+			Reason: "the agent manages the node network",
+		},
+		"magalix.policies.containers-running-with-privilege-escalation": {
+			Kind:   types.SuppressionComment,
+			Reason: "required by privileged mode",
+		},
+	}, suppressions)
+}
+
+// fakeValidator returns the violations for every entity
+type fakeValidator struct {
+	violations []domain.PolicyValidation
+}
+
+func (f fakeValidator) Validate(ctx context.Context, entity domain.Entity, trigger string) (*domain.PolicyValidationSummary, error) {
+	return &domain.PolicyValidationSummary{Violations: f.violations}, nil
+}
+
+func TestSuggestions(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "deployment.yaml"), []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          securityContext:
+            privileged: true
+`), 0644))
+
+	contextKey := "spec.template.spec.containers[0].securityContext"
+	escalationKey := contextKey + ".allowPrivilegeEscalation"
+	violations := []domain.PolicyValidation{
+		{
+			ID:     "context",
+			Policy: domain.Policy{ID: "weave.policies.security-context"},
+			Occurrences: []domain.Occurrence{
+				{ViolatingKey: &contextKey, RecommendedValue: map[string]interface{}{"privileged": false}},
+			},
+		},
+		{
+			ID:     "escalation",
+			Policy: domain.Policy{ID: "weave.policies.privilege-escalation"},
+			Occurrences: []domain.Occurrence{
+				{ViolatingKey: &escalationKey, RecommendedValue: false},
+			},
+		},
+	}
+
+	suggestions := func(remediate bool) map[string]*yaml.Patch {
+		entitySource, err := source.GetSourceFromPath(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validator := NewValidator(fakeValidator{violations: violations}, remediate)
+		validator.SetSuggestions(true)
+
+		ctx := context.Background()
+		files, err := entitySource.ResourceFiles(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := validator.Validate(ctx, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patches := make(map[string]*yaml.Patch)
+		for _, violation := range result.Violations {
+			patches[violation.Policy.ID] = violation.Details.Suggestion
+		}
+		return patches
+	}
+
+	// remediating a violation of the resource does not change the suggestions of its other violations
+	expected := suggestions(false)
+	if assert.NotNil(t, expected["weave.policies.privilege-escalation"]) {
+		assert.Equal(t, 11, expected["weave.policies.privilege-escalation"].StartLine)
+	}
+	assert.Equal(t, expected, suggestions(true))
+}
+
+func TestFindSuppression(t *testing.T) {
+	const policyID = "weave.policies.privileged"
+	lines := []string{
+		"spec:",
+		"  # weave:ignore weave.policies.other,weave.policies.privileged needed by the agent",
+		"  # unrelated comment",
+		"  privileged: true",
+		"  # weave:ignore weave.policies.privileged",
+		"  hostNetwork: true",
+		"  # weave:ignore weave.policies.privileged not directly above",
+		"",
+		"  hostPID: true",
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		line        int
+		suppression *types.Suppression
+		err         bool
+	}{
+		{
+			name:        "annotation",
+			annotations: map[string]string{IgnoreAnnotation: "weave.policies.other, weave.policies.privileged", IgnoreReasonAnnotation: "node agent"},
+			line:        9,
+			suppression: &types.Suppression{Kind: types.SuppressionAnnotation, Reason: "node agent"},
+		},
+		{
+			name:        "annotation without reason",
+			annotations: map[string]string{IgnoreAnnotation: policyID},
+			line:        9,
+			err:         true,
+		},
+		{
+			name:        "annotation of other policy",
+			annotations: map[string]string{IgnoreAnnotation: "weave.policies.other", IgnoreReasonAnnotation: "node agent"},
+			line:        9,
+		},
+		{
+			name:        "comment",
+			line:        4,
+			suppression: &types.Suppression{Kind: types.SuppressionComment, Reason: "needed by the agent"},
+		},
+		{
+			name: "comment without reason",
+			line: 6,
+			err:  true,
+		},
+		{
+			name: "comment not directly above",
+			line: 9,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suppression, err := findSuppression(test.annotations, lines, test.line, policyID)
+			assert.Equal(t, test.err, err != nil)
+			assert.Equal(t, test.suppression, suppression)
+		})
+	}
+}
+
+func TestResourceFilter(t *testing.T) {
+	entitySource, err := source.GetSourceFromPath("../../tests/data/entities/kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policySource, err := source.GetSourceFromPath("../../tests/data/policies/kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opaValidator := validation.NewOPAValidator(policy.NewFilesystemSource(policySource), false, "", "", "", false)
+
+	tests := []struct {
+		name       string
+		kinds      []string
+		namespace  string
+		resource   string
+		selector   string
+		scanned    int
+		skipped    int
+		violations int
+	}{
+		{name: "kind", kinds: []string{"deployment"}, scanned: 2, violations: 6},
+		{name: "other kind", kinds: []string{"StatefulSet"}, skipped: 2},
+		{name: "name glob", resource: "front*", scanned: 1, skipped: 1, violations: 3},
+		{name: "namespace glob", namespace: "kube-*", skipped: 2},
+		{name: "label selector", selector: "app in (backend,api)", scanned: 1, skipped: 1, violations: 3},
+		{name: "label selector mismatch", selector: "app!=frontend,app!=backend", skipped: 2},
+	}
+
+	ctx := context.Background()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := entitySource.ResourceFiles(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter, err := NewResourceFilter(test.kinds, test.namespace, test.resource, test.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			validator := NewValidator(opaValidator, false)
+			validator.SetResourceFilter(filter)
+			result, err := validator.Validate(ctx, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, test.scanned, result.Scanned, "wrong scanned")
+			assert.Equal(t, test.skipped, result.Skipped, "wrong skipped")
+			assert.Equal(t, test.violations, result.ViolationCount, "wrong violations")
+		})
+	}
+
+	_, err = NewResourceFilter(nil, "", "", "app in (frontend")
+	assert.Error(t, err)
+	_, err = NewResourceFilter(nil, "[", "", "")
+	assert.Error(t, err)
+}
@@ -54,6 +54,24 @@ func (n *Node) FindField(path string) (*Node, error) {
 	return nil, nil
 }
 
+// Elements returns the elements of the sequence node
+func (n *Node) Elements() ([]*Node, error) {
+	elements, err := n.RNode.Elements()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*Node, len(elements))
+	for i := range elements {
+		nodes[i] = newNode(elements[i])
+	}
+	return nodes, nil
+}
+
+// Decode decodes the node into the provided object
+func (n *Node) Decode(out interface{}) error {
+	return n.YNode().Decode(out)
+}
+
 // SetField sets field value
 func (n *Node) SetField(path string, value interface{}) error {
 	fields := parseKeyPath(path)
@@ -178,3 +196,122 @@ func (n *Node) EndLine() int {
 	tail := lastChild(n.Document())
 	return tail.Line
 }
+
+// Patch describes replacing the source lines from StartLine to EndLine with Lines
+type Patch struct {
+	StartLine int
+	EndLine   int
+	Lines     []string
+}
+
+// SetFieldPatch returns the patch which sets the field value in the node's source lines,
+// returns nil if the change cannot be expressed as a patch
+func (n *Node) SetFieldPatch(source []string, path string, value interface{}) (*Patch, error) {
+	fields := parseKeyPath(path)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	depth := len(fields)
+	var found *yaml.RNode
+	for ; depth > 0; depth-- {
+		rn, err := n.Pipe(yaml.Lookup(fields[:depth]...))
+		if err != nil {
+			return nil, err
+		}
+		if rn != nil {
+			found = rn
+			break
+		}
+	}
+
+	if found == nil {
+		return nil, nil
+	}
+
+	if depth == len(fields) {
+		// the field exists, replace the key and its value
+		parent, err := n.Pipe(yaml.Lookup(fields[:depth-1]...))
+		if err != nil || parent == nil || parent.YNode().Kind != yaml.MappingNode {
+			return nil, err
+		}
+		field := parent.Field(fields[depth-1])
+		if field == nil {
+			return nil, nil
+		}
+		block, err := fieldBlock(fields[depth-1:], value)
+		if err != nil {
+			return nil, err
+		}
+		key := field.Key.YNode()
+		endLine := lastChild(field.Value.YNode()).Line
+		if endLine < key.Line {
+			endLine = key.Line
+		}
+		return newPatch(source, key.Line, key.Column, endLine, block, false)
+	}
+
+	// the field is missing, insert it on top of the nearest existing parent mapping
+	if found.YNode().Kind != yaml.MappingNode || len(found.YNode().Content) == 0 {
+		return nil, nil
+	}
+	for _, field := range fields[depth:] {
+		if yaml.IsIdxNumber(field) {
+			return nil, nil
+		}
+	}
+	block, err := fieldBlock(fields[depth:], value)
+	if err != nil {
+		return nil, err
+	}
+	first := found.YNode().Content[0]
+	return newPatch(source, first.Line, first.Column, first.Line, block, true)
+}
+
+// fieldBlock encodes the nested fields with the given value as yaml block lines
+func fieldBlock(fields []string, value interface{}) ([]string, error) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		value = map[string]interface{}{fields[i]: value}
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), nil
+}
+
+func newPatch(source []string, startLine, column, endLine int, block []string, keepFirstLine bool) (*Patch, error) {
+	if startLine < 1 || endLine > len(source) {
+		return nil, fmt.Errorf("line %d-%d is out of range", startLine, endLine)
+	}
+
+	line := source[startLine-1]
+	if column < 1 || column > len(line)+1 {
+		return nil, fmt.Errorf("column %d is out of range", column)
+	}
+
+	// the text before the key may contain the sequence item indicator which stays on the first line
+	prefix := line[:column-1]
+	indent := strings.Repeat(" ", len(prefix))
+
+	var lines []string
+	for i := range block {
+		if i == 0 {
+			lines = append(lines, prefix+block[i])
+		} else {
+			lines = append(lines, indent+block[i])
+		}
+	}
+
+	if keepFirstLine {
+		lines = append(lines, indent+line[column-1:])
+	}
+
+	return &Patch{
+		StartLine: startLine,
+		EndLine:   endLine,
+		Lines:     lines,
+	}, nil
+}
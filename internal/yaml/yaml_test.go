@@ -0,0 +1,86 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const patchTestDocument = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: container-1
+          image: nginx
+        - name: container-2
+          securityContext:
+            privileged: true
+`
+
+func TestSetFieldPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		value interface{}
+		patch *Patch
+	}{
+		{
+			name:  "existing scalar field",
+			path:  "spec.replicas",
+			value: 2,
+			patch: &Patch{
+				StartLine: 6,
+				EndLine:   6,
+				Lines:     []string{"  replicas: 2"},
+			},
+		},
+		{
+			name:  "existing field in sequence item",
+			path:  "spec.template.spec.containers[1].securityContext.privileged",
+			value: false,
+			patch: &Patch{
+				StartLine: 14,
+				EndLine:   14,
+				Lines:     []string{"            privileged: false"},
+			},
+		},
+		{
+			name:  "missing field in sequence item",
+			path:  "spec.template.spec.containers[0].securityContext.allowPrivilegeEscalation",
+			value: false,
+			patch: &Patch{
+				StartLine: 10,
+				EndLine:   10,
+				Lines: []string{
+					"        - securityContext:",
+					"            allowPrivilegeEscalation: false",
+					"          name: container-1",
+				},
+			},
+		},
+		{
+			name:  "missing sequence item",
+			path:  "spec.template.spec.containers[2].image",
+			value: "nginx",
+		},
+	}
+
+	source := strings.Split(patchTestDocument, "\n")
+	for _, test := range tests {
+		nodes, err := StringParse(patchTestDocument)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patch, err := nodes[0].SetFieldPatch(source, test.path, test.value)
+		if err != nil {
+			t.Fatalf("%s: unexpected error, %v", test.name, err)
+		}
+		assert.Equal(t, test.patch, patch, test.name)
+	}
+}
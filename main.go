@@ -4,13 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+	"github.com/weaveworks/weave-policy-validator/internal/baseline"
+	"github.com/weaveworks/weave-policy-validator/internal/blame"
+	"github.com/weaveworks/weave-policy-validator/internal/ci"
+	"github.com/weaveworks/weave-policy-validator/internal/codeowners"
+	"github.com/weaveworks/weave-policy-validator/internal/config"
+	"github.com/weaveworks/weave-policy-validator/internal/diff"
+	"github.com/weaveworks/weave-policy-validator/internal/exception"
 	"github.com/weaveworks/weave-policy-validator/internal/git"
 	"github.com/weaveworks/weave-policy-validator/internal/policy"
 	"github.com/weaveworks/weave-policy-validator/internal/source"
@@ -21,8 +32,31 @@ import (
 
 const (
 	trigger string = "iac"
+
+	// policyParamSource is the source of the parameters overridden by flags
+	policyParamSource = "--policy-param"
+)
+
+// exit codes of the validation
+const (
+	// exitViolations is returned when violations reach the severity thresholds
+	exitViolations = 1
+	// exitError is returned when the validator fails or is misconfigured
+	exitError = 2
+	// exitRenderError is returned when the resources of a source fail to render
+	exitRenderError = 3
 )
 
+// renderError is the error of a source failing to render its resources
+type renderError struct {
+	path string
+	err  error
+}
+
+func (e *renderError) Error() string {
+	return fmt.Sprintf("failed to render resources, path: %s, error: %v", e.path, e.err)
+}
+
 type SourceConf struct {
 	Path           string
 	HelmValuesFile string
@@ -32,27 +66,104 @@ type Config struct {
 	EntitySourceConf   SourceConf
 	PoliciesSourceConf SourceConf
 
+	// RepositoryRoot is the directory reported and committed paths are relative to
+	RepositoryRoot string
+
+	// resource filter config, other resources are skipped
+	ResourceKinds     []string
+	ResourceNamespace string
+	ResourceName      string
+	ResourceSelector  string
+
 	// output config
 	NoExitError     bool
 	SASTOutputFile  string
 	SARIFOutputFile string
 	JSONOutputFile  string
+	// Output receives the text report and the verbose output, defaults to stdout
+	Output io.Writer
+
+	// SeverityThresholds are the min severities of the violations exiting with error
+	SeverityThresholds types.SeverityThresholds
 
 	// remediation config
 	Remediate bool
 
+	// report only violations on the lines changed since the base branch
+	ChangedLinesOnly bool
+
+	// validate only the sources affected by the files changed since the git ref
+	ChangedSince string
+
+	// attribute violations to the last commit changing their lines
+	Blame bool
+
+	// Baseline is the file of the accepted violations not counted toward the exit code
+	Baseline string
+	// BaselineCreate is the file the baseline of the current violations is written to
+	BaselineCreate string
+
+	// ExceptionsFile is the file of the policy exceptions excepting violations
+	ExceptionsFile string
+
+	// PolicyConfigPath is the path of the PolicyConfig resources overriding the policy parameters
+	PolicyConfigPath string
+
+	// ConfigFile is the configuration file of the validator
+	ConfigFile string
+	// PolicySelection selects the applied policies in addition to the config file selection
+	PolicySelection types.PolicySelection
+	// PolicyParameters override the policy parameters after the config file overrides
+	PolicyParameters []policy.Parameter
+	// WarnOnlyPolicies are the globs of the ids of the policies reporting violations without failing
+	WarnOnlyPolicies []string
+
+	// Verbose prints the effective policy parameters
+	Verbose bool
+
+	// assign violations to the CODEOWNERS owners of their paths
+	CodeOwners bool
+	// OwnerMaxViolations is the max violations allowed per owner before failing
+	OwnerMaxViolations map[string]int
+
 	// git repo config
 	GitRepositoryProvider string
 	GitRepositoryHost     string
 	GitRepositoryURL      string
 	GitRepositoryToken    string
 	GitRepositoryBranch   string
+	GitRepositoryBase     string
 	GitRepositorySHA      string
+	GitRepositoryPR       int
+
+	// ci config
+	CISystem      string
+	CIAnnotations bool
+	PrintCIEnv    bool
+
+	// git provider http config
+	GitTimeout    time.Duration
+	GitMaxRetries int
+	GitProxy      string
+	GitCAFile     string
 
 	// azure config
 	AzureProject string
 
-	GenerateGitProviderReport bool
+	// github app config
+	GithubAppID             int64
+	GithubAppInstallationID int64
+	GithubAppPrivateKeyFile string
+
+	// commit signing config
+	CommitSigningKeyFile    string
+	CommitSigningPassphrase string
+	CommitAuthorName        string
+	CommitAuthorEmail       string
+
+	GenerateGitProviderReport  bool
+	GenerateGitProviderReview  bool
+	GenerateGitProviderComment bool
 }
 
 func (c *Config) ValidateGitRepositoryConf() error {
@@ -71,15 +182,137 @@ func (c *Config) ValidateGitRepositoryConf() error {
 	if c.GitRepositorySHA == "" {
 		return errors.New("missing git-repo-sha value")
 	}
-	if c.GitRepositoryToken == "" {
+	if (c.GenerateGitProviderReview || c.GenerateGitProviderComment) && c.GitRepositoryPR == 0 {
+		return errors.New("missing git-repo-pull-request value")
+	}
+	if c.GithubAppID != 0 || c.GithubAppPrivateKeyFile != "" {
+		if c.GitRepositoryProvider != git.Github && c.GitRepositoryProvider != git.GithubEnterprise {
+			return errors.New("github app authentication is only supported by github providers")
+		}
+		if err := c.githubAppConf().Validate(); err != nil {
+			return err
+		}
+	} else if c.GitRepositoryToken == "" {
 		return errors.New("missing git-repo-token value")
 	}
 	if c.GitRepositoryProvider == "azure-devops" && c.AzureProject == "" {
 		return errors.New("missing azure project value")
 	}
+	if c.Remediate && c.CommitSigningKeyFile != "" {
+		if err := c.signingConf().Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// ApplyCIEnv fills the git repository config values that are not set explicitly from the detected ci build
+func (c *Config) ApplyCIEnv(env *ci.Env) {
+	c.CISystem = env.System
+	if c.GitRepositoryProvider == "" {
+		c.GitRepositoryProvider = env.Provider
+	}
+	if c.GitRepositoryHost == "" {
+		c.GitRepositoryHost = env.Host
+	}
+	if c.GitRepositoryURL == "" {
+		c.GitRepositoryURL = env.URL
+	}
+	if c.GitRepositoryBranch == "" {
+		c.GitRepositoryBranch = env.Branch
+	}
+	if c.GitRepositoryBase == "" {
+		c.GitRepositoryBase = env.BaseBranch
+	}
+	if c.GitRepositorySHA == "" {
+		c.GitRepositorySHA = env.SHA
+	}
+	if c.GitRepositoryPR == 0 {
+		c.GitRepositoryPR = env.PullRequest
+	}
+	if c.GitRepositoryToken == "" {
+		c.GitRepositoryToken = env.Token
+	}
+	if c.AzureProject == "" {
+		c.AzureProject = env.AzureProject
+	}
+}
+
+// WriteCIEnv writes the detected ci system and the effective git repository config, the token is masked
+func (c *Config) WriteCIEnv(w io.Writer) error {
+	system := c.CISystem
+	if system == "" {
+		system = "none"
+	}
+	token := c.GitRepositoryToken
+	if token != "" {
+		token = "***"
+	}
+	pullRequest := ""
+	if c.GitRepositoryPR != 0 {
+		pullRequest = fmt.Sprint(c.GitRepositoryPR)
+	}
+
+	_, err := fmt.Fprintf(w, "CI_SYSTEM=%s\n"+
+		"WEAVE_REPO_PROVIDER=%s\n"+
+		"WEAVE_REPO_HOST=%s\n"+
+		"WEAVE_REPO_URL=%s\n"+
+		"WEAVE_REPO_BRANCH=%s\n"+
+		"WEAVE_REPO_BASE_BRANCH=%s\n"+
+		"WEAVE_REPO_SHA=%s\n"+
+		"WEAVE_REPO_PULL_REQUEST=%s\n"+
+		"WEAVE_REPO_TOKEN=%s\n"+
+		"AZURE_PROJECT=%s\n",
+		system,
+		c.GitRepositoryProvider,
+		c.GitRepositoryHost,
+		c.GitRepositoryURL,
+		c.GitRepositoryBranch,
+		c.GitRepositoryBase,
+		c.GitRepositorySHA,
+		pullRequest,
+		token,
+		c.AzureProject,
+	)
+	return err
+}
+
+// GitRepositoryConf returns git repository provider config
+func (c *Config) GitRepositoryConf() git.Config {
+	return git.Config{
+		Provider:     c.GitRepositoryProvider,
+		Host:         c.GitRepositoryHost,
+		URL:          c.GitRepositoryURL,
+		Token:        c.GitRepositoryToken,
+		AzureProject: c.AzureProject,
+		GithubApp:    c.githubAppConf(),
+		HTTP: git.HTTPConfig{
+			Timeout:    c.GitTimeout,
+			MaxRetries: c.GitMaxRetries,
+			ProxyURL:   c.GitProxy,
+			CAFile:     c.GitCAFile,
+		},
+		Signing: c.signingConf(),
+	}
+}
+
+func (c *Config) signingConf() git.SigningConfig {
+	return git.SigningConfig{
+		KeyFile:     c.CommitSigningKeyFile,
+		Passphrase:  c.CommitSigningPassphrase,
+		AuthorName:  c.CommitAuthorName,
+		AuthorEmail: c.CommitAuthorEmail,
+	}
+}
+
+func (c *Config) githubAppConf() git.GithubAppConfig {
+	return git.GithubAppConfig{
+		AppID:          c.GithubAppID,
+		InstallationID: c.GithubAppInstallationID,
+		PrivateKeyFile: c.GithubAppPrivateKeyFile,
+	}
+}
+
 func main() {
 	conf := Config{}
 	app := cli.NewApp()
@@ -93,7 +326,6 @@ func main() {
 			Name:        "path",
 			Usage:       "path to scan resources from",
 			Destination: &conf.EntitySourceConf.Path,
-			Required:    true,
 		},
 		&cli.StringFlag{
 			Name:        "helm-values-file",
@@ -103,7 +335,6 @@ func main() {
 		&cli.StringFlag{
 			Name:        "policies-path",
 			Usage:       "path to policies kustomization directory",
-			Required:    true,
 			Destination: &conf.PoliciesSourceConf.Path,
 		},
 		&cli.StringFlag{
@@ -111,6 +342,12 @@ func main() {
 			Usage:       "path to policies helm values file",
 			Destination: &conf.PoliciesSourceConf.HelmValuesFile,
 		},
+		&cli.PathFlag{
+			Name:        "repo-root",
+			Usage:       "repository root directory reported and committed paths are relative to, detected from the .git directory of the path if not set",
+			Destination: &conf.RepositoryRoot,
+			EnvVars:     []string{"WEAVE_REPO_ROOT"},
+		},
 		&cli.StringFlag{
 			Name:        "git-repo-provider",
 			Usage:       "git repository provider",
@@ -135,24 +372,104 @@ func main() {
 			Destination: &conf.GitRepositoryBranch,
 			EnvVars:     []string{"WEAVE_REPO_BRANCH"},
 		},
+		&cli.StringFlag{
+			Name:        "git-repo-base-branch",
+			Usage:       "git repository pull request base branch",
+			Destination: &conf.GitRepositoryBase,
+			EnvVars:     []string{"WEAVE_REPO_BASE_BRANCH"},
+		},
 		&cli.StringFlag{
 			Name:        "git-repo-sha",
 			Usage:       "git repository commit sha",
 			Destination: &conf.GitRepositorySHA,
 			EnvVars:     []string{"WEAVE_REPO_SHA"},
 		},
+		&cli.IntFlag{
+			Name:        "git-repo-pull-request",
+			Usage:       "git repository pull request number",
+			Destination: &conf.GitRepositoryPR,
+			EnvVars:     []string{"WEAVE_REPO_PULL_REQUEST"},
+		},
 		&cli.StringFlag{
 			Name:        "git-repo-token",
 			Usage:       "git repository token",
 			Destination: &conf.GitRepositoryToken,
 			EnvVars:     []string{"WEAVE_REPO_TOKEN"},
 		},
+		&cli.DurationFlag{
+			Name:        "git-timeout",
+			Usage:       "timeout of each attempt of git provider api calls",
+			Value:       git.DefaultHTTPConfig().Timeout,
+			Destination: &conf.GitTimeout,
+			EnvVars:     []string{"WEAVE_GIT_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:        "git-max-retries",
+			Usage:       "max retries of failed or rate limited git provider api calls",
+			Value:       git.DefaultHTTPConfig().MaxRetries,
+			Destination: &conf.GitMaxRetries,
+			EnvVars:     []string{"WEAVE_GIT_MAX_RETRIES"},
+		},
+		&cli.StringFlag{
+			Name:        "git-proxy",
+			Usage:       "proxy url of git provider api calls, defaults to the proxy environment variables",
+			Destination: &conf.GitProxy,
+			EnvVars:     []string{"WEAVE_GIT_PROXY"},
+		},
+		&cli.PathFlag{
+			Name:        "git-ca-file",
+			Usage:       "path to ca certificates file trusted by git provider api calls",
+			Destination: &conf.GitCAFile,
+			EnvVars:     []string{"WEAVE_GIT_CA_FILE"},
+		},
 		&cli.StringFlag{
 			Name:        "azure-project",
 			Usage:       "azure project name",
 			Destination: &conf.AzureProject,
 			EnvVars:     []string{"AZURE_PROJECT"},
 		},
+		&cli.Int64Flag{
+			Name:        "github-app-id",
+			Usage:       "github app id, used instead of git-repo-token to authenticate as a github app",
+			Destination: &conf.GithubAppID,
+			EnvVars:     []string{"WEAVE_GITHUB_APP_ID"},
+		},
+		&cli.Int64Flag{
+			Name:        "github-app-installation-id",
+			Usage:       "github app installation id, discovered from the repository if not set",
+			Destination: &conf.GithubAppInstallationID,
+			EnvVars:     []string{"WEAVE_GITHUB_APP_INSTALLATION_ID"},
+		},
+		&cli.PathFlag{
+			Name:        "github-app-private-key-file",
+			Usage:       "path to github app private key file",
+			Destination: &conf.GithubAppPrivateKeyFile,
+			EnvVars:     []string{"WEAVE_GITHUB_APP_PRIVATE_KEY_FILE"},
+		},
+		&cli.PathFlag{
+			Name:        "commit-signing-key-file",
+			Usage:       "path to armored gpg or ssh private key signing the remediation commits",
+			Destination: &conf.CommitSigningKeyFile,
+			EnvVars:     []string{"WEAVE_COMMIT_SIGNING_KEY_FILE"},
+		},
+		&cli.StringFlag{
+			Name:        "commit-signing-key-passphrase",
+			Usage:       "passphrase of the commit signing key",
+			Destination: &conf.CommitSigningPassphrase,
+			EnvVars:     []string{"WEAVE_COMMIT_SIGNING_KEY_PASSPHRASE"},
+		},
+		&cli.StringFlag{
+			Name:        "commit-author-name",
+			Usage:       "author name of the signed remediation commits",
+			Destination: &conf.CommitAuthorName,
+			EnvVars:     []string{"WEAVE_COMMIT_AUTHOR_NAME"},
+		},
+		&cli.StringFlag{
+			Name:        "commit-author-email",
+			Usage:       "author email of the signed remediation commits, must match the email of the signing key",
+			Destination: &conf.CommitAuthorEmail,
+			EnvVars:     []string{"WEAVE_COMMIT_AUTHOR_EMAIL"},
+		},
 		&cli.PathFlag{
 			Name:        "sast",
 			Usage:       "save result as gitlab sast format",
@@ -168,6 +485,13 @@ func main() {
 			Usage:       "save result as json format",
 			Destination: &conf.JSONOutputFile,
 		},
+		&cli.BoolFlag{
+			Name:        "ci-annotations",
+			Usage:       "annotate violations in the ci build logs if supported",
+			Value:       false,
+			EnvVars:     []string{"WEAVE_CI_ANNOTATIONS"},
+			Destination: &conf.CIAnnotations,
+		},
 		&cli.BoolFlag{
 			Name:        "generate-git-report",
 			Usage:       "generate git report if supported",
@@ -175,21 +499,184 @@ func main() {
 			EnvVars:     []string{"WEAVE_GENERATE_GIT_PROVIDER_REPORT"},
 			Destination: &conf.GenerateGitProviderReport,
 		},
+		&cli.BoolFlag{
+			Name:        "generate-git-review",
+			Usage:       "review the pull request with suggested changes if supported",
+			Value:       false,
+			EnvVars:     []string{"WEAVE_GENERATE_GIT_PROVIDER_REVIEW"},
+			Destination: &conf.GenerateGitProviderReview,
+		},
+		&cli.BoolFlag{
+			Name:        "generate-git-comment",
+			Usage:       "create or update the pull request summary comment",
+			Value:       false,
+			EnvVars:     []string{"WEAVE_GENERATE_GIT_PROVIDER_COMMENT"},
+			Destination: &conf.GenerateGitProviderComment,
+		},
+		&cli.StringSliceFlag{
+			Name:    "resource-kind",
+			Usage:   "validate only the resources of the kind, case insensitive",
+			EnvVars: []string{"WEAVE_RESOURCE_KIND"},
+		},
+		&cli.StringFlag{
+			Name:        "resource-namespace",
+			Usage:       "validate only the resources in the namespaces matching the glob",
+			Destination: &conf.ResourceNamespace,
+			EnvVars:     []string{"WEAVE_RESOURCE_NAMESPACE"},
+		},
+		&cli.StringFlag{
+			Name:        "resource-name",
+			Usage:       "validate only the resources with names matching the glob",
+			Destination: &conf.ResourceName,
+			EnvVars:     []string{"WEAVE_RESOURCE_NAME"},
+		},
+		&cli.StringFlag{
+			Name:        "resource-selector",
+			Usage:       "validate only the resources matching the kubernetes label selector, e.g. app=frontend,tier!=cache",
+			Destination: &conf.ResourceSelector,
+			EnvVars:     []string{"WEAVE_RESOURCE_SELECTOR"},
+		},
 		&cli.BoolFlag{
 			Name:        "remediate",
 			Usage:       "auto remediate resources if possible",
 			Value:       false,
 			Destination: &conf.Remediate,
 		},
+		&cli.StringFlag{
+			Name:        "changed-since",
+			Usage:       "validate only the sources affected by the files changed since the given git ref",
+			Destination: &conf.ChangedSince,
+			EnvVars:     []string{"WEAVE_CHANGED_SINCE"},
+		},
+		&cli.BoolFlag{
+			Name:        "changed-lines-only",
+			Usage:       "report only violations on lines changed since the git-repo-base-branch, other violations are marked as pre-existing",
+			Value:       false,
+			EnvVars:     []string{"WEAVE_CHANGED_LINES_ONLY"},
+			Destination: &conf.ChangedLinesOnly,
+		},
+		&cli.BoolFlag{
+			Name:        "blame",
+			Usage:       "attribute violations to the author of the last commit changing the violating lines using the local git repository",
+			Destination: &conf.Blame,
+			EnvVars:     []string{"WEAVE_BLAME"},
+		},
+		&cli.StringFlag{
+			Name:        "baseline",
+			Usage:       "baseline file of the accepted violations, only violations not in the baseline are counted",
+			Destination: &conf.Baseline,
+			EnvVars:     []string{"WEAVE_BASELINE"},
+		},
+		&cli.StringFlag{
+			Name:        "baseline-create",
+			Usage:       "write the baseline of the current violations to the file and accept them",
+			Destination: &conf.BaselineCreate,
+			EnvVars:     []string{"WEAVE_BASELINE_CREATE"},
+		},
+		&cli.StringFlag{
+			Name:        "exceptions-file",
+			Usage:       "file of the policy exceptions excepting violations, PolicyException resources of the policies path are also applied",
+			Destination: &conf.ExceptionsFile,
+			EnvVars:     []string{"WEAVE_EXCEPTIONS_FILE"},
+		},
+		&cli.PathFlag{
+			Name:        "policy-config-path",
+			Usage:       "path to PolicyConfig resources overriding the policy parameters, PolicyConfig resources of the policies path are also applied",
+			Destination: &conf.PolicyConfigPath,
+			EnvVars:     []string{"WEAVE_POLICY_CONFIG_PATH"},
+		},
+		&cli.PathFlag{
+			Name:        "config",
+			Usage:       "configuration file of the validator",
+			Destination: &conf.ConfigFile,
+			EnvVars:     []string{"WEAVE_CONFIG"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "policy-include",
+			Usage:   "apply only the policies matching the selector in the format field=value, fields are id, category, tag, severity and standard",
+			EnvVars: []string{"WEAVE_POLICY_INCLUDE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "policy-exclude",
+			Usage:   "skip the policies matching the selector in the format field=value, fields are id, category, tag, severity and standard",
+			EnvVars: []string{"WEAVE_POLICY_EXCLUDE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "warn-only",
+			Usage:   "report the violations of the policies with ids matching the glob without failing the validation",
+			EnvVars: []string{"WEAVE_WARN_ONLY"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "policy-param",
+			Usage:   "override the policy parameter in the format policy.name=value, the value is converted to the parameter type",
+			EnvVars: []string{"WEAVE_POLICY_PARAM"},
+		},
+		&cli.BoolFlag{
+			Name:        "codeowners",
+			Usage:       "assign violations to the owners of their paths in the repository CODEOWNERS file and request their reviews of remediation pull requests",
+			Destination: &conf.CodeOwners,
+			EnvVars:     []string{"WEAVE_CODEOWNERS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "owner-max-violations",
+			Usage:   "max violations allowed for an owner before exiting with error in the format owner=count, violations of other owners fail",
+			EnvVars: []string{"WEAVE_OWNER_MAX_VIOLATIONS"},
+		},
+		&cli.StringFlag{
+			Name:        "fail-on",
+			Usage:       "min severity of the violations exiting with error: low, medium, high or critical, all violations exit with error if not set",
+			Destination: &conf.SeverityThresholds.FailOn,
+			EnvVars:     []string{"WEAVE_FAIL_ON"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "fail-on-category",
+			Usage:   "min severity of the violations of a policy category exiting with error in the format category=severity, overrides fail-on",
+			EnvVars: []string{"WEAVE_FAIL_ON_CATEGORY"},
+		},
 		&cli.BoolFlag{
 			Name:        "no-exit-error",
 			Usage:       "exit with no error",
 			Value:       false,
 			Destination: &conf.NoExitError,
 		},
+		&cli.BoolFlag{
+			Name:        "verbose",
+			Usage:       "print the effective policy parameters",
+			Value:       false,
+			Destination: &conf.Verbose,
+			EnvVars:     []string{"WEAVE_VERBOSE"},
+		},
+		&cli.BoolFlag{
+			Name:        "print-ci-env",
+			Usage:       "print the detected ci environment and exit",
+			Value:       false,
+			Destination: &conf.PrintCIEnv,
+		},
+	}
+
+	app.Commands = []*cli.Command{
+		serveCommand(&conf),
 	}
 
 	app.Before = func(context *cli.Context) error {
+		// pull requests served by the webhooks server are not detected from the environment
+		if context.Args().First() == serveCommandName {
+			return nil
+		}
+		if env, ok := ci.Detect(os.Getenv); ok {
+			conf.ApplyCIEnv(env)
+		}
+		if conf.PrintCIEnv {
+			return nil
+		}
+
+		if conf.EntitySourceConf.Path == "" {
+			return errors.New("missing path value")
+		}
+		if conf.PoliciesSourceConf.Path == "" {
+			return errors.New("missing policies-path value")
+		}
+
 		var err error
 		if conf.EntitySourceConf.Path, err = filepath.Abs(conf.EntitySourceConf.Path); err != nil {
 			return fmt.Errorf("invalid entities path: %w", err)
@@ -197,7 +684,46 @@ func main() {
 		if conf.PoliciesSourceConf.Path, err = filepath.Abs(conf.PoliciesSourceConf.Path); err != nil {
 			return fmt.Errorf("invalid policies path: %w", err)
 		}
-		if conf.Remediate || conf.GenerateGitProviderReport {
+		if conf.ExceptionsFile != "" {
+			if conf.ExceptionsFile, err = filepath.Abs(conf.ExceptionsFile); err != nil {
+				return fmt.Errorf("invalid exceptions file: %w", err)
+			}
+		}
+		if conf.Baseline != "" {
+			if conf.Baseline, err = filepath.Abs(conf.Baseline); err != nil {
+				return fmt.Errorf("invalid baseline file: %w", err)
+			}
+		}
+		if conf.BaselineCreate != "" {
+			if conf.BaselineCreate, err = filepath.Abs(conf.BaselineCreate); err != nil {
+				return fmt.Errorf("invalid baseline create file: %w", err)
+			}
+		}
+		if conf.PolicyConfigPath != "" {
+			if conf.PolicyConfigPath, err = filepath.Abs(conf.PolicyConfigPath); err != nil {
+				return fmt.Errorf("invalid policy config path: %w", err)
+			}
+		}
+		if conf.ConfigFile != "" {
+			if conf.ConfigFile, err = filepath.Abs(conf.ConfigFile); err != nil {
+				return fmt.Errorf("invalid config file: %w", err)
+			}
+		}
+		if conf.RepositoryRoot != "" {
+			if conf.RepositoryRoot, err = filepath.Abs(conf.RepositoryRoot); err != nil {
+				return fmt.Errorf("invalid repository root: %w", err)
+			}
+		}
+		if err := conf.parseFlags(context); err != nil {
+			return err
+		}
+		if conf.ChangedLinesOnly && conf.GitRepositoryBase == "" {
+			return errors.New("missing git-repo-base-branch value")
+		}
+		if conf.CIAnnotations && !ci.SupportsAnnotations(conf.CISystem) {
+			return fmt.Errorf("ci annotations are not supported by ci system: %s", conf.CISystem)
+		}
+		if conf.Remediate || conf.GenerateGitProviderReport || conf.GenerateGitProviderReview || conf.GenerateGitProviderComment {
 			if err := conf.ValidateGitRepositoryConf(); err != nil {
 				return err
 			}
@@ -206,118 +732,502 @@ func main() {
 	}
 
 	app.Action = func(context *cli.Context) error {
+		if conf.PrintCIEnv {
+			return conf.WriteCIEnv(os.Stdout)
+		}
 		return App(context.Context, conf)
 	}
 
 	err := app.Run(os.Args)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		os.Exit(errorExitCode(err))
+	}
+}
+
+// parseFlags parses and validates the slice flags and the thresholds, the flags of the root command are
+// looked up from the serve command too
+func (c *Config) parseFlags(ctx *cli.Context) error {
+	var err error
+	c.ResourceKinds = ctx.StringSlice("resource-kind")
+	if _, err := c.resourceFilter(); err != nil {
+		return err
+	}
+	for _, glob := range ctx.StringSlice("warn-only") {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid warn-only policy glob: %s", glob)
+		}
+		c.WarnOnlyPolicies = append(c.WarnOnlyPolicies, glob)
+	}
+	for _, value := range ctx.StringSlice("policy-param") {
+		parameter, err := policy.ParseParameter(value, policyParamSource)
+		if err != nil {
+			return err
+		}
+		c.PolicyParameters = append(c.PolicyParameters, parameter)
+	}
+	if c.PolicySelection.Include, err = policy.ParseSelector(ctx.StringSlice("policy-include")); err != nil {
+		return err
 	}
+	if c.PolicySelection.Exclude, err = policy.ParseSelector(ctx.StringSlice("policy-exclude")); err != nil {
+		return err
+	}
+	if err := policy.ValidateSelection(c.PolicySelection); err != nil {
+		return err
+	}
+	if thresholds := ctx.StringSlice("owner-max-violations"); len(thresholds) > 0 {
+		if !c.CodeOwners {
+			return errors.New("owner-max-violations requires codeowners")
+		}
+		if c.OwnerMaxViolations, err = parseOwnerThresholds(thresholds); err != nil {
+			return err
+		}
+	}
+	if c.SeverityThresholds.FailOn != "" {
+		if _, ok := types.SeverityLevels[c.SeverityThresholds.FailOn]; !ok {
+			return fmt.Errorf("invalid fail-on severity: %s", c.SeverityThresholds.FailOn)
+		}
+	}
+	if thresholds := ctx.StringSlice("fail-on-category"); len(thresholds) > 0 {
+		if c.SeverityThresholds.Categories, err = parseCategoryThresholds(thresholds); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// App validates resources and exits with error if violations reaching the severity thresholds are found
 func App(ctx context.Context, conf Config) error {
-	files, err := scan(ctx, conf.EntitySourceConf)
+	result, err := run(ctx, conf)
+	if err != nil {
+		return err
+	}
+
+	if code := exitCode(conf, result); code != 0 {
+		os.Exit(code)
+	}
+	return nil
+}
+
+// exitCode returns the exit code of the validation result
+func exitCode(conf Config, result *types.Result) int {
+	if conf.NoExitError {
+		return 0
+	}
+	if !result.Fails(conf.SeverityThresholds, conf.OwnerMaxViolations) {
+		return 0
+	}
+	return exitViolations
+}
+
+// errorExitCode returns the exit code of the error, distinguishing render errors of the sources
+func errorExitCode(err error) int {
+	var renderErr *renderError
+	if errors.As(err, &renderErr) {
+		return exitRenderError
+	}
+	return exitError
+}
+
+// run validates resources, publishes the result to the configured outputs and returns it
+func run(ctx context.Context, conf Config) (*types.Result, error) {
+	var isAffected func(source.Source) (bool, error)
+	if conf.ChangedSince != "" {
+		changedFiles, err := diff.ChangedFiles(ctx, conf.EntitySourceConf.Path, conf.ChangedSince, conf.GitRepositorySHA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get changed files, error: %v", err)
+		}
+		isAffected = func(s source.Source) (bool, error) {
+			return source.IsAffected(s, changedFiles)
+		}
+	}
+
+	files, err := scan(ctx, conf.EntitySourceConf, isAffected)
 	if err != nil {
-		return fmt.Errorf("failed to get resources, error: %v", err)
+		return nil, fmt.Errorf("failed to get resources, error: %w", err)
 	}
 
 	policySource, err := getSource(conf.PoliciesSourceConf)
 	if err != nil {
-		return fmt.Errorf("failed to init policies source, error: %v", err)
+		return nil, fmt.Errorf("failed to init policies source, error: %v", err)
+	}
+	// the policy exceptions and configs kept alongside the policies are loaded from the same files
+	policyFiles, err := policySource.ResourceFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy files, error: %v", err)
 	}
 
+	configFile, err := conf.loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	selection, err := conf.policySelection(configFile)
+	if err != nil {
+		return nil, err
+	}
 	fsPolicySource := policy.NewFilesystemSource(policySource)
+	configs, err := loadPolicyConfigs(ctx, conf.PolicyConfigPath, policyFiles)
+	if err != nil {
+		return nil, err
+	}
+	fsPolicySource.SetConfigs(configs)
+	fsPolicySource.SetParameters(conf.policyParameters(configFile))
+	fsPolicySource.SetMode(trigger)
+	fsPolicySource.SetWarnOnly(conf.WarnOnlyPolicies)
+	selectedPolicySource := policy.NewSelectedSource(fsPolicySource, selection)
+	if conf.Verbose {
+		policies, err := selectedPolicySource.GetAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get policies, error: %v", err)
+		}
+		if err := policy.WriteParameters(conf.output(), policies); err != nil {
+			return nil, err
+		}
+	}
 	// sinks := []domain.PolicyValidationSink{}
-	opaValidator := validation.NewOPAValidator(fsPolicySource, false, "", "", "", false)
+	opaValidator := validation.NewOPAValidator(selectedPolicySource, false, trigger, "", "", false)
 	validator := validator.NewValidator(opaValidator, conf.Remediate)
+	validator.SetSuggestions(conf.GenerateGitProviderReview)
+
+	filter, err := conf.resourceFilter()
+	if err != nil {
+		return nil, err
+	}
+	if filter != nil {
+		validator.SetResourceFilter(filter)
+	}
+
+	root, err := conf.repositoryRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions, err := loadExceptions(conf.ExceptionsFile, policyFiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(exceptions) > 0 {
+		validator.SetExceptions(exception.NewMatcher(exceptions, root, time.Now()))
+	}
 
 	var gitrepo *git.GitRepository
-	if conf.Remediate || conf.GenerateGitProviderReport {
-		gitrepo, err = git.NewGitRepository(
-			conf.GitRepositoryProvider,
-			conf.GitRepositoryHost,
-			conf.GitRepositoryURL,
-			conf.GitRepositoryToken,
-			conf.AzureProject,
-		)
+	if conf.Remediate || conf.GenerateGitProviderReport || conf.GenerateGitProviderReview || conf.GenerateGitProviderComment {
+		gitConf := conf.GitRepositoryConf()
+		gitConf.Dir = root
+		gitrepo, err = git.NewGitRepository(gitConf)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	result, err := validator.Validate(ctx, files)
 	if err != nil {
-		return fmt.Errorf("failed to validate resources, error: %v", err)
+		return nil, fmt.Errorf("failed to validate resources, error: %v", err)
+	}
+	if !selection.Empty() {
+		result.Metadata = &types.Metadata{
+			PolicySelection: &selection,
+			Policies:        selectedPolicySource.Selected(),
+		}
+	}
+
+	// json output keeps the pre-existing violations, the other outputs are restricted to the new ones
+	fullResult := result
+	if conf.ChangedLinesOnly {
+		changes, err := diff.FromGit(ctx, conf.EntitySourceConf.Path, conf.GitRepositoryBase, conf.GitRepositorySHA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get changed lines, error: %v", err)
+		}
+		result.MarkPreExisting(changes.Contains)
+	}
+
+	if conf.Blame {
+		if err := blame.New().Annotate(ctx, result); err != nil {
+			return nil, fmt.Errorf("failed to blame violations, error: %v", err)
+		}
+	}
+
+	result.RelativeTo(root)
+	result.Deduplicate()
+
+	var owners *codeowners.Owners
+	if conf.CodeOwners {
+		owners, err = codeowners.Find(root)
+		if err != nil {
+			return nil, err
+		}
+		if owners != nil {
+			result.AssignOwners(owners.Match)
+		}
+	}
+
+	if conf.Baseline != "" || conf.BaselineCreate != "" {
+		scope := baseline.Scope{
+			Paths:   make(map[string]bool),
+			Partial: filter != nil,
+		}
+		for _, file := range files {
+			scope.Paths[types.RelativePath(root, file.Path)] = true
+		}
+		if policies := selectedPolicySource.Selected(); policies != nil {
+			scope.Policies = make(map[string]bool)
+			for _, id := range policies {
+				scope.Policies[id] = true
+			}
+		}
+		if err := applyBaseline(conf, result, scope); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.ChangedLinesOnly {
+		newResult := result.WithoutPreExisting()
+		result = &newResult
 	}
 
-	result.Print()
+	fmt.Fprintln(conf.output(), result.TEXT())
+
+	if conf.CIAnnotations {
+		if err := ci.Annotate(conf.CISystem, conf.output(), *result, conf.SeverityThresholds); err != nil {
+			return nil, fmt.Errorf("failed to annotate violations, error: %v", err)
+		}
+	}
 
 	if conf.Remediate && !git.IsRemediationBranch(conf.GitRepositoryBranch) {
 		var remediatedFiles []*types.File
 		for _, file := range files {
 			if file.Remediated {
-				remediatedFiles = append(remediatedFiles, file)
+				remediatedFiles = append(remediatedFiles, file.RelativeTo(root))
 			}
 		}
 		if len(remediatedFiles) > 0 {
-			pullRequestURL, err := gitrepo.OpenPullRequest(ctx, conf.GitRepositoryBranch, conf.GitRepositorySHA, remediatedFiles)
+			pullRequestURL, signature, err := gitrepo.OpenPullRequest(ctx, conf.GitRepositoryBranch, conf.GitRepositorySHA, remediatedFiles, filesOwners(owners, remediatedFiles))
 			if err != nil {
-				return err
+				return nil, err
 			}
 			if pullRequestURL != nil {
 				result.PullRequestURL = pullRequestURL
 			}
+			result.CommitSignature = signature
 		}
 	}
 
 	if conf.GenerateGitProviderReport {
-		err = gitrepo.CreateReport(ctx, conf.GitRepositorySHA, *result)
+		err = gitrepo.CreateReport(ctx, conf.GitRepositorySHA, *result, conf.SeverityThresholds, conf.OwnerMaxViolations)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	if conf.GenerateGitProviderReview {
+		err = gitrepo.CreateReview(ctx, conf.GitRepositoryPR, conf.GitRepositorySHA, *result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.GenerateGitProviderComment {
+		err = gitrepo.UpsertSummaryComment(ctx, conf.GitRepositoryPR, *result)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	if conf.SARIFOutputFile != "" {
 		sarif, err := result.SARIF()
 		if err != nil {
-			return fmt.Errorf("failed to export result as sarif, error: %v", err)
+			return nil, fmt.Errorf("failed to export result as sarif, error: %v", err)
 		}
 		err = saveOutputFile(conf.SARIFOutputFile, sarif)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if conf.SASTOutputFile != "" {
 		sast, err := result.SAST()
 		if err != nil {
-			return fmt.Errorf("failed to export result as sast, error: %v", err)
+			return nil, fmt.Errorf("failed to export result as sast, error: %v", err)
 		}
 		err = saveOutputFile(conf.SASTOutputFile, sast)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if conf.JSONOutputFile != "" {
-		js, err := result.JSON()
+		fullResult.PullRequestURL = result.PullRequestURL
+		fullResult.CommitSignature = result.CommitSignature
+		js, err := fullResult.JSON()
 		if err != nil {
-			return fmt.Errorf("failed to export result as json, error: %v", err)
+			return nil, fmt.Errorf("failed to export result as json, error: %v", err)
 		}
 		err = saveOutputFile(conf.JSONOutputFile, js)
 		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// output returns the writer of the text report
+func (c *Config) output() io.Writer {
+	if c.Output == nil {
+		return os.Stdout
+	}
+	return c.Output
+}
+
+// repositoryRoot returns the configured repository root, or the git repository root of the resources
+// path falling back to the working directory
+func (c *Config) repositoryRoot() (string, error) {
+	if c.RepositoryRoot != "" {
+		return c.RepositoryRoot, nil
+	}
+	if root, ok := git.FindRepositoryRoot(c.EntitySourceConf.Path); ok {
+		return root, nil
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory, error: %v", err)
+	}
+	return root, nil
+}
+
+// applyBaseline accepts the violations of the baseline file, the created baseline accepts all the
+// current violations, only the entries of the scope are reported as fixed
+func applyBaseline(conf Config, result *types.Result, scope baseline.Scope) error {
+	if conf.BaselineCreate != "" {
+		accepted := baseline.New(result)
+		if err := accepted.Save(conf.BaselineCreate); err != nil {
 			return err
 		}
+		accepted.Apply(result, scope)
+		return nil
 	}
+	accepted, err := baseline.Load(conf.Baseline)
+	if err != nil {
+		return err
+	}
+	accepted.Apply(result, scope)
+	return nil
+}
 
-	if result.ViolationCount > 0 {
-		if conf.NoExitError {
-			os.Exit(0)
+// loadExceptions loads the exceptions of the exceptions file and the PolicyException resources of the policy files
+func loadExceptions(path string, policyFiles []*types.File) ([]*exception.Exception, error) {
+	exceptions, err := exception.FromFiles(policyFiles)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		fileExceptions, err := exception.Load(path)
+		if err != nil {
+			return nil, err
 		}
-		os.Exit(1)
+		exceptions = append(exceptions, fileExceptions...)
 	}
+	return exceptions, nil
+}
 
-	return nil
+// loadPolicyConfigs loads the PolicyConfig resources of the policy files and the policy config path
+func loadPolicyConfigs(ctx context.Context, path string, policyFiles []*types.File) ([]*policy.Config, error) {
+	if path == "" {
+		return policy.ConfigsFromFiles(policyFiles)
+	}
+	configSource, err := getSource(SourceConf{Path: path})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init policy configs source, error: %v", err)
+	}
+	configFiles, err := configSource.ResourceFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy configs, error: %v", err)
+	}
+	return policy.ConfigsFromFiles(append(append([]*types.File{}, policyFiles...), configFiles...))
+}
+
+// parseOwnerThresholds parses the owner=count thresholds, owners may contain = so the last one separates the count
+func parseOwnerThresholds(values []string) (map[string]int, error) {
+	thresholds := make(map[string]int)
+	for _, value := range values {
+		i := strings.LastIndex(value, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid owner max violations: %s", value)
+		}
+		count, err := strconv.Atoi(value[i+1:])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid owner max violations: %s", value)
+		}
+		thresholds[value[:i]] = count
+	}
+	return thresholds, nil
+}
+
+// resourceFilter returns the filter of the validated resources, nil if all resources are validated
+func (c *Config) resourceFilter() (*validator.ResourceFilter, error) {
+	if len(c.ResourceKinds) == 0 && c.ResourceNamespace == "" && c.ResourceName == "" && c.ResourceSelector == "" {
+		return nil, nil
+	}
+	return validator.NewResourceFilter(c.ResourceKinds, c.ResourceNamespace, c.ResourceName, c.ResourceSelector)
+}
+
+// loadConfigFile loads the configuration file, empty if not set
+func (c *Config) loadConfigFile() (*config.File, error) {
+	if c.ConfigFile == "" {
+		return &config.File{}, nil
+	}
+	return config.Load(c.ConfigFile)
+}
+
+// policySelection returns the policy selection of the config file and flags
+func (c *Config) policySelection(file *config.File) (types.PolicySelection, error) {
+	selection := file.Policies
+	selection.Include.Merge(c.PolicySelection.Include)
+	selection.Exclude.Merge(c.PolicySelection.Exclude)
+	if err := policy.ValidateSelection(selection); err != nil {
+		return selection, err
+	}
+	return selection, nil
+}
+
+// policyParameters returns the parameter overrides of the config file followed by the flags taking precedence
+func (c *Config) policyParameters(file *config.File) []policy.Parameter {
+	parameters := policy.ParametersFromMap(file.Parameters, filepath.Base(c.ConfigFile))
+	return append(parameters, c.PolicyParameters...)
+}
+
+// parseCategoryThresholds parses the category=severity thresholds
+func parseCategoryThresholds(values []string) (map[string]string, error) {
+	thresholds := make(map[string]string)
+	for _, value := range values {
+		i := strings.LastIndex(value, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid fail-on-category threshold: %s", value)
+		}
+		if _, ok := types.SeverityLevels[value[i+1:]]; !ok {
+			return nil, fmt.Errorf("invalid fail-on-category severity: %s", value)
+		}
+		thresholds[value[:i]] = value[i+1:]
+	}
+	return thresholds, nil
+}
+
+// filesOwners returns the distinct codeowners of the files
+func filesOwners(owners *codeowners.Owners, files []*types.File) []string {
+	if owners == nil {
+		return nil
+	}
+	var result []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		for _, owner := range owners.Match(file.Path) {
+			if !seen[owner] {
+				seen[owner] = true
+				result = append(result, owner)
+			}
+		}
+	}
+	return result
 }
 
 func getSource(conf SourceConf) (source.Source, error) {
@@ -333,7 +1243,9 @@ func getSource(conf SourceConf) (source.Source, error) {
 	return s, nil
 }
 
-func scan(ctx context.Context, conf SourceConf) ([]*types.File, error) {
+// scan returns the resource files of the sources found in the path, sources are skipped if isAffected
+// is set and reports them as not affected
+func scan(ctx context.Context, conf SourceConf, isAffected func(source.Source) (bool, error)) ([]*types.File, error) {
 	var paths []string
 	err := filepath.Walk(conf.Path, func(path string, _ os.FileInfo, err error) error {
 		if err != nil {
@@ -358,9 +1270,18 @@ func scan(ctx context.Context, conf SourceConf) ([]*types.File, error) {
 		conf.Path = path
 		if source, err := getSource(conf); err == nil {
 			t.Insert(path)
+			if isAffected != nil {
+				affected, err := isAffected(source)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get source dependencies, path: %s, error: %v", path, err)
+				}
+				if !affected {
+					continue
+				}
+			}
 			kfiles, err := source.ResourceFiles(ctx)
 			if err != nil {
-				return nil, fmt.Errorf("failed to get resources, path: %s, error: %v", path, err)
+				return nil, &renderError{path: path, err: err}
 			}
 			files = append(files, kfiles...)
 		}
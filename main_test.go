@@ -1,12 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+	"github.com/weaveworks/weave-policy-validator/internal/baseline"
+	"github.com/weaveworks/weave-policy-validator/internal/ci"
+	"github.com/weaveworks/weave-policy-validator/internal/exception"
 	"github.com/weaveworks/weave-policy-validator/internal/policy"
+	"github.com/weaveworks/weave-policy-validator/internal/sarif"
+	"github.com/weaveworks/weave-policy-validator/internal/server"
+	"github.com/weaveworks/weave-policy-validator/internal/source"
+	"github.com/weaveworks/weave-policy-validator/internal/types"
 	"github.com/weaveworks/weave-policy-validator/internal/validator"
 )
 
@@ -32,7 +46,7 @@ func TestScanMultipleDirs(t *testing.T) {
 		files, err := scan(ctx, SourceConf{
 			Path:           test.path,
 			HelmValuesFile: test.valuesFile,
-		})
+		}, nil)
 
 		if err != nil {
 			t.Fatalf("unexpected error, %v", err)
@@ -56,3 +70,633 @@ func TestScanMultipleDirs(t *testing.T) {
 		assert.Equal(t, test.violationCount, result.ViolationCount)
 	}
 }
+
+func TestScanAffectedSources(t *testing.T) {
+	tests := []struct {
+		changed  string
+		expected []string
+	}{
+		{
+			changed:  "tests/data/entities/kubernetes/deployments.yaml",
+			expected: []string{"tests/data/entities/kubernetes/deployments.yaml"},
+		},
+		{
+			changed: "tests/data/entities/kustomize/base/deployments.yaml",
+			expected: []string{
+				"tests/data/entities/kustomize/base/deployments.yaml",
+				"tests/data/entities/kustomize/base/deployments.yaml",
+				"tests/data/entities/kustomize/base/deployments.yaml",
+				"tests/data/entities/kustomize/overlays/dev/patches.yaml",
+				"tests/data/entities/kustomize/overlays/prod/patches.yaml",
+			},
+		},
+		{
+			changed:  "README.md",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		isAffected := func(s source.Source) (bool, error) {
+			return source.IsAffected(s, []string{test.changed})
+		}
+		files, err := scan(context.Background(), SourceConf{Path: "tests/data/entities"}, isAffected)
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, filepath.ToSlash(file.Path))
+		}
+		assert.ElementsMatch(t, test.expected, paths, test.changed)
+	}
+}
+
+func TestApplyCIEnv(t *testing.T) {
+	conf := Config{
+		GitRepositoryBranch: "explicit",
+		GitRepositoryToken:  "secret",
+	}
+	conf.ApplyCIEnv(&ci.Env{
+		System:      "github-actions",
+		Provider:    "github",
+		Host:        "github.com",
+		URL:         "https://github.com/weaveworks/policies",
+		Branch:      "feature",
+		BaseBranch:  "main",
+		SHA:         "abc",
+		PullRequest: 12,
+		Token:       "token",
+	})
+
+	assert.Equal(t, "github", conf.GitRepositoryProvider)
+	assert.Equal(t, "explicit", conf.GitRepositoryBranch, "explicit values should take precedence")
+	assert.Equal(t, "main", conf.GitRepositoryBase)
+	assert.Equal(t, 12, conf.GitRepositoryPR)
+	assert.Equal(t, "secret", conf.GitRepositoryToken)
+
+	var out bytes.Buffer
+	assert.NoError(t, conf.WriteCIEnv(&out))
+	assert.Contains(t, out.String(), "CI_SYSTEM=github-actions\n")
+	assert.Contains(t, out.String(), "WEAVE_REPO_URL=https://github.com/weaveworks/policies\n")
+	assert.Contains(t, out.String(), "WEAVE_REPO_TOKEN=***\n")
+	assert.NotContains(t, out.String(), "secret")
+}
+
+func TestJobConfig(t *testing.T) {
+	conf := Config{
+		EntitySourceConf:   SourceConf{Path: "deploy"},
+		PoliciesSourceConf: SourceConf{Path: "/policies"},
+		GitRepositoryToken: "token",
+		ExceptionsFile:     "policy-exceptions.yaml",
+		ConfigFile:         "/etc/weave/config.yaml",
+		SARIFOutputFile:    "/results/results.sarif",
+		BaselineCreate:     "/results/baseline.json",
+	}
+	jobConf := conf.JobConfig(server.Job{
+		Provider:    "gitlab",
+		RepoURL:     "https://gitlab.com/weaveworks/policies",
+		Branch:      "feature",
+		BaseBranch:  "main",
+		SHA:         "abc",
+		PullRequest: 7,
+	}, "/workspace/job-1")
+
+	assert.Equal(t, filepath.Join("/workspace/job-1", "deploy"), jobConf.EntitySourceConf.Path)
+	assert.Equal(t, "/workspace/job-1", jobConf.RepositoryRoot)
+	assert.Equal(t, filepath.Join("/workspace/job-1", "policy-exceptions.yaml"), jobConf.ExceptionsFile)
+	assert.Equal(t, "/etc/weave/config.yaml", jobConf.ConfigFile)
+	assert.Equal(t, "/policies", jobConf.PoliciesSourceConf.Path)
+	assert.Equal(t, "gitlab", jobConf.GitRepositoryProvider)
+	assert.Equal(t, "https://gitlab.com/weaveworks/policies", jobConf.GitRepositoryURL)
+	assert.Equal(t, "feature", jobConf.GitRepositoryBranch)
+	assert.Equal(t, "main", jobConf.GitRepositoryBase)
+	assert.Equal(t, "abc", jobConf.GitRepositorySHA)
+	assert.Equal(t, 7, jobConf.GitRepositoryPR)
+	assert.Equal(t, "token", jobConf.GitRepositoryToken)
+	assert.Equal(t, "/results/results-weaveworks_policies-7-abc.sarif", jobConf.SARIFOutputFile)
+	assert.Equal(t, "/results/baseline-weaveworks_policies-7-abc.json", jobConf.BaselineCreate)
+	assert.Empty(t, jobConf.JSONOutputFile)
+	assert.NoError(t, jobConf.ValidateGitRepositoryConf())
+	assert.Equal(t, "deploy", conf.EntitySourceConf.Path, "base config should not be modified")
+
+	conf.Remediate = true
+	assert.True(t, conf.JobConfig(server.Job{RepoURL: "https://gitlab.com/weaveworks/policies"}, "/workspace/job-1").Remediate)
+	assert.False(t, conf.JobConfig(server.Job{RepoURL: "https://gitlab.com/weaveworks/policies", Fork: true}, "/workspace/job-1").Remediate,
+		"fork pull requests should not be remediated")
+}
+
+func TestWriteJobOutput(t *testing.T) {
+	var out bytes.Buffer
+	job := server.Job{RepoURL: "https://github.com/weaveworks/policies", PullRequest: 7}
+	writeJobOutput(&out, job, "scanned: 1\nviolations: 0\n")
+	writeJobOutput(&out, job, "")
+	assert.Equal(t, "https://github.com/weaveworks/policies#7: scanned: 1\nhttps://github.com/weaveworks/policies#7: violations: 0\n", out.String())
+}
+
+func TestServeFlags(t *testing.T) {
+	conf := testConfig(t)
+	dir := conf.RepositoryRoot
+	conf.EntitySourceConf.Path = filepath.Join("entities", "kubernetes")
+
+	// the root command flags are parsed by the serve command and apply to the jobs
+	var result *types.Result
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		&cli.StringSliceFlag{Name: "policy-param"},
+	}
+	app.Commands = []*cli.Command{
+		{
+			Name: serveCommandName,
+			Action: func(c *cli.Context) error {
+				if err := conf.parseFlags(c); err != nil {
+					return err
+				}
+				var err error
+				result, err = run(c.Context, conf.JobConfig(server.Job{Provider: "github", PullRequest: 1}, dir))
+				return err
+			},
+		},
+	}
+	err := app.Run([]string{"weave-validator", "--policy-param", "magalix.policies.containers-minimum-replica-count.replica_count=1", serveCommandName})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 4, result.ViolationCount, "replica count violations should be fixed by the parameter override")
+	for _, violation := range result.Violations {
+		assert.NotEqual(t, "magalix.policies.containers-minimum-replica-count", violation.Policy.ID)
+	}
+
+	err = app.Run([]string{"weave-validator", "--policy-param", "invalid", serveCommandName})
+	assert.Error(t, err)
+}
+
+// testConfig returns the config validating the kubernetes entities against the kubernetes policies, the
+// repository root is the tests data directory
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	root, err := filepath.Abs("tests/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Config{
+		EntitySourceConf:   SourceConf{Path: filepath.Join(root, "entities", "kubernetes")},
+		PoliciesSourceConf: SourceConf{Path: filepath.Join(root, "policies", "kubernetes")},
+		RepositoryRoot:     root,
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	conf := testConfig(t)
+	conf.SARIFOutputFile = filepath.Join(dir, "result.sarif")
+	conf.JSONOutputFile = filepath.Join(dir, "result.json")
+	result, err := run(context.Background(), conf)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.Violations)
+	for _, violation := range result.Violations {
+		assert.True(t, strings.HasPrefix(violation.Location.Path, "entities/kubernetes/"), violation.Location.Path)
+	}
+
+	in, err := os.ReadFile(conf.SARIFOutputFile)
+	assert.NoError(t, err)
+	var report sarif.Report
+	assert.NoError(t, json.Unmarshal(in, &report))
+	assert.Equal(t, "file://"+filepath.ToSlash(conf.RepositoryRoot)+"/", report.Runs[0].OriginalURIBaseIDs[sarif.SourceRootID].URI)
+	for _, ruleResult := range report.Runs[0].Results {
+		location := ruleResult.Locations[0].PhysicalLocation.ArtifactLocation
+		assert.Equal(t, sarif.SourceRootID, location.URIBaseID)
+		assert.True(t, strings.HasPrefix(location.URI, "entities/kubernetes/"), location.URI)
+	}
+}
+
+func TestCodeOwners(t *testing.T) {
+	conf := testConfig(t)
+	conf.CodeOwners = true
+	result, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) || !assert.NotEmpty(t, result.Violations) {
+		return
+	}
+	for _, violation := range result.Violations {
+		assert.Equal(t, []string{"@apps", "@platform"}, violation.Owners)
+	}
+	assert.Contains(t, result.MarkdowSummary(), "|Owners |")
+
+	count := result.ViolationCount
+	tests := []struct {
+		name       string
+		thresholds []string
+		exceeds    bool
+	}{
+		{name: "within thresholds", thresholds: []string{fmt.Sprintf("@apps=%d", count), fmt.Sprintf("@platform=%d", count+1)}, exceeds: false},
+		{name: "owner exceeds threshold", thresholds: []string{fmt.Sprintf("@apps=%d", count), fmt.Sprintf("@platform=%d", count-1)}, exceeds: true},
+		{name: "owner without threshold", thresholds: []string{fmt.Sprintf("@apps=%d", count)}, exceeds: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			thresholds, err := parseOwnerThresholds(test.thresholds)
+			assert.NoError(t, err)
+			assert.Equal(t, test.exceeds, result.ExceedsOwnerThresholds(thresholds))
+		})
+	}
+
+	t.Run("violations without owners", func(t *testing.T) {
+		unowned := *result
+		unowned.Violations = []types.Violation{{ID: "unowned"}}
+		assert.True(t, unowned.ExceedsOwnerThresholds(map[string]int{"@apps": 10}))
+	})
+
+	t.Run("invalid thresholds", func(t *testing.T) {
+		for _, value := range []string{"@apps", "=1", "@apps=-1", "@apps=many"} {
+			_, err := parseOwnerThresholds([]string{value})
+			assert.Error(t, err, value)
+		}
+	})
+}
+
+func TestExceptions(t *testing.T) {
+	exceptionsFile := filepath.Join(t.TempDir(), "exceptions.yaml")
+	assert.NoError(t, os.WriteFile(exceptionsFile, []byte(`exceptions:
+  - name: frontend-privileged
+    policies: [magalix.policies.containers-running-in-privileged-mode]
+    names: ["front*"]
+    paths: ["entities/**"]
+    justification: frontend needs the host network
+    owner: "@apps"
+  - name: backend-replicas
+    policies: [magalix.policies.containers-minimum-replica-count]
+    names: [backend]
+    justification: single replica until the migration
+    owner: "@apps"
+    expires: 2020-01-01
+`), 0644))
+
+	conf := testConfig(t)
+	conf.ExceptionsFile = exceptionsFile
+	result, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 1, result.SuppressedCount)
+	if assert.Len(t, result.Suppressed, 1) {
+		assert.Equal(t, "frontend", result.Suppressed[0].Entity.Name)
+		assert.Equal(t, "frontend-privileged", result.Suppressed[0].Suppression.Exception)
+	}
+
+	var expired []types.Violation
+	for _, violation := range result.Violations {
+		if violation.Policy.ID == exception.ExpiredPolicyID {
+			expired = append(expired, violation)
+		}
+	}
+	assert.Equal(t, 6, result.ViolationCount, "expired exception finding should replace the excepted violation")
+	if assert.Len(t, expired, 1) {
+		assert.Equal(t, "backend-replicas", expired[0].Entity.Name)
+		assert.Equal(t, 8, expired[0].Location.StartLine)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	baselineFile := filepath.Join(t.TempDir(), "baseline.json")
+	conf := testConfig(t)
+	conf.BaselineCreate = baselineFile
+	result, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 0, result.ViolationCount)
+	assert.Equal(t, 6, result.BaselinedCount)
+
+	// drop an accepted violation and add a fixed one, entries of the files and policies not validated
+	// are not fixed
+	accepted, err := baseline.Load(baselineFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	dropped := accepted.Violations[0]
+	fixed := types.BaselineEntry{Fingerprint: "fixed", Policy: dropped.Policy, Kind: "Deployment", Name: "removed", Path: dropped.Path}
+	unscannedPath := types.BaselineEntry{Fingerprint: "unscanned-path", Policy: dropped.Policy, Kind: "Deployment", Name: "removed", Path: "other/deployment.yaml"}
+	unscannedPolicy := types.BaselineEntry{Fingerprint: "unscanned-policy", Policy: "weave.policies.removed", Kind: "Deployment", Name: "removed", Path: dropped.Path}
+	accepted.Violations = append(accepted.Violations[1:], fixed, unscannedPath, unscannedPolicy)
+	assert.NoError(t, accepted.Save(baselineFile))
+
+	conf.BaselineCreate, conf.Baseline = "", baselineFile
+	result, err = run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, result.ViolationCount)
+	if assert.Len(t, result.Violations, 1) {
+		assert.Equal(t, dropped.Fingerprint, result.Violations[0].Fingerprint)
+	}
+	assert.Equal(t, 5, result.BaselinedCount)
+	assert.Equal(t, []types.BaselineEntry{fixed}, result.FixedBaseline)
+}
+
+func TestFingerprints(t *testing.T) {
+	conf := testConfig(t)
+	conf.SARIFOutputFile = filepath.Join(t.TempDir(), "result.sarif")
+	first, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	second, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the violations of a resource are not reported in a stable order
+	fingerprints := make(map[string]bool)
+	for _, violation := range first.Violations {
+		assert.Len(t, violation.Fingerprint, 64)
+		assert.NotEqual(t, violation.Fingerprint, violation.ID, "ids should be kept")
+		fingerprints[violation.Fingerprint] = true
+	}
+	assert.Len(t, fingerprints, first.ViolationCount, "fingerprints should be unique")
+	for _, violation := range second.Violations {
+		assert.True(t, fingerprints[violation.Fingerprint], "fingerprints should be stable across runs")
+	}
+
+	in, err := os.ReadFile(conf.SARIFOutputFile)
+	assert.NoError(t, err)
+	var report sarif.Report
+	assert.NoError(t, json.Unmarshal(in, &report))
+	for _, ruleResult := range report.Runs[0].Results {
+		assert.True(t, fingerprints[ruleResult.PartialFingerprints[sarif.FingerprintKey]])
+	}
+
+	t.Run("deduplicate", func(t *testing.T) {
+		duplicated := *first
+		duplicated.Violations = append(append([]types.Violation{}, first.Violations...), first.Violations[0])
+		duplicated.ViolationCount++
+		duplicated.Deduplicate()
+		assert.Equal(t, first.Violations, duplicated.Violations)
+		assert.Equal(t, first.ViolationCount, duplicated.ViolationCount)
+
+		// violations with the same fingerprint on other lines are not duplicates
+		moved := first.Violations[0]
+		moved.Location.StartLine, moved.Location.EndLine = moved.Location.StartLine+10, moved.Location.EndLine+10
+		duplicated.Violations = append(duplicated.Violations, moved)
+		duplicated.ViolationCount++
+		duplicated.Deduplicate()
+		assert.Equal(t, first.ViolationCount+1, duplicated.ViolationCount)
+
+		// pre-existing violations are marked before the duplicates are removed
+		preExisting := *first
+		preExisting.Violations = append(append([]types.Violation{}, first.Violations...), first.Violations[0])
+		preExisting.MarkPreExisting(func(path string, start, end int) bool { return false })
+		assert.Equal(t, first.ViolationCount+1, preExisting.PreExistingCount)
+		preExisting.Deduplicate()
+		assert.Equal(t, first.ViolationCount, preExisting.PreExistingCount)
+	})
+
+	t.Run("indentation does not change fingerprints", func(t *testing.T) {
+		assert.Equal(t,
+			types.NormalizeContent([]string{"  securityContext:", "    privileged: true"}),
+			types.NormalizeContent([]string{"securityContext:", "", "  privileged:   true"}),
+		)
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	violation := func(severity, category string, owners ...string) types.Violation {
+		return types.Violation{
+			Policy: types.Policy{Severity: severity, Category: category},
+			Owners: owners,
+		}
+	}
+	result := &types.Result{
+		Violations: []types.Violation{
+			violation("low", "weave.categories.pod-security", "@platform"),
+			violation("medium", "weave.categories.reliability", "@platform"),
+		},
+		ViolationCount: 2,
+	}
+
+	tests := []struct {
+		name   string
+		conf   Config
+		result *types.Result
+		code   int
+	}{
+		{name: "no violations", result: &types.Result{}, code: 0},
+		{name: "all violations fail", result: result, code: exitViolations},
+		{name: "no exit error", conf: Config{NoExitError: true}, result: result, code: 0},
+		{name: "violation reaches severity", conf: Config{SeverityThresholds: types.SeverityThresholds{FailOn: "medium"}}, result: result, code: exitViolations},
+		{name: "violations below severity", conf: Config{SeverityThresholds: types.SeverityThresholds{FailOn: "high"}}, result: result, code: 0},
+		{
+			name: "category threshold overrides severity",
+			conf: Config{SeverityThresholds: types.SeverityThresholds{
+				FailOn:     "high",
+				Categories: map[string]string{"weave.categories.pod-security": "low"},
+			}},
+			result: result,
+			code:   exitViolations,
+		},
+		{
+			name: "category threshold above severity",
+			conf: Config{SeverityThresholds: types.SeverityThresholds{
+				FailOn:     "low",
+				Categories: map[string]string{"weave.categories.pod-security": "high", "weave.categories.reliability": "critical"},
+			}},
+			result: result,
+			code:   0,
+		},
+		{
+			name: "warn-only violations do not fail",
+			result: &types.Result{
+				Violations:     []types.Violation{{Policy: types.Policy{Severity: "high", Mode: types.ModeWarnOnly}}},
+				ViolationCount: 1,
+			},
+			code: 0,
+		},
+		{
+			name: "unknown severity fails",
+			conf: Config{SeverityThresholds: types.SeverityThresholds{FailOn: "critical"}},
+			result: &types.Result{
+				Violations:     []types.Violation{violation("", "weave.categories.reliability")},
+				ViolationCount: 1,
+			},
+			code: exitViolations,
+		},
+		{
+			name: "owner thresholds count failing violations",
+			conf: Config{
+				SeverityThresholds: types.SeverityThresholds{FailOn: "medium"},
+				OwnerMaxViolations: map[string]int{"@platform": 1},
+			},
+			result: result,
+			code:   0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.code, exitCode(test.conf, test.result))
+		})
+	}
+}
+
+func TestErrorExitCode(t *testing.T) {
+	policiesPath, err := filepath.Abs("tests/data/policies/kubernetes")
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources:\n- missing.yaml\n"), 0644))
+	_, err = run(context.Background(), Config{
+		EntitySourceConf:   SourceConf{Path: dir},
+		PoliciesSourceConf: SourceConf{Path: policiesPath},
+		RepositoryRoot:     dir,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, exitRenderError, errorExitCode(err))
+
+	conf := testConfig(t)
+	conf.PoliciesSourceConf.Path = filepath.Join(dir, "missing")
+	_, err = run(context.Background(), conf)
+	assert.Error(t, err)
+	assert.Equal(t, exitError, errorExitCode(err))
+
+	_, err = parseCategoryThresholds([]string{"weave.categories.reliability=severe"})
+	assert.Error(t, err)
+}
+
+func TestPolicySelection(t *testing.T) {
+	conf := testConfig(t)
+	conf.ConfigFile = filepath.Join(conf.RepositoryRoot, "config.yaml")
+	conf.PolicySelection.Exclude.IDs = []string{"*privilege-escalation"}
+	conf.SARIFOutputFile = filepath.Join(t.TempDir(), "result.sarif")
+	result, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"magalix.policies.containers-running-in-privileged-mode"}, result.Metadata.Policies)
+	assert.Equal(t, []string{"magalix.categories.pod-security"}, result.Metadata.PolicySelection.Include.Categories)
+	assert.Equal(t, []string{"*privilege-escalation"}, result.Metadata.PolicySelection.Exclude.IDs)
+	assert.NotZero(t, result.ViolationCount)
+	for _, violation := range result.Violations {
+		assert.Equal(t, "magalix.policies.containers-running-in-privileged-mode", violation.Policy.ID)
+	}
+
+	in, err := os.ReadFile(conf.SARIFOutputFile)
+	assert.NoError(t, err)
+	var report sarif.Report
+	assert.NoError(t, json.Unmarshal(in, &report))
+	assert.Contains(t, report.Runs[0].Properties, "policySelection")
+
+	conf.PolicySelection.Include.Severities = []string{"severe"}
+	_, err = run(context.Background(), conf)
+	assert.Error(t, err)
+}
+
+func TestPolicyConfigs(t *testing.T) {
+	conf := testConfig(t)
+	conf.PolicyConfigPath = filepath.Join(conf.RepositoryRoot, "policy-configs")
+	result, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 5, result.ViolationCount, "frontend config should allow a single replica")
+	var replicaViolations []types.Violation
+	for _, violation := range result.Violations {
+		if violation.Policy.ID == "magalix.policies.containers-minimum-replica-count" {
+			replicaViolations = append(replicaViolations, violation)
+		} else {
+			assert.Empty(t, violation.Overrides)
+		}
+	}
+	if assert.Len(t, replicaViolations, 1) {
+		assert.Equal(t, "backend", replicaViolations[0].Entity.Name)
+		assert.Equal(t, []types.ParameterOverride{{Name: "replica_count", Value: 3, Config: "backend-replicas"}}, replicaViolations[0].Overrides)
+		assert.Contains(t, result.TEXT(), "replica_count=3 (backend-replicas)")
+	}
+
+	// the policy configs matching a resource take precedence over the flag overrides
+	replicas, err := policy.ParseParameter("magalix.policies.containers-minimum-replica-count.replica_count=5", policyParamSource)
+	assert.NoError(t, err)
+	conf.PolicyParameters = []policy.Parameter{replicas}
+	result, err = run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	overrides := make(map[string][]types.ParameterOverride)
+	for _, violation := range result.Violations {
+		if violation.Policy.ID == "magalix.policies.containers-minimum-replica-count" {
+			overrides[violation.Entity.Name] = violation.Overrides
+		}
+	}
+	assert.NotContains(t, overrides, "frontend")
+	assert.Equal(t, []types.ParameterOverride{{Name: "replica_count", Value: 3, Config: "backend-replicas"}}, overrides["backend"])
+}
+
+func TestPolicyParameters(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "weave.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`parameters:
+  magalix.policies.containers-minimum-replica-count:
+    replica_count: 3
+  magalix.policies.containers-running-in-privileged-mode:
+    privilege: true
+`), 0644))
+
+	replicas, err := policy.ParseParameter("magalix.policies.containers-minimum-replica-count.replica_count=1", policyParamSource)
+	assert.NoError(t, err)
+	conf := testConfig(t)
+	conf.ConfigFile = configFile
+	conf.PolicyParameters = []policy.Parameter{replicas}
+	result, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, result.ViolationCount, "only the privilege escalation violations should be left")
+	for _, violation := range result.Violations {
+		assert.Equal(t, "magalix.policies.containers-running-with-privilege-escalation", violation.Policy.ID)
+	}
+
+	invalid, err := policy.ParseParameter("magalix.policies.containers-minimum-replica-count.replica_count=two", policyParamSource)
+	assert.NoError(t, err)
+	conf.PolicyParameters = []policy.Parameter{invalid}
+	_, err = run(context.Background(), conf)
+	assert.ErrorContains(t, err, "expected integer")
+}
+
+func TestWarnOnlyPolicies(t *testing.T) {
+	conf := testConfig(t)
+	conf.WarnOnlyPolicies = []string{"*privilege*"}
+	conf.SARIFOutputFile = filepath.Join(t.TempDir(), "result.sarif")
+	result, err := run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 6, result.ViolationCount, "warn-only violations should be reported")
+	for _, violation := range result.Violations {
+		if violation.Policy.ID == "magalix.policies.containers-minimum-replica-count" {
+			assert.Equal(t, types.ModeEnforce, violation.Policy.Mode)
+		} else {
+			assert.Equal(t, types.ModeWarnOnly, violation.Policy.Mode)
+		}
+	}
+	assert.Equal(t, exitViolations, exitCode(conf, result), "enforced violations should fail")
+	assert.Contains(t, result.TEXT(), "warn-only: 4")
+	assert.Contains(t, result.MarkdowSummary(), "|Mode |")
+
+	in, err := os.ReadFile(conf.SARIFOutputFile)
+	assert.NoError(t, err)
+	var report sarif.Report
+	assert.NoError(t, json.Unmarshal(in, &report))
+	for _, ruleResult := range report.Runs[0].Results {
+		assert.Equal(t, types.ModeWarnOnly, ruleResult.Properties["mode"])
+		assert.Equal(t, "warning", ruleResult.Level)
+	}
+
+	conf.WarnOnlyPolicies = []string{"magalix.policies.*"}
+	result, err = run(context.Background(), conf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 6, result.ViolationCount)
+	assert.Equal(t, 0, exitCode(conf, result), "warn-only violations should not fail")
+}
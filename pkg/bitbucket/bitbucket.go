@@ -8,226 +8,300 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path/filepath"
-)
-
-type ReportType string
-type ReportResult string
-type ReportDataType string
-type AnnotationType string
-type AnnotationSeverity string
-
-const (
-	ReportTypeSeurity       ReportType     = "SECURITY"
-	ReportResultPassed      ReportResult   = "PASSED"
-	ReportResultFailed      ReportResult   = "FAILED"
-	ReportDataTypeNumber    ReportDataType = "NUMBER"
-	ReportDataTypeText      ReportDataType = "TEXT"
-	ReportDataTypeLink      ReportDataType = "LINK"
-	AnnotationTypeCodeSmell AnnotationType = "CODE_SMELL"
+	"strings"
 )
 
 const (
-	apiURL = "https://api.bitbucket.org/2.0"
+	DefaultBaseURL = "https://api.bitbucket.org/2.0"
+	pageLength     = 100
 )
 
-type BranchTarget struct {
-	Hash string `json:"hash"`
-}
-type CreateBranchOptions struct {
-	Name   string       `json:"name"`
-	Target BranchTarget `json:"target"`
-}
-
-type CommitFile struct {
-	Path    string
-	Content []byte
-}
-
-type CreateCommitOptions struct {
-	Branch      string
-	Message     string `json:"message"`
-	CommitFiles []CommitFile
-}
-
-type Branch struct {
-	Name string `json:"name"`
-}
-
-type PullRequestRef struct {
-	Branch Branch `json:"branch"`
-}
-
-type CreatePullRequestOptions struct {
-	Title       string         `json:"title"`
-	Source      PullRequestRef `json:"source"`
-	Destination PullRequestRef `json:"destination"`
-}
-
-type ReportDataItem struct {
-	Title string         `json:"title"`
-	Type  ReportDataType `json:"type"`
-	Value interface{}    `json:"value"`
+type Client struct {
+	owner      string
+	repository string
+	token      string
+	baseURL    string
+	httpClient *http.Client
 }
 
-type CreateReportOptions struct {
-	ID       string           `json:"-"`
-	SHA      string           `json:"-"`
-	Title    string           `json:"title"`
-	Details  string           `json:"details"`
-	Type     ReportType       `json:"report_type"`
-	Reporter string           `json:"reporter"`
-	Link     string           `json:"link"`
-	LogoURL  string           `json:"logo_url"`
-	Result   ReportResult     `json:"result"`
-	Data     []ReportDataItem `json:"data"`
-}
+// Option configures the client
+type Option func(*Client)
 
-type ReportAnnotation struct {
-	ExternalID string             `json:"external_id"`
-	Title      string             `json:"title"`
-	Summary    string             `json:"summary"`
-	Type       AnnotationType     `json:"annotation_type"`
-	Severity   AnnotationSeverity `json:"severity"`
-	Path       string             `json:"path"`
-	Line       int                `json:"line"`
+// WithHTTPClient sets the http client used to send requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(cl *Client) {
+		cl.httpClient = httpClient
+	}
 }
 
-type Client struct {
-	owner      string
-	repository string
-	token      string
+// WithBaseURL sets the api base url
+func WithBaseURL(baseURL string) Option {
+	return func(cl *Client) {
+		cl.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
 }
 
 // NewClient returns new client
-func NewClient(owner, repository, token string) *Client {
-	return &Client{
+func NewClient(owner, repository, token string, opts ...Option) *Client {
+	cl := &Client{
 		owner:      owner,
 		repository: repository,
 		token:      token,
+		baseURL:    DefaultBaseURL,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(cl)
 	}
+	return cl
 }
 
 // GetBranch gets branch by its name
-func (cl *Client) GetBranch(ctx context.Context, name string) (*http.Response, error) {
-	url := fmt.Sprintf("%s/repositories/%s/%s/refs/branches/%s", apiURL, cl.owner, cl.repository, name)
-	req, err := http.NewRequest("GET", url, nil)
+func (cl *Client) GetBranch(ctx context.Context, name string) (*Branch, error) {
+	var branch Branch
+	err := cl.do(ctx, http.MethodGet, cl.repoURL("refs/branches/%s", url.PathEscape(name)), nil, &branch)
 	if err != nil {
 		return nil, err
 	}
-
-	req.SetBasicAuth(cl.owner, cl.token)
-
-	client := &http.Client{}
-	return client.Do(req)
+	return &branch, nil
 }
 
 // CreateBranch creates new branch
-func (cl *Client) CreateBranch(ctx context.Context, opts CreateBranchOptions) (*http.Response, error) {
-	url := fmt.Sprintf("%s/repositories/%s/%s/refs/branches", apiURL, cl.owner, cl.repository)
-	body, err := json.Marshal(opts)
+func (cl *Client) CreateBranch(ctx context.Context, opts CreateBranchOptions) (*Branch, error) {
+	var branch Branch
+	err := cl.do(ctx, http.MethodPost, cl.repoURL("refs/branches"), opts, &branch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body, error: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create branch, error: %v", err)
+		return nil, err
 	}
-
-	req.Header.Add("Content-Type", "application/json")
-	req.SetBasicAuth(cl.owner, cl.token)
-
-	client := &http.Client{}
-	return client.Do(req)
+	return &branch, nil
 }
 
 // CreateCommit creates new commit
-func (cl *Client) CreateCommit(ctx context.Context, opts CreateCommitOptions) (*http.Response, error) {
-	url := fmt.Sprintf("%s/repositories/%s/%s/src", apiURL, cl.owner, cl.repository)
-
+func (cl *Client) CreateCommit(ctx context.Context, opts CreateCommitOptions) error {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
-	writer.WriteField("message", opts.Message)
-	writer.WriteField("branch", opts.Branch)
+	if err := writer.WriteField("message", opts.Message); err != nil {
+		return err
+	}
+	if err := writer.WriteField("branch", opts.Branch); err != nil {
+		return err
+	}
 
 	for _, file := range opts.CommitFiles {
-		part, _ := writer.CreateFormFile(file.Path, filepath.Base(file.Path))
-		io.Copy(part, bytes.NewReader(file.Content))
+		part, err := writer.CreateFormFile(file.Path, filepath.Base(file.Path))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, bytes.NewReader(file.Content)); err != nil {
+			return err
+		}
 	}
 
-	writer.Close()
+	if err := writer.Close(); err != nil {
+		return err
+	}
 
-	req, err := http.NewRequest("POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cl.repoURL("src"), body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create commit, error: %v", err)
+		return fmt.Errorf("failed to create commit, error: %v", err)
 	}
-
 	req.Header.Add("Content-Type", writer.FormDataContentType())
-	req.SetBasicAuth(cl.owner, cl.token)
 
-	client := &http.Client{}
-	return client.Do(req)
+	return cl.send(req, nil)
+}
+
+// ListPullRequests lists pull requests matching the given options
+func (cl *Client) ListPullRequests(ctx context.Context, opts ListPullRequestsOptions) ([]PullRequest, error) {
+	var filters []string
+	if opts.SourceBranch != "" {
+		filters = append(filters, fmt.Sprintf("source.branch.name=%q", opts.SourceBranch))
+	}
+	if opts.DestinationBranch != "" {
+		filters = append(filters, fmt.Sprintf("destination.branch.name=%q", opts.DestinationBranch))
+	}
+	if opts.State != "" {
+		filters = append(filters, fmt.Sprintf("state=%q", opts.State))
+	}
+
+	query := url.Values{}
+	query.Set("pagelen", fmt.Sprint(pageLength))
+	if len(filters) > 0 {
+		query.Set("q", strings.Join(filters, " AND "))
+	}
+
+	var pulls []PullRequest
+	err := cl.list(ctx, cl.repoURL("pullrequests")+"?"+query.Encode(), func(values json.RawMessage) error {
+		var page []PullRequest
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		pulls = append(pulls, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pulls, nil
 }
 
 // CreatePullRequest creates new pull request
-func (cl *Client) CreatePullRequest(ctx context.Context, opts CreatePullRequestOptions) (*http.Response, error) {
-	url := fmt.Sprintf("%s/repositories/%s/%s/pullrequests", apiURL, cl.owner, cl.repository)
-	body, err := json.Marshal(opts)
+func (cl *Client) CreatePullRequest(ctx context.Context, opts CreatePullRequestOptions) (*PullRequest, error) {
+	var pull PullRequest
+	err := cl.do(ctx, http.MethodPost, cl.repoURL("pullrequests"), opts, &pull)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body, error: %v", err)
+		return nil, err
 	}
+	return &pull, nil
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+// CreateReport creates new report
+func (cl *Client) CreateReport(ctx context.Context, opts CreateReportOptions) (*Report, error) {
+	var report Report
+	err := cl.do(ctx, http.MethodPut, cl.repoURL("commit/%s/reports/%s", opts.SHA, opts.ID), opts, &report)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create branch, error: %v", err)
+		return nil, err
 	}
+	return &report, nil
+}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.SetBasicAuth(cl.owner, cl.token)
+// AddAnnotationToReport adds annotations to report
+func (cl *Client) AddAnnotationToReport(ctx context.Context, sha string, id string, annotations []ReportAnnotation) ([]ReportAnnotation, error) {
+	var created []ReportAnnotation
+	err := cl.do(ctx, http.MethodPost, cl.repoURL("commit/%s/reports/%s/annotations", sha, id), annotations, &created)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
 
-	client := &http.Client{}
-	return client.Do(req)
+// GetCurrentUser gets the user authenticated by the token
+func (cl *Client) GetCurrentUser(ctx context.Context) (*User, error) {
+	var user User
+	if err := cl.do(ctx, http.MethodGet, cl.baseURL+"/user", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-// CreateReport creates new report
-func (cl *Client) CreateReport(ctx context.Context, opts CreateReportOptions) (*http.Response, error) {
-	url := fmt.Sprintf("%s/repositories/%s/%s/commit/%s/reports/%s", apiURL, cl.owner, cl.repository, opts.SHA, opts.ID)
-	body, err := json.Marshal(opts)
+// ListPullRequestComments lists all comments of a pull request
+func (cl *Client) ListPullRequestComments(ctx context.Context, id int) ([]PullRequestComment, error) {
+	var comments []PullRequestComment
+	u := fmt.Sprintf("%s?pagelen=%d", cl.repoURL("pullrequests/%d/comments", id), pageLength)
+	err := cl.list(ctx, u, func(values json.RawMessage) error {
+		var page []PullRequestComment
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		comments = append(comments, page...)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body, error: %v", err)
+		return nil, err
 	}
+	return comments, nil
+}
 
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(body))
+// CreatePullRequestComment creates new pull request comment
+func (cl *Client) CreatePullRequestComment(ctx context.Context, id int, content string) (*PullRequestComment, error) {
+	var comment PullRequestComment
+	body := PullRequestComment{Content: PullRequestCommentContent{Raw: content}}
+	err := cl.do(ctx, http.MethodPost, cl.repoURL("pullrequests/%d/comments", id), body, &comment)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create report, error: %v", err)
+		return nil, err
 	}
+	return &comment, nil
+}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.SetBasicAuth(cl.owner, cl.token)
+// UpdatePullRequestComment updates pull request comment content
+func (cl *Client) UpdatePullRequestComment(ctx context.Context, id int, commentID int, content string) (*PullRequestComment, error) {
+	var comment PullRequestComment
+	body := PullRequestComment{Content: PullRequestCommentContent{Raw: content}}
+	err := cl.do(ctx, http.MethodPut, cl.repoURL("pullrequests/%d/comments/%d", id, commentID), body, &comment)
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
 
-	client := &http.Client{}
-	return client.Do(req)
+func (cl *Client) repoURL(path string, args ...interface{}) string {
+	return fmt.Sprintf("%s/repositories/%s/%s/%s", cl.baseURL, cl.owner, cl.repository, fmt.Sprintf(path, args...))
 }
 
-// AddAnnotationToReport adds annotations to report
-func (cl *Client) AddAnnotationToReport(ctx context.Context, sha string, id string, annotations []ReportAnnotation) (*http.Response, error) {
-	url := fmt.Sprintf("%s/repositories/%s/%s/commit/%s/reports/%s/annotations", apiURL, cl.owner, cl.repository, sha, id)
+// do sends json request and decodes the json response into out if not nil
+func (cl *Client) do(ctx context.Context, method, url string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body, error: %v", err)
+		}
+		body = bytes.NewReader(raw)
+	}
 
-	body, err := json.Marshal(annotations)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body, error: %v", err)
+		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to add report annotations, error: %v", err)
+	if in != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	req.Header.Add("Accept", "application/json")
+
+	return cl.send(req, out)
+}
+
+// list fetches all pages starting from the given url
+func (cl *Client) list(ctx context.Context, url string, fn func(json.RawMessage) error) error {
+	for url != "" {
+		var p page
+		if err := cl.do(ctx, http.MethodGet, url, nil, &p); err != nil {
+			return err
+		}
+		if err := fn(p.Values); err != nil {
+			return fmt.Errorf("failed to decode response, error: %v", err)
+		}
+		url = p.Next
 	}
+	return nil
+}
 
-	req.Header.Add("Content-Type", "application/json")
+func (cl *Client) send(req *http.Request, out interface{}) error {
 	req.SetBasicAuth(cl.owner, cl.token)
 
-	client := &http.Client{}
-	return client.Do(req)
+	resp, err := cl.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newError(resp)
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to decode response, error: %v", err)
+	}
+	return nil
+}
+
+func newError(resp *http.Response) *Error {
+	apiErr := &Error{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+	var body errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		apiErr.Message = body.Error.Message
+		apiErr.Detail = body.Error.Detail
+	}
+	return apiErr
 }
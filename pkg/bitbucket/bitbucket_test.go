@@ -0,0 +1,220 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, mux *http.ServeMux) *Client {
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return NewClient("owner", "repo", "token", WithBaseURL(server.URL+"/"), WithHTTPClient(server.Client()))
+}
+
+func TestGetBranch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repositories/owner/repo/refs/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "owner", user)
+		assert.Equal(t, "token", pass)
+		fmt.Fprint(w, `{"name": "main", "target": {"hash": "abc"}}`)
+	})
+	mux.HandleFunc("/repositories/owner/repo/refs/branches/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"type": "error", "error": {"message": "Branch not found"}}`)
+	})
+	cl := newTestClient(t, mux)
+
+	branch, err := cl.GetBranch(context.Background(), "main")
+	assert.NoError(t, err)
+	assert.Equal(t, "main", branch.Name)
+	assert.Equal(t, "abc", branch.Target.Hash)
+
+	_, err = cl.GetBranch(context.Background(), "missing")
+	assert.True(t, IsNotFound(err))
+	assert.EqualError(t, err, "bitbucket api error: 404 Not Found, Branch not found")
+}
+
+func TestCreateCommit(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repositories/owner/repo/src", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "fix", r.FormValue("message"))
+		assert.Equal(t, "branch", r.FormValue("branch"))
+
+		file, _, err := r.FormFile("dir/deployment.yaml")
+		if assert.NoError(t, err) {
+			content, _ := io.ReadAll(file)
+			assert.Equal(t, "kind: Deployment", string(content))
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	cl := newTestClient(t, mux)
+
+	err := cl.CreateCommit(context.Background(), CreateCommitOptions{
+		Branch:  "branch",
+		Message: "fix",
+		CommitFiles: []CommitFile{
+			{Path: "dir/deployment.yaml", Content: []byte("kind: Deployment")},
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func TestCreatePullRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repositories/owner/repo/pullrequests", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var opts CreatePullRequestOptions
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		assert.Equal(t, "title", opts.Title)
+		assert.Equal(t, "feature", opts.Source.Branch.Name)
+		assert.Equal(t, "main", opts.Destination.Branch.Name)
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": 7, "title": "title", "state": "OPEN", "links": {"html": {"href": "https://bitbucket.org/owner/repo/pull-requests/7"}}}`)
+	})
+	cl := newTestClient(t, mux)
+
+	pr, err := cl.CreatePullRequest(context.Background(), CreatePullRequestOptions{
+		Title:       "title",
+		Source:      PullRequestRef{Branch: Branch{Name: "feature"}},
+		Destination: PullRequestRef{Branch: Branch{Name: "main"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, pr.ID)
+	assert.Equal(t, PullRequestStateOpen, pr.State)
+	assert.Equal(t, "https://bitbucket.org/owner/repo/pull-requests/7", pr.Links.HTML.Href)
+}
+
+func TestListPullRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repositories/owner/repo/pullrequests", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, `source.branch.name="feature" AND state="OPEN"`, r.URL.Query().Get("q"))
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"values": [{"id": 2}]}`)
+			return
+		}
+		query := r.URL.Query()
+		query.Set("page", "2")
+		fmt.Fprintf(w, `{"values": [{"id": 1}], "next": "http://%s%s?%s"}`, r.Host, r.URL.Path, query.Encode())
+	})
+	cl := newTestClient(t, mux)
+
+	pulls, err := cl.ListPullRequests(context.Background(), ListPullRequestsOptions{
+		SourceBranch: "feature",
+		State:        PullRequestStateOpen,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, pulls, 2)
+	assert.Equal(t, 1, pulls[0].ID)
+	assert.Equal(t, 2, pulls[1].ID)
+}
+
+func TestCreateReport(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repositories/owner/repo/commit/abc/reports/weave-abc", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "FAILED", body["result"])
+		assert.NotContains(t, body, "ID")
+		fmt.Fprint(w, `{"uuid": "{1}", "external_id": "weave-abc", "result": "FAILED"}`)
+	})
+	mux.HandleFunc("/repositories/owner/repo/commit/abc/reports/weave-abc/annotations", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var annotations []ReportAnnotation
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&annotations))
+		assert.Len(t, annotations, 1)
+		annotations[0].UUID = "{2}"
+		json.NewEncoder(w).Encode(annotations)
+	})
+	cl := newTestClient(t, mux)
+
+	report, err := cl.CreateReport(context.Background(), CreateReportOptions{
+		ID:     "weave-abc",
+		SHA:    "abc",
+		Result: ReportResultFailed,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "weave-abc", report.ExternalID)
+
+	annotations, err := cl.AddAnnotationToReport(context.Background(), "abc", "weave-abc", []ReportAnnotation{
+		{ExternalID: "weave-abc-0", Path: "deployment.yaml", Line: 3},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "{2}", annotations[0].UUID)
+}
+
+func TestPullRequestComments(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repositories/owner/repo/pullrequests/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"values": [{"id": 1, "content": {"raw": "first"}, "user": {"uuid": "{bot}"}}]}`)
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id": 2, "content": {"raw": "second"}}`)
+		}
+	})
+	mux.HandleFunc("/repositories/owner/repo/pullrequests/7/comments/1", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		var comment PullRequestComment
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		comment.ID = 1
+		json.NewEncoder(w).Encode(comment)
+	})
+	cl := newTestClient(t, mux)
+
+	comments, err := cl.ListPullRequestComments(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Len(t, comments, 1)
+	assert.Equal(t, "first", comments[0].Content.Raw)
+	assert.Equal(t, "{bot}", comments[0].User.UUID)
+
+	comment, err := cl.CreatePullRequestComment(context.Background(), 7, "second")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, comment.ID)
+
+	comment, err = cl.UpdatePullRequestComment(context.Background(), 7, 1, "updated")
+	assert.NoError(t, err)
+	assert.Equal(t, "updated", comment.Content.Raw)
+}
+
+func TestGetCurrentUser(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"uuid": "{bot}", "display_name": "Weave Bot"}`)
+	})
+	cl := newTestClient(t, mux)
+
+	user, err := cl.GetCurrentUser(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "{bot}", user.UUID)
+}
+
+func TestErrorResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repositories/owner/repo/refs/branches", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type": "error", "error": {"message": "Bad request", "detail": "invalid target"}}`)
+	})
+	cl := newTestClient(t, mux)
+
+	_, err := cl.CreateBranch(context.Background(), CreateBranchOptions{Name: "branch"})
+	var apiErr *Error
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		assert.Equal(t, "invalid target", apiErr.Detail)
+	}
+	assert.False(t, IsNotFound(err))
+}
@@ -0,0 +1,39 @@
+package bitbucket
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is returned when bitbucket responds with an unexpected status
+type Error struct {
+	StatusCode int
+	Status     string
+	Message    string
+	Detail     string
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Detail  string `json:"detail"`
+	} `json:"error"`
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("bitbucket api error: %s", e.Status)
+	}
+	if e.Detail == "" {
+		return fmt.Sprintf("bitbucket api error: %s, %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("bitbucket api error: %s, %s: %s", e.Status, e.Message, e.Detail)
+}
+
+// IsNotFound checks if the error is a not found api error
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,142 @@
+package bitbucket
+
+import "encoding/json"
+
+type ReportType string
+type ReportResult string
+type ReportDataType string
+type AnnotationType string
+type AnnotationSeverity string
+type PullRequestState string
+
+const (
+	ReportTypeSeurity       ReportType         = "SECURITY"
+	ReportResultPassed      ReportResult       = "PASSED"
+	ReportResultFailed      ReportResult       = "FAILED"
+	ReportDataTypeNumber    ReportDataType     = "NUMBER"
+	ReportDataTypeText      ReportDataType     = "TEXT"
+	ReportDataTypeLink      ReportDataType     = "LINK"
+	AnnotationTypeCodeSmell AnnotationType     = "CODE_SMELL"
+	AnnotationSeverityLow   AnnotationSeverity = "LOW"
+)
+
+const (
+	PullRequestStateOpen PullRequestState = "OPEN"
+)
+
+type BranchTarget struct {
+	Hash string `json:"hash"`
+}
+
+type CreateBranchOptions struct {
+	Name   string       `json:"name"`
+	Target BranchTarget `json:"target"`
+}
+
+type CommitFile struct {
+	Path    string
+	Content []byte
+}
+
+type CreateCommitOptions struct {
+	Branch      string
+	Message     string `json:"message"`
+	CommitFiles []CommitFile
+}
+
+type Branch struct {
+	Name   string        `json:"name"`
+	Target *BranchTarget `json:"target,omitempty"`
+}
+
+type PullRequestRef struct {
+	Branch Branch `json:"branch"`
+}
+
+type CreatePullRequestOptions struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Source      PullRequestRef `json:"source"`
+	Destination PullRequestRef `json:"destination"`
+}
+
+type ListPullRequestsOptions struct {
+	SourceBranch      string
+	DestinationBranch string
+	State             PullRequestState
+}
+
+type Link struct {
+	Href string `json:"href"`
+}
+
+type PullRequestLinks struct {
+	HTML Link `json:"html"`
+}
+
+type PullRequest struct {
+	ID          int              `json:"id"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	State       PullRequestState `json:"state"`
+	Source      PullRequestRef   `json:"source"`
+	Destination PullRequestRef   `json:"destination"`
+	Links       PullRequestLinks `json:"links"`
+}
+
+type ReportDataItem struct {
+	Title string         `json:"title"`
+	Type  ReportDataType `json:"type"`
+	Value interface{}    `json:"value"`
+}
+
+type CreateReportOptions struct {
+	ID       string           `json:"-"`
+	SHA      string           `json:"-"`
+	Title    string           `json:"title"`
+	Details  string           `json:"details"`
+	Type     ReportType       `json:"report_type"`
+	Reporter string           `json:"reporter"`
+	Link     string           `json:"link"`
+	LogoURL  string           `json:"logo_url"`
+	Result   ReportResult     `json:"result"`
+	Data     []ReportDataItem `json:"data"`
+}
+
+type Report struct {
+	UUID       string       `json:"uuid"`
+	ExternalID string       `json:"external_id"`
+	Title      string       `json:"title"`
+	Result     ReportResult `json:"result"`
+}
+
+type ReportAnnotation struct {
+	UUID       string             `json:"uuid,omitempty"`
+	ExternalID string             `json:"external_id"`
+	Title      string             `json:"title"`
+	Summary    string             `json:"summary"`
+	Type       AnnotationType     `json:"annotation_type"`
+	Severity   AnnotationSeverity `json:"severity"`
+	Path       string             `json:"path"`
+	Line       int                `json:"line"`
+}
+
+type PullRequestCommentContent struct {
+	Raw string `json:"raw"`
+}
+
+type User struct {
+	UUID        string `json:"uuid"`
+	DisplayName string `json:"display_name"`
+}
+
+type PullRequestComment struct {
+	ID      int                       `json:"id,omitempty"`
+	Content PullRequestCommentContent `json:"content"`
+	User    *User                     `json:"user,omitempty"`
+}
+
+type page struct {
+	Values json.RawMessage `json:"values"`
+	Next   string          `json:"next"`
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/weaveworks/weave-policy-validator/internal/server"
+)
+
+const (
+	serveCommandName = "serve"
+	shutdownTimeout  = 30 * time.Second
+	shortSHALength   = 7
+)
+
+var (
+	jobFileNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	// jobOutputLock keeps the output of the concurrent jobs from interleaving
+	jobOutputLock sync.Mutex
+)
+
+type ServeConfig struct {
+	Listen string
+	Server server.Config
+}
+
+// serveCommand returns the command running the validator as a pull request webhooks server
+func serveCommand(conf *Config) *cli.Command {
+	serveConf := ServeConfig{}
+	return &cli.Command{
+		Name:  serveCommandName,
+		Usage: "validate pull requests on github, gitlab and bitbucket webhook events",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "listen",
+				Usage:       "address to listen on",
+				Value:       ":8080",
+				Destination: &serveConf.Listen,
+				EnvVars:     []string{"WEAVE_SERVER_LISTEN"},
+			},
+			&cli.PathFlag{
+				Name:        "workspace",
+				Usage:       "directory to check out pull requests into, defaults to the temp directory",
+				Destination: &serveConf.Server.Workspace,
+				EnvVars:     []string{"WEAVE_SERVER_WORKSPACE"},
+			},
+			&cli.IntFlag{
+				Name:        "concurrency",
+				Usage:       "max pull requests validated concurrently",
+				Value:       server.DefaultConcurrency,
+				Destination: &serveConf.Server.Concurrency,
+				EnvVars:     []string{"WEAVE_SERVER_CONCURRENCY"},
+			},
+			&cli.IntFlag{
+				Name:        "queue-size",
+				Usage:       "max pull requests waiting to be validated",
+				Value:       server.DefaultQueueSize,
+				Destination: &serveConf.Server.QueueSize,
+				EnvVars:     []string{"WEAVE_SERVER_QUEUE_SIZE"},
+			},
+			&cli.StringFlag{
+				Name:        "github-webhook-secret",
+				Usage:       "github webhooks secret",
+				Destination: &serveConf.Server.GithubWebhookSecret,
+				EnvVars:     []string{"WEAVE_GITHUB_WEBHOOK_SECRET"},
+			},
+			&cli.StringFlag{
+				Name:        "gitlab-webhook-token",
+				Usage:       "gitlab webhooks secret token",
+				Destination: &serveConf.Server.GitlabWebhookToken,
+				EnvVars:     []string{"WEAVE_GITLAB_WEBHOOK_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:        "bitbucket-webhook-secret",
+				Usage:       "bitbucket webhooks secret",
+				Destination: &serveConf.Server.BitbucketWebhookSecret,
+				EnvVars:     []string{"WEAVE_BITBUCKET_WEBHOOK_SECRET"},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if conf.PoliciesSourceConf.Path == "" {
+				return errors.New("missing policies-path value")
+			}
+			var err error
+			if conf.PoliciesSourceConf.Path, err = filepath.Abs(conf.PoliciesSourceConf.Path); err != nil {
+				return fmt.Errorf("invalid policies path: %w", err)
+			}
+			if conf.BaselineCreate != "" {
+				if conf.BaselineCreate, err = filepath.Abs(conf.BaselineCreate); err != nil {
+					return fmt.Errorf("invalid baseline create file: %w", err)
+				}
+			}
+			if err := conf.parseFlags(c); err != nil {
+				return err
+			}
+			serveConf.Server.Token = conf.GitRepositoryToken
+			return Serve(c.Context, *conf, serveConf)
+		},
+	}
+}
+
+// Serve runs the webhooks server until interrupted
+func Serve(ctx context.Context, conf Config, serveConf ServeConfig) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := server.New(serveConf.Server, func(ctx context.Context, job server.Job, dir string) error {
+		jobConf := conf.JobConfig(job, dir)
+		if jobConf.Remediate || jobConf.GenerateGitProviderReport || jobConf.GenerateGitProviderReview || jobConf.GenerateGitProviderComment {
+			if err := jobConf.ValidateGitRepositoryConf(); err != nil {
+				return err
+			}
+		}
+		var output bytes.Buffer
+		jobConf.Output = &output
+		result, err := run(ctx, jobConf)
+		writeJobOutput(os.Stdout, job, output.String())
+		if err != nil {
+			return err
+		}
+		log.Printf("pull request: %s#%d, scanned: %d, violations: %d", job.RepoURL, job.PullRequest, result.Scanned, result.ViolationCount)
+		return nil
+	})
+	s.Start(ctx)
+
+	httpServer := &http.Server{
+		Addr:              serveConf.Listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", serveConf.Listen)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		s.Shutdown()
+		return fmt.Errorf("failed to serve, error: %v", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shutdown server, error: %v", err)
+	}
+	s.Shutdown()
+	return nil
+}
+
+// JobConfig returns the config validating the pull request of the job checked out into dir, the
+// resources path and relative exceptions, baseline, policy config and config paths are relative to the
+// repository root. Output files are named after the job so concurrent jobs do not overwrite them
+func (c Config) JobConfig(job server.Job, dir string) Config {
+	conf := c
+	conf.EntitySourceConf.Path = filepath.Join(dir, c.EntitySourceConf.Path)
+	if c.ExceptionsFile != "" && !filepath.IsAbs(c.ExceptionsFile) {
+		conf.ExceptionsFile = filepath.Join(dir, c.ExceptionsFile)
+	}
+	if c.Baseline != "" && !filepath.IsAbs(c.Baseline) {
+		conf.Baseline = filepath.Join(dir, c.Baseline)
+	}
+	if c.PolicyConfigPath != "" && !filepath.IsAbs(c.PolicyConfigPath) {
+		conf.PolicyConfigPath = filepath.Join(dir, c.PolicyConfigPath)
+	}
+	if c.ConfigFile != "" && !filepath.IsAbs(c.ConfigFile) {
+		conf.ConfigFile = filepath.Join(dir, c.ConfigFile)
+	}
+	conf.SARIFOutputFile = jobOutputFile(c.SARIFOutputFile, job)
+	conf.SASTOutputFile = jobOutputFile(c.SASTOutputFile, job)
+	conf.JSONOutputFile = jobOutputFile(c.JSONOutputFile, job)
+	conf.BaselineCreate = jobOutputFile(c.BaselineCreate, job)
+	conf.RepositoryRoot = dir
+	conf.GitRepositoryProvider = job.Provider
+	conf.GitRepositoryURL = job.RepoURL
+	conf.GitRepositoryBranch = job.Branch
+	conf.GitRepositoryBase = job.BaseBranch
+	conf.GitRepositorySHA = job.SHA
+	conf.GitRepositoryPR = job.PullRequest
+	// the remediation branch can't be pushed to the fork of the head branch
+	if job.Fork {
+		conf.Remediate = false
+	}
+	return conf
+}
+
+// writeJobOutput writes the output of the job with each line prefixed by its pull request
+func writeJobOutput(w io.Writer, job server.Job, output string) {
+	if output == "" {
+		return
+	}
+	jobOutputLock.Lock()
+	defer jobOutputLock.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		fmt.Fprintf(w, "%s#%d: %s\n", job.RepoURL, job.PullRequest, line)
+	}
+}
+
+// jobOutputFile adds the repository, pull request and commit of the job to the output file name, e.g.
+// results.sarif is written to results-weaveworks_policies-7-0a1b2c3.sarif
+func jobOutputFile(path string, job server.Job) string {
+	if path == "" {
+		return ""
+	}
+	repo := job.RepoURL
+	if _, after, ok := strings.Cut(repo, "://"); ok {
+		repo = after
+	}
+	if _, after, ok := strings.Cut(repo, "/"); ok {
+		repo = after
+	}
+	sha := job.SHA
+	if len(sha) > shortSHALength {
+		sha = sha[:shortSHALength]
+	}
+	name := jobFileNameRegex.ReplaceAllString(fmt.Sprintf("%s-%d-%s", strings.Trim(repo, "/"), job.PullRequest, sha), "_")
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), name, ext)
+}